@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cpu
+
+import (
+	"errors"
+	"time"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+)
+
+// ErrNotImplemented indicates that a feature is not available on the current platform.
+var ErrNotImplemented = errors.New("not implemented on this platform")
+
+// Interrupts holds the system-wide interrupt counters since boot, summed across all CPUs
+type Interrupts struct {
+	// Total is the number of hardware interrupts serviced, from the intr line of /proc/stat
+	Total uint64 `struct:"total"`
+	// SoftIRQs is the number of each type of softirq, such as net_rx or timer, from /proc/softirqs
+	SoftIRQs map[string]uint64 `struct:"softirqs"`
+}
+
+// InterruptRates holds the per-second rates derived from two Interrupts samples
+type InterruptRates struct {
+	Total    float64            `struct:"total"`
+	SoftIRQs map[string]float64 `struct:"softirqs"`
+}
+
+// Rates returns the per-second interrupt rates between a previous sample and the current one.
+// elapsed should be the wall-clock time between the two samples.
+// Counters that are missing from the previous sample, or that have gone backwards, are left out.
+func (cur Interrupts) Rates(prev Interrupts, elapsed time.Duration) InterruptRates {
+	rates := InterruptRates{SoftIRQs: map[string]float64{}}
+	if elapsed <= 0 {
+		return rates
+	}
+
+	if cur.Total >= prev.Total {
+		rates.Total = metric.Round(float64(cur.Total-prev.Total) / elapsed.Seconds())
+	}
+	for name, count := range cur.SoftIRQs {
+		last, ok := prev.SoftIRQs[name]
+		if !ok || count < last {
+			continue
+		}
+		rates.SoftIRQs[name] = metric.Round(float64(count-last) / elapsed.Seconds())
+	}
+
+	return rates
+}
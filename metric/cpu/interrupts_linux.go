@@ -0,0 +1,99 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// GetInterrupts returns the system-wide hardware interrupt and softirq counters
+func GetInterrupts(hostfs resolve.Resolver) (Interrupts, error) {
+	statPath := resolve.ProcPath(hostfs, "stat")
+	raw, err := os.ReadFile(statPath)
+	if err != nil {
+		return Interrupts{}, fmt.Errorf("error reading %s: %w", statPath, err)
+	}
+	total, err := parseIntrLine(string(raw))
+	if err != nil {
+		return Interrupts{}, fmt.Errorf("error parsing %s: %w", statPath, err)
+	}
+
+	softirqPath := resolve.ProcPath(hostfs, "softirqs")
+	raw, err = os.ReadFile(softirqPath)
+	if err != nil {
+		return Interrupts{}, fmt.Errorf("error reading %s: %w", softirqPath, err)
+	}
+	softirqs, err := parseSoftIRQs(string(raw))
+	if err != nil {
+		return Interrupts{}, fmt.Errorf("error parsing %s: %w", softirqPath, err)
+	}
+
+	return Interrupts{Total: total, SoftIRQs: softirqs}, nil
+}
+
+// parseIntrLine returns the first value of the intr line in /proc/stat, which is the total across all interrupts.
+// The rest of the line is the count for each numbered interrupt.
+func parseIntrLine(raw string) (uint64, error) {
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "intr" {
+			continue
+		}
+		total, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("error parsing intr total %s: %w", fields[1], err)
+		}
+		return total, nil
+	}
+	return 0, fmt.Errorf("no intr line found")
+}
+
+// parseSoftIRQs sums the per-CPU columns of /proc/softirqs for each type of softirq.
+// The first line is a header with the CPU names; the type names are lowercased, so NET_RX is reported as net_rx.
+func parseSoftIRQs(raw string) (map[string]uint64, error) {
+	softirqs := map[string]uint64{}
+	lines := strings.Split(raw, "\n")
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("expected a header and at least one softirq")
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(fields[0], ":"))
+		var total uint64
+		for _, field := range fields[1:] {
+			count, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing value %s for softirq %s: %w", field, name, err)
+			}
+			total += count
+		}
+		softirqs[name] = total
+	}
+	return softirqs, nil
+}
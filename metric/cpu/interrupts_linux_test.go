@@ -0,0 +1,75 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestParseSoftIRQs(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "softirqs"))
+	require.NoError(t, err)
+
+	softirqs, err := parseSoftIRQs(string(raw))
+	require.NoError(t, err)
+	assert.Len(t, softirqs, 10)
+	assert.Equal(t, uint64(3), softirqs["hi"])
+	assert.Equal(t, uint64(236988), softirqs["net_rx"])
+	assert.Equal(t, uint64(400), softirqs["net_tx"])
+	assert.Equal(t, uint64(0), softirqs["irq_poll"])
+}
+
+func TestParseIntrLine(t *testing.T) {
+	raw := "cpu  2255 34 2290 22625563 6290 127 456 0 0 0\nintr 114930548 113199788 3 0 5 263 0 4 [... lots more numbers ...]\nctxt 1990473\n"
+	total, err := parseIntrLine(raw)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(114930548), total)
+
+	_, err = parseIntrLine("ctxt 1990473\n")
+	assert.Error(t, err)
+}
+
+func TestGetInterrupts(t *testing.T) {
+	interrupts, err := GetInterrupts(resolve.NewTestResolver("/"))
+	require.NoError(t, err)
+	assert.NotZero(t, interrupts.Total)
+	assert.Contains(t, interrupts.SoftIRQs, "timer")
+}
+
+func TestInterruptRates(t *testing.T) {
+	prev := Interrupts{Total: 1000, SoftIRQs: map[string]uint64{"net_rx": 500, "timer": 100, "rcu": 50}}
+	cur := Interrupts{Total: 3000, SoftIRQs: map[string]uint64{"net_rx": 1500, "timer": 10, "sched": 20}}
+
+	rates := cur.Rates(prev, 2*time.Second)
+	assert.Equal(t, 1000.0, rates.Total)
+	// timer went backwards and sched has no previous value, so neither gets a rate
+	assert.Equal(t, map[string]float64{"net_rx": 500}, rates.SoftIRQs)
+
+	assert.Zero(t, cur.Rates(prev, 0).Total)
+}
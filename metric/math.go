@@ -17,11 +17,22 @@
 
 package metric
 
-import "math"
+import (
+	"math"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+)
 
 // DefaultDecimalPlacesCount is the default number of decimal places
 const DefaultDecimalPlacesCount = 4
 
+// defaultClockTicks is the number of clock ticks per second used when sysconf(_SC_CLK_TCK) can't be read.
+// It's the value on every architecture linux supports.
+const defaultClockTicks = 100
+
+// clockTicks is the number of clock ticks per second, as returned by sysconf(_SC_CLK_TCK)
+var clockTicks = getClockTicks()
+
 // Round rounds the given float64 value to 4 digit precision.
 func Round(val float64) float64 {
 	return RoundWithPrecision(val, DefaultDecimalPlacesCount)
@@ -42,3 +53,38 @@ func RoundWithPrecision(val float64, precision int64) (newVal float64) {
 	newVal = round / pow
 	return newVal
 }
+
+// TicksToMs converts clock ticks, such as the CPU times in /proc/PID/stat, to milliseconds
+func TicksToMs(ticks uint64) float64 {
+	return float64(ticks) * 1000 / float64(clockTicks)
+}
+
+// TicksToMsUint is TicksToMs for counters, computed with integers so large counters keep their precision.
+// Counters too large to fit in a uint64 once they're converted are capped at math.MaxUint64, instead of wrapping.
+func TicksToMsUint(ticks uint64) uint64 {
+	whole := ticks / clockTicks
+	if whole > math.MaxUint64/1000 {
+		return math.MaxUint64
+	}
+	ms := whole * 1000
+	frac := ticks % clockTicks * 1000 / clockTicks
+	if ms > math.MaxUint64-frac {
+		return math.MaxUint64
+	}
+	return ms + frac
+}
+
+// MsToTicks converts milliseconds back to clock ticks, the unit the kernel reports CPU times in.
+// Partial ticks are rounded down.
+func MsToTicks(ms uint64) uint64 {
+	return ms * clockTicks / 1000
+}
+
+// Pct returns part as a fraction of whole, rounded to 4 digit precision.
+// The value is absent if whole is zero.
+func Pct(part, whole uint64) opt.Float {
+	if whole == 0 {
+		return opt.NewFloatNone()
+	}
+	return opt.FloatWith(Round(float64(part) / float64(whole)))
+}
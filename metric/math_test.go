@@ -18,11 +18,19 @@
 package metric
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// setClockTicks sets the clock tick rate for the rest of a test
+func setClockTicks(t *testing.T, ticks uint64) {
+	previous := clockTicks
+	clockTicks = ticks
+	t.Cleanup(func() { clockTicks = previous })
+}
+
 func TestRound(t *testing.T) {
 	assert.EqualValues(t, 0.5, Round(0.5))
 	assert.EqualValues(t, 0.5, Round(0.50004))
@@ -32,3 +40,56 @@ func TestRound(t *testing.T) {
 	assert.EqualValues(t, 1234.5, Round(1234.50004))
 	assert.EqualValues(t, 1234.5001, Round(1234.50005))
 }
+
+func TestTicksToMs(t *testing.T) {
+	setClockTicks(t, 100)
+	assert.EqualValues(t, 0, TicksToMs(0))
+	assert.EqualValues(t, 10, TicksToMs(1))
+	assert.EqualValues(t, 1500, TicksToMs(150))
+
+	setClockTicks(t, 250)
+	assert.EqualValues(t, 4, TicksToMs(1))
+	assert.EqualValues(t, 600, TicksToMs(150))
+}
+
+func TestTicksToMsUint(t *testing.T) {
+	setClockTicks(t, 100)
+	assert.EqualValues(t, 0, TicksToMsUint(0))
+	assert.EqualValues(t, 10, TicksToMsUint(1))
+	assert.EqualValues(t, 1500, TicksToMsUint(150))
+	// beyond the 53 bits a float64 can hold exactly
+	assert.EqualValues(t, uint64(1234567890123456780), TicksToMsUint(123456789012345678))
+	// capped rather than wrapped
+	assert.EqualValues(t, uint64(math.MaxUint64), TicksToMsUint(math.MaxUint64))
+	assert.EqualValues(t, uint64(math.MaxUint64), TicksToMsUint(math.MaxUint64/10+1))
+	assert.EqualValues(t, uint64(math.MaxUint64/10*10), TicksToMsUint(math.MaxUint64/10))
+}
+
+func TestMsToTicks(t *testing.T) {
+	setClockTicks(t, 100)
+	assert.EqualValues(t, 0, MsToTicks(0))
+	assert.EqualValues(t, 0, MsToTicks(9))
+	assert.EqualValues(t, 1, MsToTicks(10))
+	assert.EqualValues(t, 150, MsToTicks(1500))
+	assert.EqualValues(t, 150, MsToTicks(uint64(TicksToMs(150))))
+
+	setClockTicks(t, 250)
+	assert.EqualValues(t, 1, MsToTicks(4))
+	assert.EqualValues(t, 600, TicksToMsUint(150))
+	assert.EqualValues(t, 150, MsToTicks(TicksToMsUint(150)))
+}
+
+func TestPct(t *testing.T) {
+	assert.EqualValues(t, 0.5, Pct(1, 2).ValueOr(0))
+	assert.EqualValues(t, 0.3333, Pct(1, 3).ValueOr(0))
+	assert.EqualValues(t, 0.6667, Pct(2, 3).ValueOr(0))
+	assert.EqualValues(t, 1, Pct(3, 3).ValueOr(0))
+
+	// rounding at the last decimal place
+	assert.EqualValues(t, 0.0001, Pct(1, 20000).ValueOr(0))
+	assert.EqualValues(t, 0, Pct(1, 20001).ValueOr(1))
+	assert.True(t, Pct(0, 3).Exists())
+
+	assert.False(t, Pct(1, 0).Exists())
+	assert.False(t, Pct(0, 0).Exists())
+}
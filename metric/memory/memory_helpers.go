@@ -33,7 +33,7 @@ import (
 func ParseMeminfo(rootfs resolve.Resolver) (map[string]uint64, error) {
 	table := map[string]uint64{}
 
-	meminfoPath := rootfs.ResolveHostFS("/proc/meminfo")
+	meminfoPath := resolve.ProcPath(rootfs, "meminfo")
 	err := readFile(meminfoPath, func(line string) bool {
 		fields := strings.Split(line, ":")
 
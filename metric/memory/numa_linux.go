@@ -0,0 +1,144 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+const numaNodeDir = "/sys/devices/system/node"
+
+// NUMANode holds the memory usage of a single NUMA node
+type NUMANode struct {
+	ID    int          `struct:"id"`
+	Total opt.Uint     `struct:"total,omitempty"`
+	Free  opt.Uint     `struct:"free,omitempty"`
+	Used  UsedMemStats `struct:"used,omitempty"`
+}
+
+// GetNUMANodes returns per-node memory usage from /sys/devices/system/node/nodeN/meminfo,
+// sorted by node ID. On kernels without NUMA support, where the node directory does not exist,
+// a single node 0 is returned with the values from /proc/meminfo.
+func GetNUMANodes(rootfs resolve.Resolver) ([]NUMANode, error) {
+	nodeDir := rootfs.ResolveHostFS(numaNodeDir)
+	entries, err := os.ReadDir(nodeDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return getSingleNode(rootfs)
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading NUMA node directory %s: %w", nodeDir, err)
+	}
+
+	nodes := []NUMANode{}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "node") {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "node"))
+		if err != nil {
+			continue
+		}
+		node, err := parseNodeMeminfo(rootfs.ResolveHostFS(fmt.Sprintf("%s/%s/meminfo", numaNodeDir, entry.Name())), id)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching memory data for NUMA node %d: %w", id, err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 0 {
+		return getSingleNode(rootfs)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	return nodes, nil
+}
+
+// parseNodeMeminfo parses a per-node meminfo file, where lines are formatted as "Node 0 MemTotal: 16318836 kB"
+func parseNodeMeminfo(path string, id int) (NUMANode, error) {
+	table := map[string]uint64{}
+	err := readFile(path, func(line string) bool {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "Node" {
+			return true // skip on errors
+		}
+
+		value, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			return true // skip on errors
+		}
+		if len(fields) > 4 && fields[4] == "kB" {
+			value *= 1024
+		}
+		table[strings.TrimSuffix(fields[2], ":")] = value
+
+		return true
+	})
+	if err != nil {
+		return NUMANode{}, err
+	}
+
+	return nodeFromTable(id, table), nil
+}
+
+// getSingleNode reports the system-wide memory as node 0 on non-NUMA systems
+func getSingleNode(rootfs resolve.Resolver) ([]NUMANode, error) {
+	table, err := ParseMeminfo(rootfs)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching meminfo: %w", err)
+	}
+	return []NUMANode{nodeFromTable(0, table)}, nil
+}
+
+func nodeFromTable(id int, table map[string]uint64) NUMANode {
+	node := NUMANode{ID: id}
+
+	total, okTotal := table["MemTotal"]
+	if okTotal {
+		node.Total = opt.UintWith(total)
+	}
+	free, okFree := table["MemFree"]
+	if okFree {
+		node.Free = opt.UintWith(free)
+	}
+
+	if used, ok := table["MemUsed"]; ok {
+		node.Used.Bytes = opt.UintWith(used)
+	} else if okTotal && okFree {
+		node.Used.Bytes = opt.UintWith(total - free)
+	}
+
+	if total != 0 && node.Used.Bytes.Exists() {
+		node.Used.Pct = opt.FloatWith(metric.Round(float64(node.Used.Bytes.ValueOr(0)) / float64(total)))
+	}
+
+	return node
+}
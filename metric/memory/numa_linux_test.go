@@ -0,0 +1,61 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration && linux
+// +build !integration,linux
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetNUMANodes(t *testing.T) {
+	nodes, err := GetNUMANodes(resolve.NewTestResolver(""))
+	require.NoError(t, err)
+	require.NotEmpty(t, nodes)
+	assert.Equal(t, 0, nodes[0].ID)
+	assert.True(t, nodes[0].Total.ValueOr(0) > 0)
+}
+
+func TestNUMANodesParse(t *testing.T) {
+	nodes, err := GetNUMANodes(resolve.NewTestResolver("./testdata/numa"))
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+
+	assert.Equal(t, 1, nodes[1].ID)
+	assert.Equal(t, uint64(16318836*1024), nodes[0].Total.ValueOr(0))
+	assert.Equal(t, uint64(1203124*1024), nodes[0].Free.ValueOr(0))
+	assert.Equal(t, uint64(15115712*1024), nodes[0].Used.Bytes.ValueOr(0))
+	assert.Equal(t, 0.25, nodes[1].Used.Pct.ValueOr(0))
+}
+
+func TestNUMANodesSingleNode(t *testing.T) {
+	// oldkern has no /sys/devices/system/node, so we should fall back to /proc/meminfo
+	nodes, err := GetNUMANodes(resolve.NewTestResolver("./oldkern"))
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+
+	assert.Equal(t, 0, nodes[0].ID)
+	assert.Equal(t, uint64(61641404*1024), nodes[0].Total.ValueOr(0))
+	assert.Equal(t, uint64(25071456*1024), nodes[0].Free.ValueOr(0))
+}
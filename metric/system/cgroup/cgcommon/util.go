@@ -82,3 +82,32 @@ func ParseCgroupParamKeyValue(t string) (string, uint64, error) {
 
 	return parts[0], value, nil
 }
+
+// HugePageSizes returns the page sizes, such as "2MB" or "1GB", of the hugetlb.<size>.<file> entries in a cgroup.
+// The hugetlb controller has no single stats file, so the sizes have to be found from the file names.
+func HugePageSizes(path, file string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(path, "hugetlb.*."+file))
+	if err != nil {
+		return nil, fmt.Errorf("error listing hugetlb files in %s: %w", path, err)
+	}
+
+	sizes := make([]string, 0, len(matches))
+	for _, match := range matches {
+		size := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(match), "hugetlb."), "."+file)
+		// skip the reservation accounting files, such as hugetlb.2MB.rsvd.limit_in_bytes
+		if strings.Contains(size, ".") {
+			continue
+		}
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// WorkingSet returns the memory usage minus inactive file-backed memory, clamped at zero.
+// This is the working set size as calculated by kubelet and cAdvisor.
+func WorkingSet(usage, inactiveFile uint64) uint64 {
+	if inactiveFile > usage {
+		return 0
+	}
+	return usage - inactiveFile
+}
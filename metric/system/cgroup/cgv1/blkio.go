@@ -38,6 +38,8 @@ type BlockIOSubsystem struct {
 	ID    string   `json:"id,omitempty"`                   // ID of the cgroup.
 	Path  string   `json:"path,omitempty"`                 // Path to the cgroup relative to the cgroup subsystem's mountpoint.
 	Total TotalIOs `json:"total,omitempty" struct:"total"` // Throttle limits for upper IO rates and metrics.
+	// Per-device throttle metrics, keyed by the major:minor device ID, in the same layout as the V2 io.stat metrics.
+	Stats map[string]ThrottleStat `json:"stats,omitempty" struct:"stats"`
 	//CFQ      CFQScheduler   `json:"cfq,omitempty"`      // Completely fair queue scheduler limits and metrics.
 }
 
@@ -47,6 +49,18 @@ type TotalIOs struct {
 	Ios   uint64 `json:"ios,omitempty" struct:"ios,omitempty"`
 }
 
+// ThrottleStat contains the bytes and IO operations read and written by a cgroup on a single device
+type ThrottleStat struct {
+	Read  ThrottleMetric `json:"read" struct:"read"`
+	Write ThrottleMetric `json:"write" struct:"write"`
+}
+
+// ThrottleMetric groups together the bytes and IO operation count for a direction
+type ThrottleMetric struct {
+	Bytes uint64 `json:"bytes" struct:"bytes"`
+	IOs   uint64 `json:"ios" struct:"ios"`
+}
+
 // CFQScheduler contains limits and metrics for the proportional weight time
 // based division of disk policy. It is implemented in CFQ. Hence this policy
 // takes effect only on leaf nodes when CFQ is being used.
@@ -102,6 +116,11 @@ type DeviceID struct {
 	Minor uint64
 }
 
+// String returns the device ID in major:minor form
+func (id DeviceID) String() string {
+	return strconv.FormatUint(id.Major, 10) + ":" + strconv.FormatUint(id.Minor, 10)
+}
+
 // blkioValue holds a single blkio value associated with a device.
 type blkioValue struct {
 	DeviceID
@@ -193,9 +212,14 @@ func blkioThrottle(path string, blkio *BlockIOSubsystem) error {
 		}
 	}
 
-	for _, dev := range devices {
+	blkio.Stats = make(map[string]ThrottleStat, len(devices))
+	for id, dev := range devices {
 		blkio.Total.Bytes += dev.Bytes.Read + dev.Bytes.Write
 		blkio.Total.Ios += dev.IOs.Read + dev.IOs.Write
+		blkio.Stats[id.String()] = ThrottleStat{
+			Read:  ThrottleMetric{Bytes: dev.Bytes.Read, IOs: dev.IOs.Read},
+			Write: ThrottleMetric{Bytes: dev.Bytes.Write, IOs: dev.IOs.Write},
+		}
 	}
 	return nil
 }
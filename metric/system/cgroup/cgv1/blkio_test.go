@@ -19,9 +19,12 @@ package cgv1
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const blkioPath = "../testdata/docker/sys/fs/cgroup/blkio/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
@@ -63,6 +66,57 @@ func TestBlkioThrottle(t *testing.T) {
 
 }
 
+func TestBlkioThrottleDevices(t *testing.T) {
+	path := t.TempDir()
+	serviceBytes := `8:16 Read 1048576
+8:16 Write 4096
+8:16 Sync 4096
+8:16 Async 1048576
+8:16 Discard 0
+8:16 Total 1052672
+8:0 Read 512
+8:0 Write 2097152
+8:0 Sync 2097152
+8:0 Async 512
+8:0 Discard 0
+8:0 Total 2097664
+Total 3150336
+`
+	serviced := `8:16 Read 256
+8:16 Write 1
+8:16 Sync 1
+8:16 Async 256
+8:16 Discard 0
+8:16 Total 257
+8:0 Read 1
+8:0 Write 512
+8:0 Sync 512
+8:0 Async 1
+8:0 Discard 0
+8:0 Total 513
+Total 770
+`
+	require.NoError(t, os.WriteFile(filepath.Join(path, "blkio.throttle.io_service_bytes"), []byte(serviceBytes), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "blkio.throttle.io_serviced"), []byte(serviced), 0o644))
+
+	blkio := BlockIOSubsystem{}
+	require.NoError(t, blkioThrottle(path, &blkio))
+
+	expected := map[string]ThrottleStat{
+		"8:16": {
+			Read:  ThrottleMetric{Bytes: 1048576, IOs: 256},
+			Write: ThrottleMetric{Bytes: 4096, IOs: 1},
+		},
+		"8:0": {
+			Read:  ThrottleMetric{Bytes: 512, IOs: 1},
+			Write: ThrottleMetric{Bytes: 2097152, IOs: 512},
+		},
+	}
+	assert.Equal(t, expected, blkio.Stats)
+	assert.Equal(t, uint64(3150336), blkio.Total.Bytes)
+	assert.Equal(t, uint64(770), blkio.Total.Ios)
+}
+
 func TestBlockIOSubsystemGet(t *testing.T) {
 	blkio := BlockIOSubsystem{}
 	if err := blkio.Get(blkioPath); err != nil {
@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cgv1
+
+import (
+	"fmt"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgcommon"
+)
+
+// HugeTLBSubsystem contains the metrics and limits from the "hugetlb" subsystem.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/hugetlb.txt
+type HugeTLBSubsystem struct {
+	ID   string `json:"id,omitempty"`   // ID of the cgroup.
+	Path string `json:"path,omitempty"` // Path to the cgroup relative to the cgroup subsystem's mountpoint.
+
+	// Sizes holds the usage and limit of each huge page size, keyed by the size used by the kernel, such as "2MB".
+	Sizes map[string]MemoryData `json:"sizes" struct:"sizes"`
+}
+
+// Get reads metrics from the "hugetlb" subsystem. path is the filepath to the
+// cgroup hierarchy to read.
+func (hugetlb *HugeTLBSubsystem) Get(path string) error {
+	sizes, err := cgcommon.HugePageSizes(path, "limit_in_bytes")
+	if err != nil {
+		return err
+	}
+
+	hugetlb.Sizes = make(map[string]MemoryData, len(sizes))
+	for _, size := range sizes {
+		// The hugetlb files use the same usage_in_bytes, max_usage_in_bytes, limit_in_bytes and failcnt names as the memory subsystem
+		data := MemoryData{}
+		if err := memoryData(path, "hugetlb."+size, &data); err != nil {
+			return fmt.Errorf("error fetching hugetlb stats for %s pages: %w", size, err)
+		}
+		hugetlb.Sizes[size] = data
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cgv1
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHugeTLB(t *testing.T) {
+	path := t.TempDir()
+	files := map[string]string{
+		"hugetlb.2MB.usage_in_bytes":      "4194304",
+		"hugetlb.2MB.max_usage_in_bytes":  "8388608",
+		"hugetlb.2MB.limit_in_bytes":      "9223372036854771712",
+		"hugetlb.2MB.failcnt":             "3",
+		"hugetlb.2MB.rsvd.limit_in_bytes": "9223372036854771712",
+		"hugetlb.1GB.usage_in_bytes":      "1073741824",
+		"hugetlb.1GB.max_usage_in_bytes":  "1073741824",
+		"hugetlb.1GB.limit_in_bytes":      "2147483648",
+		"hugetlb.1GB.failcnt":             "0",
+	}
+	for name, value := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(path, name), []byte(value+"\n"), 0o644))
+	}
+
+	hugetlb := HugeTLBSubsystem{}
+	require.NoError(t, hugetlb.Get(path))
+	require.Len(t, hugetlb.Sizes, 2)
+
+	assert.Equal(t, uint64(4194304), hugetlb.Sizes["2MB"].Usage.Bytes)
+	assert.Equal(t, uint64(8388608), hugetlb.Sizes["2MB"].Usage.Max.Bytes)
+	assert.Equal(t, uint64(9223372036854771712), hugetlb.Sizes["2MB"].Limit.Bytes)
+	assert.Equal(t, uint64(3), hugetlb.Sizes["2MB"].Failures)
+
+	assert.Equal(t, uint64(1073741824), hugetlb.Sizes["1GB"].Usage.Bytes)
+	assert.Equal(t, uint64(2147483648), hugetlb.Sizes["1GB"].Limit.Bytes)
+	assert.Equal(t, uint64(0), hugetlb.Sizes["1GB"].Failures)
+}
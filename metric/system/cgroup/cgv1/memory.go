@@ -37,6 +37,18 @@ type MemorySubsystem struct {
 	Kernel    MemoryData `json:"kmem" struct:"kmem"`         // Kernel memory used by tasks in this cgroup.
 	KernelTCP MemoryData `json:"kmem_tcp" struct:"kmem_tcp"` // Kernel TCP buffer memory used by tasks in this cgroup.
 	Stats     MemoryStat `json:"stats" struct:"stats"`       // A wide range of memory statistics.
+	// OOM killer state and the number of processes killed by it. The number of times the limit was hit is in Mem.Failures.
+	OOMControl OOMControl `json:"oom_control" struct:"oom_control"`
+	// Usage minus inactive file-backed memory, the same as the working set reported by kubelet.
+	WorkingSet opt.Bytes `json:"working_set" struct:"working_set"`
+}
+
+// OOMControl contains the data from memory.oom_control
+type OOMControl struct {
+	KillDisable uint64 `json:"oom_kill_disable" struct:"oom_kill_disable"` // 1 if the OOM killer is disabled for this cgroup.
+	UnderOOM    uint64 `json:"under_oom" struct:"under_oom"`               // 1 if the cgroup is currently out of memory, and its tasks are paused.
+	// Number of processes killed by the OOM killer. Only reported by kernels 4.13 and newer.
+	OOMKill opt.Uint `json:"oom_kill,omitempty" struct:"oom_kill,omitempty"`
 }
 
 // MemoryData groups related memory usage metrics and limits.
@@ -112,6 +124,12 @@ func (mem *MemorySubsystem) Get(path string) error {
 		return fmt.Errorf("error fetching memory.stat metrics: %w", err)
 	}
 
+	if err := oomControl(path, &mem.OOMControl); err != nil {
+		return fmt.Errorf("error fetching memory.oom_control metrics: %w", err)
+	}
+
+	mem.WorkingSet.Bytes = cgcommon.WorkingSet(mem.Mem.Usage.Bytes, mem.Stats.InactiveFile.Bytes)
+
 	return nil
 }
 
@@ -194,3 +212,32 @@ func memoryStats(path string, mem *MemorySubsystem) error {
 
 	return sc.Err()
 }
+
+func oomControl(path string, oom *OOMControl) error {
+	f, err := os.Open(filepath.Join(path, "memory.oom_control"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		t, v, err := cgcommon.ParseCgroupParamKeyValue(sc.Text())
+		if err != nil {
+			return err
+		}
+		switch t {
+		case "oom_kill_disable":
+			oom.KillDisable = v
+		case "under_oom":
+			oom.UnderOOM = v
+		case "oom_kill":
+			oom.OOMKill = opt.UintWith(v)
+		}
+	}
+
+	return sc.Err()
+}
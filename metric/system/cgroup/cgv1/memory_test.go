@@ -19,9 +19,12 @@ package cgv1
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const memoryPath = "../testdata/docker/sys/fs/cgroup/memory/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
@@ -98,6 +101,23 @@ func TestMemoryDataKernelTCP(t *testing.T) {
 	assert.Equal(t, uint64(0), usage.Failures)
 }
 
+func TestOOMControl(t *testing.T) {
+	oom := OOMControl{}
+	require.NoError(t, oomControl(memoryPath, &oom))
+	assert.Equal(t, uint64(0), oom.KillDisable)
+	assert.Equal(t, uint64(0), oom.UnderOOM)
+	// not reported by the kernel the test data was taken from
+	assert.False(t, oom.OOMKill.Exists())
+
+	path := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(path, "memory.oom_control"), []byte("oom_kill_disable 1\nunder_oom 1\noom_kill 4\n"), 0o644))
+	oom = OOMControl{}
+	require.NoError(t, oomControl(path, &oom))
+	assert.Equal(t, uint64(1), oom.KillDisable)
+	assert.Equal(t, uint64(1), oom.UnderOOM)
+	assert.Equal(t, uint64(4), oom.OOMKill.ValueOr(0))
+}
+
 func TestMemorySubsystemGet(t *testing.T) {
 	mem := MemorySubsystem{}
 	if err := mem.Get(memoryPath); err != nil {
@@ -109,6 +129,7 @@ func TestMemorySubsystemGet(t *testing.T) {
 	assert.Equal(t, uint64(295997440), mem.MemSwap.Usage.Bytes)
 	assert.Equal(t, uint64(40), mem.Kernel.Usage.Bytes)
 	assert.Equal(t, uint64(10), mem.KernelTCP.Usage.Bytes)
+	assert.Equal(t, uint64(295997440-40108032), mem.WorkingSet.Bytes)
 }
 
 func TestMemorySubsystemJSON(t *testing.T) {
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cgv1
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgcommon"
+)
+
+// NetClsSubsystem contains the class ID from the "net_cls" subsystem.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/net_cls.txt
+type NetClsSubsystem struct {
+	ID   string `json:"id,omitempty"`   // ID of the cgroup.
+	Path string `json:"path,omitempty"` // Path to the cgroup relative to the cgroup subsystem's mountpoint.
+
+	// ClassID is the network class identifier tagged on packets sent from the cgroup.
+	ClassID uint64 `json:"classid" struct:"classid"`
+	// Handle is ClassID in the major:minor hexadecimal form used by tc, such as "10:1".
+	Handle string `json:"handle,omitempty" struct:"handle,omitempty"`
+}
+
+// Get reads the class ID from the "net_cls" subsystem. path is the filepath to the
+// cgroup hierarchy to read.
+func (netcls *NetClsSubsystem) Get(path string) error {
+	classID, err := cgcommon.ParseUintFromFile(path, "net_cls.classid")
+	if err != nil {
+		return fmt.Errorf("error fetching net_cls.classid: %w", err)
+	}
+	netcls.ClassID = classID
+	if classID != 0 {
+		netcls.Handle = fmt.Sprintf("%x:%x", classID>>16, classID&0xffff)
+	}
+	return nil
+}
+
+// NetPrioSubsystem contains the per-interface priorities from the "net_prio" subsystem.
+//
+// https://www.kernel.org/doc/Documentation/cgroup-v1/net_prio.txt
+type NetPrioSubsystem struct {
+	ID   string `json:"id,omitempty"`   // ID of the cgroup.
+	Path string `json:"path,omitempty"` // Path to the cgroup relative to the cgroup subsystem's mountpoint.
+
+	// IfPrioMap holds the priority of traffic sent from the cgroup, keyed by network interface.
+	IfPrioMap map[string]uint64 `json:"ifpriomap,omitempty" struct:"ifpriomap,omitempty"`
+}
+
+// Get reads the interface priorities from the "net_prio" subsystem. path is the filepath to the
+// cgroup hierarchy to read.
+func (netprio *NetPrioSubsystem) Get(path string) error {
+	f, err := os.Open(filepath.Join(path, "net_prio.ifpriomap"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error opening net_prio.ifpriomap: %w", err)
+	}
+	defer f.Close()
+
+	netprio.IfPrioMap = map[string]uint64{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		prio, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing priority of interface %s: %w", fields[0], err)
+		}
+		netprio.IfPrioMap[fields[0]] = prio
+	}
+
+	return sc.Err()
+}
@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cgv1
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetCls(t *testing.T) {
+	path := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(path, "net_cls.classid"), []byte("1048577\n"), 0o644))
+
+	netcls := NetClsSubsystem{}
+	require.NoError(t, netcls.Get(path))
+	assert.Equal(t, uint64(0x100001), netcls.ClassID)
+	assert.Equal(t, "10:1", netcls.Handle)
+
+	// an unset class ID has no handle
+	netcls = NetClsSubsystem{}
+	require.NoError(t, netcls.Get(t.TempDir()))
+	assert.Zero(t, netcls.ClassID)
+	assert.Empty(t, netcls.Handle)
+}
+
+func TestNetPrio(t *testing.T) {
+	path := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(path, "net_prio.ifpriomap"), []byte("lo 0\neth0 5\ndocker0 2\n"), 0o644))
+
+	netprio := NetPrioSubsystem{}
+	require.NoError(t, netprio.Get(path))
+	assert.Equal(t, map[string]uint64{"lo": 0, "eth0": 5, "docker0": 2}, netprio.IfPrioMap)
+
+	netprio = NetPrioSubsystem{}
+	require.NoError(t, netprio.Get(t.TempDir()))
+	assert.Nil(t, netprio.IfPrioMap)
+}
@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cgv2
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgcommon"
+)
+
+// HugeTLBSubsystem contains the metrics and limits from the "hugetlb" controller.
+type HugeTLBSubsystem struct {
+	ID   string `json:"id,omitempty"`   // ID of the cgroup.
+	Path string `json:"path,omitempty"` // Path to the cgroup relative to the cgroup subsystem's mountpoint.
+
+	// Sizes holds the usage and limit of each huge page size, keyed by the size used by the kernel, such as "2MB".
+	Sizes map[string]HugeTLBData `json:"sizes" struct:"sizes"`
+}
+
+// HugeTLBData contains the usage and limit for a single huge page size
+type HugeTLBData struct {
+	Usage opt.Bytes    `json:"usage" struct:"usage"`
+	Max   opt.BytesOpt `json:"max,omitempty" struct:"max,omitempty"`
+}
+
+// Get fetches hugetlb controller metrics for V2 cgroups
+func (hugetlb *HugeTLBSubsystem) Get(path string) error {
+	sizes, err := cgcommon.HugePageSizes(path, "max")
+	if err != nil {
+		return err
+	}
+
+	hugetlb.Sizes = make(map[string]HugeTLBData, len(sizes))
+	for _, size := range sizes {
+		prefix := "hugetlb." + size
+		data := HugeTLBData{}
+		data.Usage.Bytes, err = cgcommon.ParseUintFromFile(filepath.Join(path, prefix+".current"))
+		if err != nil {
+			return fmt.Errorf("error reading %s.current file: %w", prefix, err)
+		}
+		// like memory.max, this can be set to "max"
+		data.Max.Bytes, err = maxOrValue(path, prefix+".max")
+		if err != nil {
+			return fmt.Errorf("error parsing %s.max file: %w", prefix, err)
+		}
+		hugetlb.Sizes[size] = data
+	}
+
+	return nil
+}
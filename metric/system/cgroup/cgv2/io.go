@@ -26,7 +26,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgcommon"
 )
 
@@ -66,7 +65,6 @@ func (io *IOSubsystem) Get(path string, resolveDevIDs bool) error {
 	//Pressure doesn't exist on certain V2 implementations.
 	_, err = os.Stat(filepath.Join(path, "io.pressure"))
 	if errors.Is(err, os.ErrNotExist) {
-		logp.L().Debugf("io.pressure does not exist. Skipping.")
 		return nil
 	}
 
@@ -40,6 +40,8 @@ type MemorySubsystem struct {
 	Mem     MemoryData `json:"mem" struct:"mem"`     // Memory usage by tasks in this cgroup.
 	MemSwap MemoryData `json:"memsw" struct:"memsw"` // Memory plus swap usage by tasks in this cgroup.
 	Stats   MemoryStat `json:"stats" struct:"stats"` // A wide range of memory statistics.
+	// Usage minus inactive file-backed memory, the same as the working set reported by kubelet.
+	WorkingSet opt.Bytes `json:"working_set" struct:"working_set"`
 }
 
 // MemoryData contains basic metrics for the V2 controller
@@ -163,6 +165,7 @@ func (mem *MemorySubsystem) Get(path string) error {
 	if err != nil {
 		return fmt.Errorf("error fetching memory.stat: %w", err)
 	}
+	mem.WorkingSet.Bytes = cgcommon.WorkingSet(mem.Mem.Usage.Bytes, mem.Stats.InactiveFile.Bytes)
 
 	return nil
 }
@@ -18,9 +18,14 @@
 package cgv2
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/opt"
 )
 
 const v2Path = "../testdata/docker/sys/fs/cgroup/system.slice/docker-1c8fa019edd4b9d4b2856f4932c55929c5c118c808ed5faee9a135ca6e84b039.scope"
@@ -175,11 +180,24 @@ func TestGetMem(t *testing.T) {
 	assert.Equal(t, uint64(3), mem.Mem.Events.High)
 	assert.Equal(t, uint64(4), mem.Mem.Low.Bytes)
 	assert.Equal(t, uint64(9125888), mem.Mem.Usage.Bytes)
+	assert.Equal(t, uint64(9125888-270336), mem.WorkingSet.Bytes)
 
 	assert.Equal(t, uint64(17756400), mem.Stats.SlabReclaimable.Bytes)
 	assert.Equal(t, uint64(12), mem.Stats.THPFaultAlloc)
 }
 
+func TestMemoryEvents(t *testing.T) {
+	evt, err := fetchEventsFile(v2Path, "memory.events")
+	require.NoError(t, err)
+
+	assert.Equal(t, opt.UintWith(10), evt.Low)
+	assert.Equal(t, uint64(3), evt.High)
+	assert.Equal(t, uint64(2), evt.Max)
+	assert.Equal(t, opt.UintWith(1), evt.OOM)
+	assert.Equal(t, opt.UintWith(1), evt.OOMKill)
+	assert.False(t, evt.Fail.Exists())
+}
+
 func TestGetCPU(t *testing.T) {
 	cpu := CPUSubsystem{}
 	err := cpu.Get(v2Path)
@@ -188,3 +206,30 @@ func TestGetCPU(t *testing.T) {
 	assert.Equal(t, uint64(26772130245), cpu.Stats.Usage.NS)
 	assert.Equal(t, uint64(5793060316), cpu.Stats.System.NS)
 }
+
+func TestGetHugeTLB(t *testing.T) {
+	path := t.TempDir()
+	files := map[string]string{
+		"hugetlb.2MB.current":      "4194304",
+		"hugetlb.2MB.max":          "max",
+		"hugetlb.2MB.events":       "max 0",
+		"hugetlb.2MB.rsvd.max":     "max",
+		"hugetlb.2MB.rsvd.current": "0",
+		"hugetlb.1GB.current":      "1073741824",
+		"hugetlb.1GB.max":          "2147483648",
+		"hugetlb.1GB.events":       "max 2",
+	}
+	for name, value := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(path, name), []byte(value+"\n"), 0o644))
+	}
+
+	hugetlb := HugeTLBSubsystem{}
+	require.NoError(t, hugetlb.Get(path))
+	require.Len(t, hugetlb.Sizes, 2)
+
+	assert.Equal(t, uint64(4194304), hugetlb.Sizes["2MB"].Usage.Bytes)
+	assert.False(t, hugetlb.Sizes["2MB"].Max.Bytes.Exists())
+
+	assert.Equal(t, uint64(1073741824), hugetlb.Sizes["1GB"].Usage.Bytes)
+	assert.Equal(t, uint64(2147483648), hugetlb.Sizes["1GB"].Max.Bytes.ValueOr(0))
+}
@@ -18,8 +18,10 @@
 package cgroup
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -38,17 +40,23 @@ type StatsV1 struct {
 	CPUAccounting *cgv1.CPUAccountingSubsystem `json:"cpuacct,omitempty" struct:"cpuacct,omitempty"`
 	Memory        *cgv1.MemorySubsystem        `json:"memory,omitempty" struct:"memory,omitempty"`
 	BlockIO       *cgv1.BlockIOSubsystem       `json:"blkio,omitempty" struct:"blkio,omitempty"`
+	HugeTLB       *cgv1.HugeTLBSubsystem       `json:"hugetlb,omitempty" struct:"hugetlb,omitempty"`
+	NetCls        *cgv1.NetClsSubsystem        `json:"net_cls,omitempty" struct:"net_cls,omitempty"`
+	NetPrio       *cgv1.NetPrioSubsystem       `json:"net_prio,omitempty" struct:"net_prio,omitempty"`
+	Paths         map[string]string            `json:"paths,omitempty" struct:"paths,omitempty"` // Resolved path of each controller. Only set with ReaderOptions.IncludePath.
 	Version       CgroupsVersion               `json:"cgroups_version,omitempty" struct:"cgroups_version,omitempty"`
 }
 
 // StatsV2 contains metrics and limits from each of the cgroup subsystems.
 type StatsV2 struct {
-	ID      string                `json:"id,omitempty"`   // ID of the cgroup.
-	Path    string                `json:"path,omitempty"` // Path to the cgroup relative to the cgroup subsystem's mountpoint.
-	CPU     *cgv2.CPUSubsystem    `json:"cpu,omitempty" struct:"cpu,omitempty"`
-	Memory  *cgv2.MemorySubsystem `json:"memory,omitempty" struct:"memory,omitempty"`
-	IO      *cgv2.IOSubsystem     `json:"io,omitempty" struct:"io,omitempty"`
-	Version CgroupsVersion        `json:"cgroups_version,omitempty" struct:"cgroups_version,omitempty"`
+	ID      string                 `json:"id,omitempty"`   // ID of the cgroup.
+	Path    string                 `json:"path,omitempty"` // Path to the cgroup relative to the cgroup subsystem's mountpoint.
+	CPU     *cgv2.CPUSubsystem     `json:"cpu,omitempty" struct:"cpu,omitempty"`
+	Memory  *cgv2.MemorySubsystem  `json:"memory,omitempty" struct:"memory,omitempty"`
+	IO      *cgv2.IOSubsystem      `json:"io,omitempty" struct:"io,omitempty"`
+	HugeTLB *cgv2.HugeTLBSubsystem `json:"hugetlb,omitempty" struct:"hugetlb,omitempty"`
+	Paths   map[string]string      `json:"paths,omitempty" struct:"paths,omitempty"` // Resolved path of each controller. Only set with ReaderOptions.IncludePath.
+	Version CgroupsVersion         `json:"cgroups_version,omitempty" struct:"cgroups_version,omitempty"`
 }
 
 // CgroupsVersion is a version tag that defines what version of cgroups is attached to a process
@@ -60,12 +68,43 @@ const CgroupsV1 CgroupsVersion = 1
 // CgroupsV2 indicates that a process is cgroupsv2
 const CgroupsV2 CgroupsVersion = 2
 
+// CgroupsMode describes which cgroup hierarchies are mounted on a host
+type CgroupsMode int
+
+const (
+	// CgroupsModeUnknown indicates that no cgroup hierarchies were found
+	CgroupsModeUnknown CgroupsMode = iota
+	// CgroupsModeV1 indicates that only cgroups v1 controllers are mounted
+	CgroupsModeV1
+	// CgroupsModeV2 indicates that only the unified cgroups v2 hierarchy is mounted
+	CgroupsModeV2
+	// CgroupsModeHybrid indicates that both v1 controllers and a cgroups v2 hierarchy are mounted,
+	// as systemd does with /sys/fs/cgroup/unified
+	CgroupsModeHybrid
+)
+
+// String returns the name of the mode, for tagging metrics
+func (mode CgroupsMode) String() string {
+	switch mode {
+	case CgroupsModeV1:
+		return "v1"
+	case CgroupsModeV2:
+		return "v2"
+	case CgroupsModeHybrid:
+		return "hybrid"
+	}
+	return "unknown"
+}
+
 const (
 	blkioStat   = "blkio"
 	cpuAcctStat = "cpuacct"
 	cpuStat     = "cpu"
+	hugetlbStat = "hugetlb"
 	ioStat      = "io"
 	memoryStat  = "memory"
+	netClsStat  = "net_cls"
+	netPrioStat = "net_prio"
 )
 
 //nolint: deadcode,structcheck,unused // needed by other platforms
@@ -84,7 +123,10 @@ type Reader struct {
 	rootfsMountpoint         resolve.Resolver
 	ignoreRootCgroups        bool // Ignore a cgroup when its path is "/".
 	cgroupsHierarchyOverride string
+	includePath              bool        // Report the resolved controller paths in the stats.
+	cache                    *statsCache // Stats read in the current collection cycle. nil unless caching is enabled.
 	cgroupMountpoints        Mountpoints // Mountpoints for each subsystem (e.g. cpu, cpuacct, memory, blkio).
+	logger                   *logp.Logger
 }
 
 // ReaderOptions holds options for NewReaderOptions.
@@ -105,6 +147,19 @@ type ReaderOptions struct {
 	// where the paths in /proc/<pid>/cgroup do not correspond to any
 	// paths under /sys/fs/cgroup.
 	CgroupsHierarchyOverride string
+
+	// IncludePath adds the resolved path of each controller to the stats,
+	// which is useful for debugging the path resolution.
+	IncludePath bool
+
+	// CacheStats enables caching of the stats read from each cgroup, so that
+	// reading the stats of many processes in the same cgroup only reads the
+	// controller files once. Cached stats are kept until ResetCache is called,
+	// which should be done at the start of each collection cycle.
+	CacheStats bool
+
+	// Logger is used for the reader's logging, instead of the global logger.
+	Logger *logp.Logger
 }
 
 // NewReader creates and returns a new Reader.
@@ -130,12 +185,49 @@ func NewReaderOptions(opts ReaderOptions) (*Reader, error) {
 		return nil, fmt.Errorf("error finding mountpoints: %w", err)
 	}
 
-	return &Reader{
+	reader := &Reader{
 		rootfsMountpoint:         opts.RootfsMountpoint,
 		ignoreRootCgroups:        opts.IgnoreRootCgroups,
 		cgroupsHierarchyOverride: opts.CgroupsHierarchyOverride,
+		includePath:              opts.IncludePath,
 		cgroupMountpoints:        mountpoints,
-	}, nil
+		logger:                   opts.Logger,
+	}
+	if opts.CacheStats {
+		reader.cache = newStatsCache()
+	}
+	return reader, nil
+}
+
+// log returns the logger set in ReaderOptions, or the global logger.
+// The global logger isn't stored, so it's still used if it's replaced after the reader is created.
+func (r Reader) log() *logp.Logger {
+	if r.logger != nil {
+		return r.logger
+	}
+	return logp.L()
+}
+
+// ResetCache drops the stats cached since the last reset, so they will be read again.
+// This does nothing unless the reader was created with ReaderOptions.CacheStats.
+func (r *Reader) ResetCache() {
+	r.cache.reset()
+}
+
+// Version reports which cgroup hierarchies are in use on the host, based on the cgroup and cgroup2 mounts found by the reader.
+// Individual processes on a hybrid host may still be attached to either version; see CgroupsVersion.
+func (r *Reader) Version() CgroupsMode {
+	hasV1 := len(r.cgroupMountpoints.V1Mounts) > 0
+	hasV2 := r.cgroupMountpoints.V2Loc != ""
+	switch {
+	case hasV1 && hasV2:
+		return CgroupsModeHybrid
+	case hasV2:
+		return CgroupsModeV2
+	case hasV1:
+		return CgroupsModeV1
+	}
+	return CgroupsModeUnknown
 }
 
 // CgroupsVersion reports if the given PID is attached to a V1 or V2 controller
@@ -165,7 +257,7 @@ func (r *Reader) CgroupsVersion(pid int) (CgroupsVersion, error) {
 		// V1 and V2 controllers on a cgroup. If the V2 controller has no actual controllers associated with it,
 		// We revert to V1. If it does, report V2. In the future, we may want to "combine" V2 and V1 metrics somehow.
 		if len(controllers) > 0 {
-			logp.L().Debugf("fetching V2 controller: %#v for pid %d\n", controllers, pid)
+			r.log().Debugf("fetching V2 controller: %#v for pid %d\n", controllers, pid)
 			return CgroupsV2, nil
 		}
 		return CgroupsV1, nil
@@ -175,6 +267,7 @@ func (r *Reader) CgroupsVersion(pid int) (CgroupsVersion, error) {
 
 // GetStatsForPid is a generic method that returns a CGStats interface for V1 and V2
 // cgroup statistics. For applications that require raw metrics, use GetV*StatsForProcess()
+// The returned CGStats is nil if the process is in a V2 root cgroup and root cgroups are ignored.
 func (r *Reader) GetStatsForPid(pid int) (CGStats, error) {
 	v, err := r.CgroupsVersion(pid)
 	if err != nil {
@@ -183,7 +276,12 @@ func (r *Reader) GetStatsForPid(pid int) (CGStats, error) {
 	if v == CgroupsV1 {
 		return r.GetV1StatsForProcess(pid)
 	}
-	return r.GetV2StatsForProcess(pid)
+	stats, err := r.GetV2StatsForProcess(pid)
+	// don't wrap a nil *StatsV2 in a non-nil interface
+	if stats == nil {
+		return nil, err
+	}
+	return stats, err
 }
 
 // GetV1StatsForProcess returns cgroup metrics and limits associated with a process.
@@ -194,44 +292,124 @@ func (r *Reader) GetV1StatsForProcess(pid int) (*StatsV1, error) { //nolint: dup
 		return nil, err
 	}
 
+	return r.v1Stats(paths.V1, r.ignoreRootCgroups)
+}
+
+// GetV2StatsForProcess returns cgroup metrics and limits associated with a process.
+// If root cgroups are ignored and the process is in the root of the unified hierarchy, nil is returned,
+// as the root cgroup's metrics would be those of the whole host.
+func (r *Reader) GetV2StatsForProcess(pid int) (*StatsV2, error) { //nolint: dupl // return value is different
+	// Read /proc/[pid]/cgroup to get the paths to the cgroup metrics.
+	paths, err := r.ProcessCgroupPaths(pid)
+	if err != nil {
+		return nil, err
+	}
+	if r.ignoreRootCgroups && r.isV2Root(paths.V2) {
+		return nil, nil
+	}
+	return r.v2Stats(paths.V2, r.ignoreRootCgroups)
+}
+
+// GetStatsForPath returns the cgroup metrics and limits of the cgroup at the given path,
+// relative to the cgroup mountpoints (e.g. /system.slice/docker-<id>.scope), without looking up a process.
+// The V2 hierarchy is used if the cgroup has any V2 controllers, otherwise the V1 controllers that have the cgroup are read.
+// As the path is given explicitly, it's read even if it's the root cgroup and root cgroups are ignored.
+func (r *Reader) GetStatsForPath(path string) (CGStats, error) {
+	path = filepath.Join("/", path)
+	if r.cgroupMountpoints.V2Loc != "" {
+		v2Paths := map[string]ControllerPath{}
+		err := addV2Controllers(v2Paths, path, filepath.Join(r.cgroupMountpoints.V2Loc, path))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("error fetching cgroupV2 controllers for path %s: %w", path, err)
+		}
+		if len(v2Paths) > 0 {
+			stats, err := r.v2Stats(v2Paths, false)
+			if err != nil {
+				return nil, err
+			}
+			return stats, nil
+		}
+	}
+
+	v1Paths := map[string]ControllerPath{}
+	for subsystem, mountpoint := range r.cgroupMountpoints.V1Mounts {
+		fullPath := filepath.Join(mountpoint, path)
+		if _, err := os.Stat(fullPath); err != nil {
+			continue
+		}
+		v1Paths[subsystem] = ControllerPath{ControllerPath: path, FullPath: fullPath, IsV2: false}
+	}
+	if len(v1Paths) == 0 {
+		return nil, fmt.Errorf("no cgroup controllers found for path %s: %w", path, os.ErrNotExist)
+	}
+	stats, err := r.v1Stats(v1Paths, false)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// v1Stats reads the stats of the given V1 controllers, skipping those in the root cgroup if ignoreRoot is set.
+func (r *Reader) v1Stats(paths map[string]ControllerPath, ignoreRoot bool) (*StatsV1, error) {
 	stats := StatsV1{}
-	stats.Path, stats.ID = getCommonCgroupMetadata(paths.V1, r.ignoreRootCgroups)
+	stats.Path, stats.ID = getCommonCgroupMetadata(paths, ignoreRoot)
 	stats.Version = CgroupsV1
-	for conName, cgPath := range paths.V1 {
-		if r.ignoreRootCgroups && (cgPath.ControllerPath == "/" && r.cgroupsHierarchyOverride != cgPath.ControllerPath) {
+	for conName, cgPath := range paths {
+		if ignoreRoot && (cgPath.ControllerPath == "/" && r.cgroupsHierarchyOverride != cgPath.ControllerPath) {
 			continue
 		}
-		err := getStatsV1(cgPath, conName, &stats)
+		err := getStatsV1(r.cache, cgPath, conName, &stats)
 		if err != nil {
 			return nil, fmt.Errorf("error fetching stats for controller %s: %w", conName, err)
 		}
+		if r.includePath {
+			if stats.Paths == nil {
+				stats.Paths = map[string]string{}
+			}
+			stats.Paths[conName] = cgPath.FullPath
+		}
 	}
 
 	return &stats, nil
 }
 
-// GetV2StatsForProcess returns cgroup metrics and limits associated with a process.
-func (r *Reader) GetV2StatsForProcess(pid int) (*StatsV2, error) { //nolint: dupl // return value is different
-	// Read /proc/[pid]/cgroup to get the paths to the cgroup metrics.
-	paths, err := r.ProcessCgroupPaths(pid)
-	if err != nil {
-		return nil, err
-	}
+// v2Stats reads the stats of the given V2 controllers, skipping those in the root cgroup if ignoreRoot is set.
+func (r *Reader) v2Stats(paths map[string]ControllerPath, ignoreRoot bool) (*StatsV2, error) {
 	stats := StatsV2{}
-	stats.Path, stats.ID = getCommonCgroupMetadata(paths.V2, r.ignoreRootCgroups)
+	stats.Path, stats.ID = getCommonCgroupMetadata(paths, ignoreRoot)
 	stats.Version = CgroupsV2
-	for conName, cgPath := range paths.V2 {
-		if r.ignoreRootCgroups && (cgPath.ControllerPath == "/" && r.cgroupsHierarchyOverride != cgPath.ControllerPath) {
+	for conName, cgPath := range paths {
+		if ignoreRoot && (cgPath.ControllerPath == "/" && r.cgroupsHierarchyOverride != cgPath.ControllerPath) {
 			continue
 		}
-		err := getStatsV2(cgPath, conName, &stats)
+		err := getStatsV2(r.cache, cgPath, conName, &stats)
 		if err != nil {
 			return nil, fmt.Errorf("error fetching stats for controller %s: %w", conName, err)
 		}
+		if r.includePath {
+			if stats.Paths == nil {
+				stats.Paths = map[string]string{}
+			}
+			stats.Paths[conName] = cgPath.FullPath
+		}
 	}
 	return &stats, nil
 }
 
+// isV2Root returns true if the controllers are all in the root of the unified hierarchy.
+// A V2 process is only ever in a single cgroup, so the controllers either all share the root path or none do.
+func (r *Reader) isV2Root(paths map[string]ControllerPath) bool {
+	if len(paths) == 0 || r.cgroupsHierarchyOverride == "/" {
+		return false
+	}
+	for _, cgPath := range paths {
+		if cgPath.ControllerPath != "/" {
+			return false
+		}
+	}
+	return true
+}
+
 // ProcessCgroupPaths is a wrapper around Reader.ProcessCgroupPaths for libraries that only need the slimmer functionality from
 // the gosigar cgroups code. This does not have the same function signature, and consumers still need to distinguish between v1 and v2 cgroups.
 func ProcessCgroupPaths(hostfs resolve.Resolver, pid int) (PathList, error) {
@@ -242,13 +420,13 @@ func ProcessCgroupPaths(hostfs resolve.Resolver, pid int) (PathList, error) {
 	return reader.ProcessCgroupPaths(pid)
 }
 
-func getStatsV2(path ControllerPath, name string, stats *StatsV2) error {
+func getStatsV2(cache *statsCache, path ControllerPath, name string, stats *StatsV2) error {
 	id := filepath.Base(path.ControllerPath)
 
 	switch name {
 	case cpuStat:
 		stats.CPU = &cgv2.CPUSubsystem{}
-		err := stats.CPU.Get(path.FullPath)
+		err := cache.fetch(path.FullPath, stats.CPU, stats.CPU.Get)
 		if err != nil {
 			return fmt.Errorf("error fetching CPU stats: %w", err)
 		}
@@ -256,7 +434,7 @@ func getStatsV2(path ControllerPath, name string, stats *StatsV2) error {
 		stats.CPU.Path = path.ControllerPath
 	case memoryStat:
 		stats.Memory = &cgv2.MemorySubsystem{}
-		err := stats.Memory.Get(path.FullPath)
+		err := cache.fetch(path.FullPath, stats.Memory, stats.Memory.Get)
 		if err != nil {
 			return fmt.Errorf("error fetching Memory stats: %w", err)
 		}
@@ -264,24 +442,34 @@ func getStatsV2(path ControllerPath, name string, stats *StatsV2) error {
 		stats.Memory.Path = path.ControllerPath
 	case ioStat:
 		stats.IO = &cgv2.IOSubsystem{}
-		err := stats.IO.Get(path.FullPath, true)
+		err := cache.fetch(path.FullPath, stats.IO, func(path string) error {
+			return stats.IO.Get(path, true)
+		})
 		if err != nil {
 			return fmt.Errorf("error fetching IO stats: %w", err)
 		}
 		stats.IO.ID = id
 		stats.IO.Path = path.ControllerPath
+	case hugetlbStat:
+		stats.HugeTLB = &cgv2.HugeTLBSubsystem{}
+		err := cache.fetch(path.FullPath, stats.HugeTLB, stats.HugeTLB.Get)
+		if err != nil {
+			return fmt.Errorf("error fetching hugetlb stats: %w", err)
+		}
+		stats.HugeTLB.ID = id
+		stats.HugeTLB.Path = path.ControllerPath
 	}
 
 	return nil
 }
 
-func getStatsV1(path ControllerPath, name string, stats *StatsV1) error {
+func getStatsV1(cache *statsCache, path ControllerPath, name string, stats *StatsV1) error {
 	id := filepath.Base(path.ControllerPath)
 
 	switch name {
 	case blkioStat:
 		stats.BlockIO = &cgv1.BlockIOSubsystem{}
-		err := stats.BlockIO.Get(path.FullPath)
+		err := cache.fetch(path.FullPath, stats.BlockIO, stats.BlockIO.Get)
 		if err != nil {
 			return fmt.Errorf("error fetching BlockIO stats: %w", err)
 		}
@@ -289,7 +477,7 @@ func getStatsV1(path ControllerPath, name string, stats *StatsV1) error {
 		stats.BlockIO.Path = path.ControllerPath
 	case cpuStat:
 		stats.CPU = &cgv1.CPUSubsystem{}
-		err := stats.CPU.Get(path.FullPath)
+		err := cache.fetch(path.FullPath, stats.CPU, stats.CPU.Get)
 		if err != nil {
 			return fmt.Errorf("error fetching cpu stats: %w", err)
 		}
@@ -297,7 +485,7 @@ func getStatsV1(path ControllerPath, name string, stats *StatsV1) error {
 		stats.CPU.Path = path.ControllerPath
 	case cpuAcctStat:
 		stats.CPUAccounting = &cgv1.CPUAccountingSubsystem{}
-		err := stats.CPUAccounting.Get(path.FullPath)
+		err := cache.fetch(path.FullPath, stats.CPUAccounting, stats.CPUAccounting.Get)
 		if err != nil {
 			return fmt.Errorf("error fetching cpuacct stats: %w", err)
 		}
@@ -305,12 +493,36 @@ func getStatsV1(path ControllerPath, name string, stats *StatsV1) error {
 		stats.CPUAccounting.Path = path.ControllerPath
 	case memoryStat:
 		stats.Memory = &cgv1.MemorySubsystem{}
-		err := stats.Memory.Get(path.FullPath)
+		err := cache.fetch(path.FullPath, stats.Memory, stats.Memory.Get)
 		if err != nil {
 			return fmt.Errorf("error fetching memory stats: %w", err)
 		}
 		stats.Memory.ID = id
 		stats.Memory.Path = path.ControllerPath
+	case hugetlbStat:
+		stats.HugeTLB = &cgv1.HugeTLBSubsystem{}
+		err := cache.fetch(path.FullPath, stats.HugeTLB, stats.HugeTLB.Get)
+		if err != nil {
+			return fmt.Errorf("error fetching hugetlb stats: %w", err)
+		}
+		stats.HugeTLB.ID = id
+		stats.HugeTLB.Path = path.ControllerPath
+	case netClsStat:
+		stats.NetCls = &cgv1.NetClsSubsystem{}
+		err := cache.fetch(path.FullPath, stats.NetCls, stats.NetCls.Get)
+		if err != nil {
+			return fmt.Errorf("error fetching net_cls stats: %w", err)
+		}
+		stats.NetCls.ID = id
+		stats.NetCls.Path = path.ControllerPath
+	case netPrioStat:
+		stats.NetPrio = &cgv1.NetPrioSubsystem{}
+		err := cache.fetch(path.FullPath, stats.NetPrio, stats.NetPrio.Get)
+		if err != nil {
+			return fmt.Errorf("error fetching net_prio stats: %w", err)
+		}
+		stats.NetPrio.ID = id
+		stats.NetPrio.Path = path.ControllerPath
 	}
 
 	return nil
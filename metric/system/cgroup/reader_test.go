@@ -21,10 +21,16 @@
 package cgroup
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 )
 
@@ -138,3 +144,245 @@ func TestReaderGetStatsHierarchyOverride(t *testing.T) {
 	require.NotNil(t, stats2.CPU, "no v2 cpu stats found")
 	require.NotZero(t, stats2.CPU.Stats.Usage.NS, "no v2 CPU usage stats")
 }
+
+func TestReaderIncludePath(t *testing.T) {
+	reader, err := NewReader(resolve.NewTestResolver("testdata/docker"), true)
+	require.NoError(t, err, "error in NewReader")
+
+	stats, err := reader.GetV1StatsForProcess(985)
+	require.NoError(t, err, "error in GetV1StatsForProcess")
+	require.Nil(t, stats.Paths)
+	formatted, err := stats.Format()
+	require.NoError(t, err)
+	require.NotContains(t, formatted, "paths")
+
+	reader, err = NewReaderOptions(ReaderOptions{
+		RootfsMountpoint:  resolve.NewTestResolver("testdata/docker"),
+		IgnoreRootCgroups: true,
+		IncludePath:       true,
+	})
+	require.NoError(t, err, "error in NewReaderOptions")
+
+	stats, err = reader.GetV1StatsForProcess(985)
+	require.NoError(t, err, "error in GetV1StatsForProcess")
+	require.Equal(t, "testdata/docker/sys/fs/cgroup/memory"+path, stats.Paths["memory"])
+	formatted, err = stats.Format()
+	require.NoError(t, err)
+	require.Equal(t, stats.Paths, formatted["paths"])
+
+	statsV2, err := reader.GetV2StatsForProcess(312)
+	require.NoError(t, err, "error in GetV2StatsForProcess")
+	require.Equal(t, "testdata/docker/sys/fs/cgroup"+pathv2, statsV2.Paths["cpu"])
+}
+
+func TestReaderVersion(t *testing.T) {
+	v1Mounts := []string{
+		"30 25 0:26 / %s/sys/fs/cgroup/memory rw,nosuid,nodev,noexec,relatime shared:11 - cgroup cgroup rw,memory",
+		"31 25 0:27 / %s/sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:12 - cgroup cgroup rw,cpu,cpuacct",
+	}
+	cases := map[CgroupsMode][]string{
+		CgroupsModeV1: v1Mounts,
+		CgroupsModeV2: {
+			"26 25 0:23 / %s/sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate",
+		},
+		CgroupsModeHybrid: append([]string{
+			"27 25 0:24 / %s/sys/fs/cgroup/unified rw,nosuid,nodev,noexec,relatime shared:5 - cgroup2 cgroup2 rw,nsdelegate",
+		}, v1Mounts...),
+		CgroupsModeUnknown: {
+			"22 1 8:1 / %s/ rw,relatime shared:1 - ext4 /dev/sda1 rw",
+		},
+	}
+
+	for mode, mounts := range cases {
+		t.Run(mode.String(), func(t *testing.T) {
+			root := t.TempDir()
+			lines := make([]string, 0, len(mounts))
+			for _, line := range mounts {
+				lines = append(lines, fmt.Sprintf(line, root))
+			}
+			require.NoError(t, os.MkdirAll(filepath.Join(root, "proc", "self"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "self", "mountinfo"), []byte(strings.Join(lines, "\n")), 0o644))
+			cgroups := "#subsys_name\thierarchy\tnum_cgroups\tenabled\ncpu\t3\t1\t1\ncpuacct\t3\t1\t1\nmemory\t2\t1\t1\n"
+			require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "cgroups"), []byte(cgroups), 0o644))
+
+			reader, err := NewReader(resolve.NewTestResolver(root), true)
+			require.NoError(t, err)
+			assert.Equal(t, mode, reader.Version())
+		})
+	}
+}
+
+func TestReaderIgnoreRootCgroupsV2(t *testing.T) {
+	root := t.TempDir()
+	cgroupRoot := filepath.Join(root, "sys", "fs", "cgroup")
+	files := map[string]string{
+		"proc/cgroups":           "#subsys_name\thierarchy\tnum_cgroups\tenabled\ncpu\t0\t1\t1\nmemory\t0\t1\t1\n",
+		"proc/self/mountinfo":    fmt.Sprintf("26 25 0:23 / %s rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate\n", cgroupRoot),
+		"proc/1/cgroup":          "0::/\n",
+		"sys/fs/cgroup/cpu.stat": "usage_usec 1000\n",
+	}
+	for name, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(contents), 0o644))
+	}
+
+	reader, err := NewReader(resolve.NewTestResolver(root), true)
+	require.NoError(t, err, "error in NewReader")
+
+	stats, err := reader.GetStatsForPid(1)
+	require.NoError(t, err, "error in GetStatsForPid")
+	require.Nil(t, stats, "root cgroup stats should be omitted")
+
+	// The host-wide stats are still available if root cgroups aren't ignored
+	reader, err = NewReader(resolve.NewTestResolver(root), false)
+	require.NoError(t, err, "error in NewReader")
+
+	stats, err = reader.GetStatsForPid(1)
+	require.NoError(t, err, "error in GetStatsForPid")
+	require.NotNil(t, stats)
+	require.NotNil(t, stats.(*StatsV2).CPU)
+}
+
+func TestReaderCacheStats(t *testing.T) {
+	root := t.TempDir()
+	cgroupRoot := filepath.Join(root, "sys", "fs", "cgroup")
+	files := map[string]string{
+		"proc/cgroups":                         "#subsys_name\thierarchy\tnum_cgroups\tenabled\nmemory\t0\t1\t1\n",
+		"proc/self/mountinfo":                  fmt.Sprintf("26 25 0:23 / %s rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate\n", cgroupRoot),
+		"proc/10/cgroup":                       "0::/test.slice\n",
+		"proc/11/cgroup":                       "0::/test.slice\n",
+		"sys/fs/cgroup/test.slice/memory.stat": "anon 100\n",
+	}
+	for name, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(contents), 0o644))
+	}
+	updateStat := func(contents string) {
+		require.NoError(t, os.WriteFile(filepath.Join(cgroupRoot, "test.slice", "memory.stat"), []byte(contents), 0o644))
+	}
+
+	reader, err := NewReaderOptions(ReaderOptions{
+		RootfsMountpoint: resolve.NewTestResolver(root),
+		CacheStats:       true,
+	})
+	require.NoError(t, err, "error in NewReaderOptions")
+
+	stats, err := reader.GetV2StatsForProcess(10)
+	require.NoError(t, err, "error in GetV2StatsForProcess")
+	require.Equal(t, uint64(100), stats.Memory.Stats.Anon.Bytes)
+
+	// The second process shares the cgroup, so memory.stat shouldn't be read again
+	updateStat("anon 200\n")
+	stats, err = reader.GetV2StatsForProcess(11)
+	require.NoError(t, err, "error in GetV2StatsForProcess")
+	require.Equal(t, uint64(100), stats.Memory.Stats.Anon.Bytes)
+	require.Equal(t, "test.slice", stats.Memory.ID)
+
+	reader.ResetCache()
+	stats, err = reader.GetV2StatsForProcess(11)
+	require.NoError(t, err, "error in GetV2StatsForProcess")
+	require.Equal(t, uint64(200), stats.Memory.Stats.Anon.Bytes)
+
+	// Without caching, every call reads the files
+	reader, err = NewReader(resolve.NewTestResolver(root), false)
+	require.NoError(t, err, "error in NewReader")
+	updateStat("anon 300\n")
+	stats, err = reader.GetV2StatsForProcess(10)
+	require.NoError(t, err, "error in GetV2StatsForProcess")
+	require.Equal(t, uint64(300), stats.Memory.Stats.Anon.Bytes)
+}
+
+func TestStatsCacheFetchUnlocked(t *testing.T) {
+	cache := newStatsCache()
+
+	// get is called without the lock held, so it can use the cache itself, and a reset while it runs
+	// keeps the stats it read out of the cache
+	var outer, inner uint64
+	err := cache.fetch("/outer", &outer, func(string) error {
+		require.NoError(t, cache.fetch("/inner", &inner, func(string) error {
+			inner = 1
+			return nil
+		}))
+		cache.reset()
+		outer = 2
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), outer)
+
+	err = cache.fetch("/outer", &outer, func(string) error {
+		outer = 3
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), outer)
+}
+
+func TestReaderLogger(t *testing.T) {
+	logger := logp.NewLogger("custom")
+	reader, err := NewReaderOptions(ReaderOptions{
+		RootfsMountpoint: resolve.NewTestResolver("testdata/docker"),
+		Logger:           logger,
+	})
+	require.NoError(t, err)
+	assert.Same(t, logger, reader.log())
+
+	reader, err = NewReader(resolve.NewTestResolver("testdata/docker"), true)
+	require.NoError(t, err)
+	assert.Same(t, logp.L(), reader.log())
+}
+
+func TestReaderGetStatsForPath(t *testing.T) {
+	root := t.TempDir()
+	cgroupRoot := filepath.Join(root, "sys", "fs", "cgroup")
+	files := map[string]string{
+		"proc/cgroups":                                      "#subsys_name\thierarchy\tnum_cgroups\tenabled\ncpu\t0\t1\t1\nmemory\t0\t1\t1\n",
+		"proc/self/mountinfo":                               fmt.Sprintf("26 25 0:23 / %s rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate\n", cgroupRoot),
+		"sys/fs/cgroup/cpu.stat":                            "usage_usec 1000\n",
+		"sys/fs/cgroup/test.slice/app.scope/cpu.stat":       "usage_usec 500\n",
+		"sys/fs/cgroup/test.slice/app.scope/memory.stat":    "anon 100\n",
+		"sys/fs/cgroup/test.slice/empty.scope/cgroup.procs": "",
+	}
+	for name, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(contents), 0o644))
+	}
+
+	// No process is in the cgroup, so its stats can only be found from the path
+	reader, err := NewReader(resolve.NewTestResolver(root), true)
+	require.NoError(t, err, "error in NewReader")
+
+	stats, err := reader.GetStatsForPath("/test.slice/app.scope")
+	require.NoError(t, err, "error in GetStatsForPath")
+	v2, ok := stats.(*StatsV2)
+	require.True(t, ok, "expected V2 stats, got %T", stats)
+	require.Equal(t, "/test.slice/app.scope", v2.Path)
+	require.Equal(t, "app.scope", v2.ID)
+	require.NotNil(t, v2.CPU)
+	require.Equal(t, uint64(100), v2.Memory.Stats.Anon.Bytes)
+
+	// The root cgroup is read when it's asked for, even if root cgroups are ignored
+	stats, err = reader.GetStatsForPath("/")
+	require.NoError(t, err, "error in GetStatsForPath")
+	require.Equal(t, "/", stats.(*StatsV2).Path)
+	require.NotNil(t, stats.(*StatsV2).CPU)
+	require.Nil(t, stats.(*StatsV2).Memory)
+
+	_, err = reader.GetStatsForPath("/test.slice/empty.scope")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = reader.GetStatsForPath("/test.slice/missing.scope")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// V1 controllers are read from each subsystem's mountpoint
+	reader, err = NewReader(resolve.NewTestResolver("testdata/docker"), true)
+	require.NoError(t, err, "error in NewReader")
+	stats, err = reader.GetStatsForPath(path)
+	require.NoError(t, err, "error in GetStatsForPath")
+	v1, ok := stats.(*StatsV1)
+	require.True(t, ok, "expected V1 stats, got %T", stats)
+	require.Equal(t, path, v1.Path)
+	require.Equal(t, id, v1.ID)
+	require.NotNil(t, v1.CPU)
+	require.NotNil(t, v1.Memory)
+	require.NotZero(t, v1.Memory.Mem.Usage.Bytes)
+}
@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cgroup
+
+import (
+	"strings"
+)
+
+// runtimeMarkers map the cgroup path components created by each container runtime onto the runtime's name.
+// They're checked in order, so a runtime's own marker takes precedence over the kubepods hierarchy it's nested in.
+var runtimeMarkers = []struct {
+	prefix  string
+	runtime string
+}{
+	{"docker", "docker"},
+	{"cri-containerd", "containerd"},
+	{"crio", "cri-o"},
+	{"libpod", "podman"},
+	{"nerdctl", "containerd"},
+	{"kubepods", "kubepods"},
+}
+
+// ContainerRuntime classifies the container runtime that created a cgroup from the shape of its path,
+// such as /docker/<id> or /kubepods.slice/.../cri-containerd-<id>.scope.
+// It returns one of docker, containerd, cri-o, podman or kubepods, or an empty string if the path isn't a container's.
+// kubepods is returned for kubernetes pods whose runtime can't be told from the path, such as with the cgroupfs driver.
+func ContainerRuntime(path string) string {
+	components := strings.Split(path, "/")
+	for _, marker := range runtimeMarkers {
+		for _, component := range components {
+			// the runtime daemons themselves, such as docker.service, run on the host
+			if strings.HasSuffix(component, ".service") {
+				continue
+			}
+			if strings.HasPrefix(component, marker.prefix) {
+				return marker.runtime
+			}
+		}
+	}
+	return ""
+}
+
+// runtimePrefixes are the prefixes the runtimes give the cgroup of a container, ahead of the container ID
+var runtimePrefixes = []string{"docker-", "cri-containerd-", "crio-", "libpod-", "nerdctl-"}
+
+// ContainerID returns the ID of the container that created a cgroup, from the last component of its path.
+// This is the 64 character hex ID used by docker, containerd, cri-o and podman; other paths return an empty string.
+func ContainerID(path string) string {
+	id := strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], ".scope")
+	for _, prefix := range runtimePrefixes {
+		if strings.HasPrefix(id, prefix) {
+			id = strings.TrimPrefix(id, prefix)
+			break
+		}
+	}
+	if len(id) != 64 || strings.Trim(id, "0123456789abcdef") != "" {
+		return ""
+	}
+	return id
+}
+
+// PodUID returns the UID of the kubernetes pod a cgroup belongs to, or an empty string if it isn't part of a pod.
+// The kubelet puts pods in a QoS class hierarchy, such as kubepods/burstable/pod<uid> with the cgroupfs driver,
+// or kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice with the systemd driver.
+// Guaranteed pods are directly under kubepods. The systemd driver escapes the dashes in the UID as underscores.
+func PodUID(path string) string {
+	if !strings.Contains(path, "kubepods") {
+		return ""
+	}
+	for _, component := range strings.Split(path, "/") {
+		component = strings.TrimSuffix(component, ".slice")
+		// the pod is either the whole component, or the last part of a systemd slice name.
+		// kubepods, kubepods-burstable and the like are the QoS slices, not pods
+		idx := strings.LastIndex(component, "pod")
+		if idx < 0 || (idx > 0 && component[idx-1] != '-') || strings.HasPrefix(component[idx:], "pods") {
+			continue
+		}
+		return strings.ReplaceAll(component[idx+3:], "_", "-")
+	}
+	return ""
+}
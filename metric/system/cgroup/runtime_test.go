@@ -0,0 +1,96 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cgroup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerRuntime(t *testing.T) {
+	id := "b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+	pod := "pod5bb4a2ca-3ab2-4c4e-9b9b-2c5f0e2c7c1d"
+	cases := map[string]string{
+		// docker, with the cgroupfs and systemd drivers
+		"/docker/" + id:                         "docker",
+		"/system.slice/docker-" + id + ".scope": "docker",
+		// dockershim pods report the runtime rather than kubepods
+		"/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-" + pod + ".slice/docker-" + id + ".scope": "docker",
+		// containerd in kubernetes, and on its own with nerdctl
+		"/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-" + pod + ".slice/cri-containerd-" + id + ".scope": "containerd",
+		"/system.slice/nerdctl-" + id + ".scope": "containerd",
+		// cri-o
+		"/kubepods.slice/kubepods-" + pod + ".slice/crio-" + id + ".scope": "cri-o",
+		"/kubepods/burstable/" + pod + "/crio-" + id:                       "cri-o",
+		// podman, rootful and rootless
+		"/machine.slice/libpod-" + id + ".scope":                                           "podman",
+		"/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + id + ".scope": "podman",
+		"/libpod_parent/libpod-" + id:                                                      "podman",
+		// the kubelet's cgroupfs driver doesn't name the runtime
+		"/kubepods/burstable/" + pod + "/" + id: "kubepods",
+		// host processes, including the runtime daemons
+		"/": "",
+		"":  "",
+		"/user.slice/user-1000.slice/session-2.scope": "",
+		"/system.slice/sshd.service":                  "",
+		"/system.slice/docker.service":                "",
+		"/system.slice/containerd.service":            "",
+		"/system.slice/crio.service":                  "",
+	}
+	for path, runtime := range cases {
+		assert.Equal(t, runtime, ContainerRuntime(path), path)
+	}
+}
+
+func TestPodUIDAndContainerID(t *testing.T) {
+	id := "b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242"
+	uid := "5bb4a2ca-3ab2-4c4e-9b9b-2c5f0e2c7c1d"
+	systemdUID := strings.ReplaceAll(uid, "-", "_")
+	cases := []struct {
+		path        string
+		podUID      string
+		containerID string
+	}{
+		// systemd driver, for each QoS class
+		{path: "/kubepods.slice/kubepods-pod" + systemdUID + ".slice/cri-containerd-" + id + ".scope", podUID: uid, containerID: id},
+		{path: "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + systemdUID + ".slice/crio-" + id + ".scope", podUID: uid, containerID: id},
+		{path: "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod" + systemdUID + ".slice/docker-" + id + ".scope", podUID: uid, containerID: id},
+		// cgroupfs driver, for each QoS class
+		{path: "/kubepods/pod" + uid + "/" + id, podUID: uid, containerID: id},
+		{path: "/kubepods/burstable/pod" + uid + "/" + id, podUID: uid, containerID: id},
+		{path: "/kubepods/besteffort/pod" + uid + "/crio-" + id, podUID: uid, containerID: id},
+		// the pod's own cgroup, and the QoS slices
+		{path: "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + systemdUID + ".slice", podUID: uid},
+		{path: "/kubepods.slice/kubepods-burstable.slice"},
+		{path: "/kubepods"},
+		// crio's conmon runs in a cgroup of its own, alongside the container
+		{path: "/kubepods.slice/kubepods-pod" + systemdUID + ".slice/crio-conmon-" + id + ".scope", podUID: uid},
+		// containers outside kubernetes
+		{path: "/docker/" + id, containerID: id},
+		{path: "/machine.slice/libpod-" + id + ".scope", containerID: id},
+		// host processes
+		{path: "/"},
+		{path: "/user.slice/user-1000.slice/session-2.scope"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.podUID, PodUID(tc.path), tc.path)
+		assert.Equal(t, tc.containerID, ContainerID(tc.path), tc.path)
+	}
+}
@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cgroup
+
+import (
+	"reflect"
+	"sync"
+)
+
+// statsCache holds the controller stats that have already been read in a collection cycle,
+// so processes that share a cgroup don't read the same controller files again.
+type statsCache struct {
+	mut     sync.Mutex
+	entries map[statsCacheKey]reflect.Value
+	// gen is bumped on every reset, so stats read before a reset aren't cached after it
+	gen uint64
+}
+
+// statsCacheKey identifies a controller by its stats type, which is unique to each controller and cgroup version, and its path.
+type statsCacheKey struct {
+	kind reflect.Type
+	path string
+}
+
+func newStatsCache() *statsCache {
+	return &statsCache{entries: map[statsCacheKey]reflect.Value{}}
+}
+
+// fetch fills dst, a pointer to a controller's stats, with the cached stats for path.
+// If they aren't cached, get is called to read them, without holding the lock, so a slow read doesn't block
+// the lookups of other paths. A nil cache always calls get.
+func (cache *statsCache) fetch(path string, dst interface{}, get func(string) error) error {
+	if cache == nil {
+		return get(path)
+	}
+
+	dstVal := reflect.ValueOf(dst).Elem()
+	key := statsCacheKey{kind: dstVal.Type(), path: path}
+
+	cache.mut.Lock()
+	cached, ok := cache.entries[key]
+	gen := cache.gen
+	cache.mut.Unlock()
+	if ok {
+		dstVal.Set(cached)
+		return nil
+	}
+
+	if err := get(path); err != nil {
+		return err
+	}
+	// store a copy, as callers set the ID and path, and fill in percentages, on the returned stats
+	cached = reflect.New(dstVal.Type()).Elem()
+	cached.Set(dstVal)
+	cache.mut.Lock()
+	defer cache.mut.Unlock()
+	if cache.gen == gen {
+		cache.entries[key] = cached
+	}
+	return nil
+}
+
+// reset drops all the cached stats
+func (cache *statsCache) reset() {
+	if cache == nil {
+		return
+	}
+	cache.mut.Lock()
+	defer cache.mut.Unlock()
+	cache.entries = map[statsCacheKey]reflect.Value{}
+	cache.gen++
+}
@@ -27,7 +27,6 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 )
 
@@ -267,7 +266,7 @@ func (r Reader) ProcessCgroupPaths(pid int) (PathList, error) {
 			// If it's not set, warn the user that they've hit this.
 			controllerPath := filepath.Join(r.cgroupMountpoints.V2Loc, path)
 			if r.cgroupMountpoints.V2Loc == "" && !r.rootfsMountpoint.IsSet() {
-				logp.L().Debugf(`PID %d contains a cgroups V2 path (%s) but no V2 mountpoint was found.
+				r.log().Debugf(`PID %d contains a cgroups V2 path (%s) but no V2 mountpoint was found.
 This may be because metricbeat is running inside a container on a hybrid system.
 To monitor cgroups V2 processess in this way, mount the unified (V2) hierarchy inside
 the container as /sys/fs/cgroup/unified and start the system module with the hostfs setting.`, pid, line)
@@ -276,18 +275,10 @@ the container as /sys/fs/cgroup/unified and start the system module with the hos
 				controllerPath = r.rootfsMountpoint.ResolveHostFS(filepath.Join("/sys/fs/cgroup/unified", path))
 			}
 
-			cgpaths, err := ioutil.ReadDir(controllerPath)
+			err := addV2Controllers(cPaths.V2, path, controllerPath)
 			if err != nil {
 				return cPaths, fmt.Errorf("error fetching cgroupV2 controllers for cgroup location '%s' and path line '%s': %w", r.cgroupMountpoints.V2Loc, line, err)
 			}
-			// In order to produce the same kind of data for cgroups V1 and V2 controllers,
-			// We iterate over the group, and look for controllers, since the V2 unified system doesn't list them under the PID
-			for _, singlePath := range cgpaths {
-				if strings.Contains(singlePath.Name(), "stat") {
-					controllerName := strings.TrimSuffix(singlePath.Name(), ".stat")
-					cPaths.V2[controllerName] = ControllerPath{ControllerPath: path, FullPath: controllerPath, IsV2: true}
-				}
-			}
 			// cgroup v1
 		} else {
 			subsystems := strings.Split(fields[1], ",")
@@ -304,3 +295,42 @@ the container as /sys/fs/cgroup/unified and start the system module with the hos
 
 	return cPaths, nil
 }
+
+// addV2Controllers adds the controllers found in the V2 cgroup directory at controllerPath to paths.
+func addV2Controllers(paths map[string]ControllerPath, path, controllerPath string) error {
+	cgpaths, err := ioutil.ReadDir(controllerPath)
+	if err != nil {
+		return err
+	}
+	// In order to produce the same kind of data for cgroups V1 and V2 controllers,
+	// We iterate over the group, and look for controllers, since the V2 unified system doesn't list them under the PID
+	for _, singlePath := range cgpaths {
+		// hugetlb has no stat file, only per-page-size files like hugetlb.2MB.current
+		if strings.HasPrefix(singlePath.Name(), hugetlbStat+".") {
+			paths[hugetlbStat] = ControllerPath{ControllerPath: path, FullPath: controllerPath, IsV2: true}
+		} else if strings.Contains(singlePath.Name(), "stat") {
+			controllerName := strings.TrimSuffix(singlePath.Name(), ".stat")
+			paths[controllerName] = ControllerPath{ControllerPath: path, FullPath: controllerPath, IsV2: true}
+		}
+	}
+	return nil
+}
+
+// ControllerPaths returns the path of each cgroup controller a process is attached to, relative to the controller's mountpoint.
+// This only reads /proc/[pid]/cgroup and the controller lists, not any metrics.
+// On hybrid systems, a controller attached in both hierarchies reports its V1 path, as the V1 controller is the one in use.
+func (r Reader) ControllerPaths(pid int) (map[string]string, error) {
+	paths, err := r.ProcessCgroupPaths(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	controllers := make(map[string]string, len(paths.V1)+len(paths.V2))
+	for name, path := range paths.V2 {
+		controllers[name] = path.ControllerPath
+	}
+	for name, path := range paths.V1 {
+		controllers[name] = path.ControllerPath
+	}
+	return controllers, nil
+}
@@ -27,9 +27,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 )
@@ -213,6 +215,36 @@ func TestProcessCgroupPathsV2(t *testing.T) {
 	assert.Equal(t, "testdata/docker/sys/fs/cgroup/system.slice/docker-1c8fa019edd4b9d4b2856f4932c55929c5c118c808ed5faee9a135ca6e84b039.scope", paths.V2["memory"].FullPath)
 }
 
+func TestControllerPaths(t *testing.T) {
+	reader, err := NewReader(resolve.NewTestResolver("testdata/docker"), false)
+	require.NoError(t, err, "error in NewReader")
+
+	paths, err := reader.ControllerPaths(985)
+	require.NoError(t, err, "error in ControllerPaths")
+	assert.Len(t, paths, 10)
+	assert.Equal(t, "/docker/b29faf21b7eff959f64b4192c34d5d67a707fe8561e9eaa608cb27693fba4242", paths["memory"])
+
+	paths, err = reader.ControllerPaths(312)
+	require.NoError(t, err, "error in ControllerPaths")
+	assert.Equal(t, "/system.slice/docker-1c8fa019edd4b9d4b2856f4932c55929c5c118c808ed5faee9a135ca6e84b039.scope", paths["memory"])
+	assert.Equal(t, "/system.slice/docker-1c8fa019edd4b9d4b2856f4932c55929c5c118c808ed5faee9a135ca6e84b039.scope", paths["io"])
+}
+
+func TestControllerPathsSelf(t *testing.T) {
+	reader, err := NewReader(resolve.NewTestResolver(""), false)
+	if errors.Is(err, ErrCgroupsMissing) {
+		t.Skip("cgroups not supported on this host")
+	}
+	require.NoError(t, err, "error in NewReader")
+
+	paths, err := reader.ControllerPaths(os.Getpid())
+	require.NoError(t, err, "error in ControllerPaths")
+	require.NotEmpty(t, paths)
+	for name, path := range paths {
+		assert.True(t, strings.HasPrefix(path, "/"), "controller %s has a relative path %s", name, path)
+	}
+}
+
 func assertContains(t testing.TB, m map[string]struct{}, key string) {
 	_, contains := m[key]
 	if !contains {
@@ -77,6 +77,24 @@ func returnOrFix32BitRollover(current, prev uint64) uint64 {
 
 }
 
+// ioCountersDelta returns the change in each counter between two samples of a device.
+// The counters that are unsigned long in the kernel, and so 32-bit on 32-bit kernels, are corrected for rollover.
+func ioCountersDelta(counter, last disk.IOCountersStat) disk.IOCountersStat {
+	return disk.IOCountersStat{
+		Name:             counter.Name,
+		ReadCount:        returnOrFix32BitRollover(counter.ReadCount, last.ReadCount),
+		MergedReadCount:  returnOrFix32BitRollover(counter.MergedReadCount, last.MergedReadCount),
+		ReadBytes:        counter.ReadBytes - last.ReadBytes,
+		ReadTime:         returnOrFix32BitRollover(counter.ReadTime, last.ReadTime),
+		WriteCount:       returnOrFix32BitRollover(counter.WriteCount, last.WriteCount),
+		MergedWriteCount: returnOrFix32BitRollover(counter.MergedWriteCount, last.MergedWriteCount),
+		WriteBytes:       counter.WriteBytes - last.WriteBytes,
+		WriteTime:        returnOrFix32BitRollover(counter.WriteTime, last.WriteTime),
+		IoTime:           returnOrFix32BitRollover(counter.IoTime, last.IoTime),
+		WeightedIO:       returnOrFix32BitRollover(counter.WeightedIO, last.WeightedIO),
+	}
+}
+
 // CalcIOStatistics calculates IO statistics.
 func (stat *IOStat) CalcIOStatistics(counter disk.IOCountersStat) (IOMetric, error) {
 	var last disk.IOCountersStat
@@ -94,16 +112,10 @@ func (stat *IOStat) CalcIOStatistics(counter disk.IOCountersStat) (IOMetric, err
 		return IOMetric{}, errors.New("the delta cpu time between close sampling and open sampling is less or equal to 0")
 	}
 
-	rdIOs := counter.ReadCount - last.ReadCount
-	rdMerges := counter.MergedReadCount - last.MergedReadCount
-	rdBytes := counter.ReadBytes - last.ReadBytes
-	rdTicks := returnOrFix32BitRollover(counter.ReadTime, last.ReadTime)
-	wrIOs := counter.WriteCount - last.WriteCount
-	wrMerges := counter.MergedWriteCount - last.MergedWriteCount
-	wrBytes := counter.WriteBytes - last.WriteBytes
-	wrTicks := returnOrFix32BitRollover(counter.WriteTime, last.WriteTime)
-	ticks := returnOrFix32BitRollover(counter.IoTime, last.IoTime)
-	aveq := returnOrFix32BitRollover(counter.WeightedIO, last.WeightedIO)
+	delta := ioCountersDelta(counter, last)
+	rdIOs, rdMerges, rdBytes, rdTicks := delta.ReadCount, delta.MergedReadCount, delta.ReadBytes, delta.ReadTime
+	wrIOs, wrMerges, wrBytes, wrTicks := delta.WriteCount, delta.MergedWriteCount, delta.WriteBytes, delta.WriteTime
+	ticks, aveq := delta.IoTime, delta.WeightedIO
 
 	nIOs := rdIOs + wrIOs
 	nTicks := rdTicks + wrTicks
@@ -0,0 +1,258 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package diskio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// DiskStat holds the raw counters for a single device from /proc/diskstats.
+// Times are in milliseconds. See https://docs.kernel.org/admin-guide/iostats.html
+type DiskStat struct {
+	Major           uint64 `struct:"major"`
+	Minor           uint64 `struct:"minor"`
+	Name            string `struct:"name"`
+	ReadsCompleted  uint64 `struct:"reads_completed"`
+	ReadsMerged     uint64 `struct:"reads_merged"`
+	ReadSectors     uint64 `struct:"read_sectors"`
+	ReadTime        uint64 `struct:"read_time"`
+	WritesCompleted uint64 `struct:"writes_completed"`
+	WritesMerged    uint64 `struct:"writes_merged"`
+	WriteSectors    uint64 `struct:"write_sectors"`
+	WriteTime       uint64 `struct:"write_time"`
+	IOInProgress    uint64 `struct:"io_in_progress"`
+	IOTime          uint64 `struct:"io_time"`
+	WeightedIOTime  uint64 `struct:"weighted_io_time"`
+}
+
+// sectorSize is the unit of the sector counters in /proc/diskstats, whatever the sector size of the device
+const sectorSize = 512
+
+// DiskStatOptions holds options for GetDiskStats
+type DiskStatOptions struct {
+	// IncludePartitions reports partitions as well as whole disks.
+	IncludePartitions bool
+}
+
+// DiskRates holds the per-second and per-operation values derived from two DiskStat samples
+type DiskRates struct {
+	ReadIOPS   float64 `struct:"read_iops"`
+	WriteIOPS  float64 `struct:"write_iops"`
+	ReadAwait  float64 `struct:"read_await"`
+	WriteAwait float64 `struct:"write_await"`
+	Await      float64 `struct:"await"`
+	// UtilPct is the fraction of time the device was busy, from 0 to 1
+	UtilPct float64 `struct:"util_pct"`
+	// AvgQueueSize is the average number of requests in flight
+	AvgQueueSize float64 `struct:"avg_queue_size"`
+}
+
+// DiskStatSample is a single device in the result of DiskStatSampler.Sample
+type DiskStatSample struct {
+	Stats DiskStat `struct:"stats"`
+	// Rates is nil on the first sample of a device
+	Rates *DiskRates `struct:"rates,omitempty"`
+}
+
+// DiskStatSampler retains the previous sample for each device, so rates and utilization can be derived across calls to Sample.
+type DiskStatSampler struct {
+	hostfs   resolve.Resolver
+	opts     DiskStatOptions
+	last     map[string]DiskStat
+	lastTime time.Time
+	now      func() time.Time
+}
+
+// GetDiskStats returns the counters from /proc/diskstats, keyed by device name.
+// Partitions are skipped unless opts.IncludePartitions is set.
+func GetDiskStats(hostfs resolve.Resolver, opts DiskStatOptions) (map[string]DiskStat, error) {
+	path := resolve.ProcPath(hostfs, "diskstats")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	stats, err := parseDiskStats(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	if !opts.IncludePartitions {
+		for name := range stats {
+			if isPartition(hostfs, name) {
+				delete(stats, name)
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// NewDiskStatSampler returns a new DiskStatSampler
+func NewDiskStatSampler(hostfs resolve.Resolver, opts DiskStatOptions) *DiskStatSampler {
+	return &DiskStatSampler{
+		hostfs: hostfs,
+		opts:   opts,
+		last:   map[string]DiskStat{},
+		now:    time.Now,
+	}
+}
+
+// Sample fetches the current disk stats, and derives rates against the previous sample for each device.
+// Devices that weren't present in the previous sample won't have rates.
+func (sampler *DiskStatSampler) Sample() (map[string]DiskStatSample, error) {
+	stats, err := GetDiskStats(sampler.hostfs, sampler.opts)
+	if err != nil {
+		return nil, err
+	}
+	sampleTime := sampler.now()
+	elapsed := sampleTime.Sub(sampler.lastTime)
+
+	samples := make(map[string]DiskStatSample, len(stats))
+	for name, stat := range stats {
+		sample := DiskStatSample{Stats: stat}
+		if prev, ok := sampler.last[name]; ok {
+			rates := stat.Rates(prev, elapsed)
+			sample.Rates = &rates
+		}
+		samples[name] = sample
+	}
+
+	// replacing the map also drops devices that have been removed
+	sampler.last = stats
+	sampler.lastTime = sampleTime
+	return samples, nil
+}
+
+// Rates returns the IOPS, await times and utilization between a previous sample and the current one.
+// elapsed should be the wall-clock time between the two samples.
+func (cur DiskStat) Rates(prev DiskStat, elapsed time.Duration) DiskRates {
+	rates := DiskRates{}
+	if elapsed <= 0 {
+		return rates
+	}
+
+	delta := ioCountersDelta(cur.ioCounters(), prev.ioCounters())
+	reads, writes := delta.ReadCount, delta.WriteCount
+	readTime, writeTime := delta.ReadTime, delta.WriteTime
+
+	rates.ReadIOPS = metric.Round(float64(reads) / elapsed.Seconds())
+	rates.WriteIOPS = metric.Round(float64(writes) / elapsed.Seconds())
+	if reads > 0 {
+		rates.ReadAwait = metric.Round(float64(readTime) / float64(reads))
+	}
+	if writes > 0 {
+		rates.WriteAwait = metric.Round(float64(writeTime) / float64(writes))
+	}
+	if reads+writes > 0 {
+		rates.Await = metric.Round(float64(readTime+writeTime) / float64(reads+writes))
+	}
+
+	// not elapsed.Milliseconds(), which truncates intervals under a millisecond to zero
+	elapsedMs := elapsed.Seconds() * 1000
+	rates.UtilPct = metric.Round(float64(delta.IoTime) / elapsedMs)
+	// Kernel accounting and wall-clock time won't line up exactly
+	if rates.UtilPct > 1 {
+		rates.UtilPct = 1
+	}
+	rates.AvgQueueSize = metric.Round(float64(delta.WeightedIO) / elapsedMs)
+
+	return rates
+}
+
+// ioCounters returns the counters of stat in the form CalcIOStatistics uses
+func (stat DiskStat) ioCounters() disk.IOCountersStat {
+	return disk.IOCountersStat{
+		Name:             stat.Name,
+		ReadCount:        stat.ReadsCompleted,
+		MergedReadCount:  stat.ReadsMerged,
+		ReadBytes:        stat.ReadSectors * sectorSize,
+		ReadTime:         stat.ReadTime,
+		WriteCount:       stat.WritesCompleted,
+		MergedWriteCount: stat.WritesMerged,
+		WriteBytes:       stat.WriteSectors * sectorSize,
+		WriteTime:        stat.WriteTime,
+		IopsInProgress:   stat.IOInProgress,
+		IoTime:           stat.IOTime,
+		WeightedIO:       stat.WeightedIOTime,
+	}
+}
+
+func parseDiskStats(raw string) (map[string]DiskStat, error) {
+	stats := map[string]DiskStat{}
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		// Newer kernels add discard and flush counters, which we don't report
+		if len(fields) < 14 {
+			return nil, fmt.Errorf("expected at least 14 fields, got %d in line '%s'", len(fields), line)
+		}
+
+		values := make([]uint64, 14)
+		for i, field := range fields[:14] {
+			if i == 2 {
+				continue
+			}
+			val, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing field %d for device %s: %w", i, fields[2], err)
+			}
+			values[i] = val
+		}
+
+		stats[fields[2]] = DiskStat{
+			Major:           values[0],
+			Minor:           values[1],
+			Name:            fields[2],
+			ReadsCompleted:  values[3],
+			ReadsMerged:     values[4],
+			ReadSectors:     values[5],
+			ReadTime:        values[6],
+			WritesCompleted: values[7],
+			WritesMerged:    values[8],
+			WriteSectors:    values[9],
+			WriteTime:       values[10],
+			IOInProgress:    values[11],
+			IOTime:          values[12],
+			WeightedIOTime:  values[13],
+		}
+	}
+
+	return stats, nil
+}
+
+// isPartition uses the `partition` file in sysfs, which only exists for partitions and not whole disks
+func isPartition(hostfs resolve.Resolver, name string) bool {
+	_, err := os.Stat(hostfs.ResolveHostFS(filepath.Join("/sys/class/block", name, "partition")))
+	return err == nil
+}
@@ -0,0 +1,121 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration && linux
+// +build !integration,linux
+
+package diskio
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetDiskStats(t *testing.T) {
+	stats, err := GetDiskStats(resolve.NewTestResolver("./testdata"), DiskStatOptions{})
+	require.NoError(t, err)
+	require.Len(t, stats, 3)
+	assert.NotContains(t, stats, "sda1")
+	assert.NotContains(t, stats, "nvme0n1p1")
+
+	sda := stats["sda"]
+	assert.Equal(t, uint64(8), sda.Major)
+	assert.Equal(t, uint64(128459), sda.ReadsCompleted)
+	assert.Equal(t, uint64(9183474), sda.ReadSectors)
+	assert.Equal(t, uint64(226366), sda.WritesCompleted)
+	assert.Equal(t, uint64(11412852), sda.WriteSectors)
+	assert.Equal(t, uint64(349624), sda.WeightedIOTime)
+
+	assert.Equal(t, uint64(2), stats["nvme0n1"].IOInProgress)
+	// older kernels, without discard counters
+	assert.Equal(t, uint64(0), stats["loop0"].ReadsCompleted)
+
+	withParts, err := GetDiskStats(resolve.NewTestResolver("./testdata"), DiskStatOptions{IncludePartitions: true})
+	require.NoError(t, err)
+	require.Len(t, withParts, 5)
+	assert.Equal(t, uint64(217940), withParts["sda1"].WritesCompleted)
+}
+
+func TestDiskStatRates(t *testing.T) {
+	prev := DiskStat{ReadsCompleted: 100, WritesCompleted: 200, ReadTime: 1000, WriteTime: 4000}
+	cur := DiskStat{ReadsCompleted: 300, WritesCompleted: 600, ReadTime: 1400, WriteTime: 6000}
+
+	rates := cur.Rates(prev, 2*time.Second)
+	assert.Equal(t, 100.0, rates.ReadIOPS)
+	assert.Equal(t, 200.0, rates.WriteIOPS)
+	assert.Equal(t, 2.0, rates.ReadAwait)
+	assert.Equal(t, 5.0, rates.WriteAwait)
+	assert.Equal(t, 4.0, rates.Await)
+
+	assert.Equal(t, DiskRates{}, cur.Rates(prev, 0))
+
+	// counters that are 32-bit on 32-bit kernels roll over
+	rolled := DiskStat{ReadsCompleted: 99, WritesCompleted: 199, ReadTime: 1400, WriteTime: 6000}
+	prev32 := DiskStat{ReadsCompleted: math.MaxUint32 - 101, WritesCompleted: math.MaxUint32 - 201, ReadTime: 1000, WriteTime: 4000}
+	rates = rolled.Rates(prev32, 2*time.Second)
+	assert.Equal(t, 100.0, rates.ReadIOPS)
+	assert.Equal(t, 200.0, rates.WriteIOPS)
+	assert.Equal(t, 2.0, rates.ReadAwait)
+	assert.Equal(t, 5.0, rates.WriteAwait)
+
+	// intervals under a millisecond still give finite rates
+	prev.IOTime, cur.IOTime = 10, 10
+	prev.WeightedIOTime, cur.WeightedIOTime = 20, 21
+	rates = cur.Rates(prev, 500*time.Microsecond)
+	assert.Equal(t, 0.0, rates.UtilPct)
+	assert.Equal(t, 2.0, rates.AvgQueueSize)
+}
+
+func TestDiskStatSampler(t *testing.T) {
+	root := t.TempDir()
+	procDir := filepath.Join(root, "proc")
+	require.NoError(t, os.Mkdir(procDir, 0o755))
+	writeStats := func(line string) {
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, "diskstats"), []byte(line), 0o600))
+	}
+
+	start := time.Now()
+	sampler := NewDiskStatSampler(resolve.NewTestResolver(root), DiskStatOptions{})
+	sampler.now = func() time.Time { return start }
+
+	writeStats("   8       0 sda 1000 0 8000 500 2000 0 16000 1500 0 10000 20000 0 0 0 0\n")
+	first, err := sampler.Sample()
+	require.NoError(t, err)
+	assert.Nil(t, first["sda"].Rates)
+
+	// 10 seconds later, the disk was busy for 2.5 of them, with a weighted io time of 7.5 seconds
+	sampler.now = func() time.Time { return start.Add(10 * time.Second) }
+	writeStats("   8       0 sda 1500 0 12000 1000 3000 0 24000 3500 0 12500 27500 0 0 0 0\n")
+	second, err := sampler.Sample()
+	require.NoError(t, err)
+	rates := second["sda"].Rates
+	require.NotNil(t, rates)
+
+	assert.True(t, rates.UtilPct >= 0 && rates.UtilPct <= 1)
+	assert.Equal(t, 0.25, rates.UtilPct)
+	assert.Equal(t, 0.75, rates.AvgQueueSize)
+	assert.Equal(t, 50.0, rates.ReadIOPS)
+	assert.Equal(t, 100.0, rates.WriteIOPS)
+}
@@ -42,12 +42,13 @@ type FSStat struct {
 	Options   string   `struct:"options,omitempty"`
 	Flags     opt.Uint `struct:"flags,omitempty"`
 	// metrics
-	Total     opt.Uint `struct:"total,omitempty"`
-	Free      opt.Uint `struct:"free,omitempty"`
-	Avail     opt.Uint `struct:"available,omitempty"`
-	Used      UsedVals `struct:"used,omitempty"`
-	Files     opt.Uint `struct:"files,omitempty"`
-	FreeFiles opt.Uint `struct:"free_files,omitempty"`
+	Total     opt.Uint     `struct:"total,omitempty"`
+	Free      opt.Uint     `struct:"free,omitempty"`
+	Avail     opt.Uint     `struct:"available,omitempty"`
+	Used      UsedVals     `struct:"used,omitempty"`
+	Files     opt.Uint     `struct:"files,omitempty"`
+	FreeFiles opt.Uint     `struct:"free_files,omitempty"`
+	UsedFiles UsedFileVals `struct:"used_files,omitempty"`
 }
 
 // UsedVals wraps the `used` disk metrics
@@ -61,6 +62,17 @@ func (u UsedVals) IsZero() bool {
 	return u.Pct.IsZero() && u.Bytes.IsZero()
 }
 
+// UsedFileVals wraps the `used_files` inode metrics
+type UsedFileVals struct {
+	Pct   opt.Float `struct:"pct,omitempty"`
+	Count opt.Uint  `struct:"count,omitempty"`
+}
+
+// IsZero implements the IsZero interface for go-structform
+func (u UsedFileVals) IsZero() bool {
+	return u.Pct.IsZero() && u.Count.IsZero()
+}
+
 var debugf = logp.MakeDebug("libbeat.filesystem")
 
 func getFSPath(hostfs resolve.Resolver) string {
@@ -99,10 +111,40 @@ func GetFilesystems(hostfs resolve.Resolver, filter func(FSStat) bool) ([]FSStat
 
 }
 
+// GetFilesystemsWithUsage returns the filtered list of filesystems from GetFilesystems, with usage metrics filled out.
+// Filesystems that return an error while fetching usage, such as a mount we don't have permission to stat, are skipped.
+func GetFilesystemsWithUsage(hostfs resolve.Resolver, filter func(FSStat) bool) ([]FSStat, error) {
+	fsList, err := GetFilesystems(hostfs, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	withUsage := make([]FSStat, 0, len(fsList))
+	for _, fs := range fsList {
+		err := fs.GetUsage()
+		if err != nil {
+			debugf("error fetching usage for filesystem %s, skipping: %s", fs.Directory, err)
+			continue
+		}
+		withUsage = append(withUsage, fs)
+	}
+
+	return withUsage, nil
+}
+
 // Fill out computed stats after the platform-specific code fetches metrics from the OS
 func (fs *FSStat) fillMetrics() {
 	fs.Used.Bytes = fs.Total.SubtractOrNone(fs.Free)
 
+	// inode metrics aren't available on all platforms
+	if fs.Files.Exists() && fs.FreeFiles.Exists() {
+		fs.UsedFiles.Count = fs.Files.SubtractOrNone(fs.FreeFiles)
+		if fs.Files.ValueOr(0) != 0 {
+			filePerc := float64(fs.UsedFiles.Count.ValueOr(0)) / float64(fs.Files.ValueOr(0))
+			fs.UsedFiles.Pct = opt.FloatWith(metric.Round(filePerc))
+		}
+	}
+
 	// I'm not sure why this does Used + avail instead of total, but I'm too afraid to change it
 	percTotal := fs.Used.Bytes.ValueOr(0) + fs.Avail.ValueOr(0)
 	if percTotal == 0 {
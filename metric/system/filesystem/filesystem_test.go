@@ -26,6 +26,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/opt"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 )
 
@@ -50,6 +51,59 @@ func TestFileSystemList(t *testing.T) {
 	}
 }
 
+func TestFileSystemListWithUsage(t *testing.T) {
+	_ = logp.DevelopmentSetup()
+	skipTypes := []string{"cdrom", "tracefs", "overlay", "fuse.lxcfs", "fuse.gvfsd-fuse", "nsfs", "squashfs", "vmhgfs"}
+	fss, err := GetFilesystemsWithUsage(resolve.NewTestResolver("/"), BuildFilterWithList(skipTypes))
+	assert.NoError(t, err)
+	assert.True(t, (len(fss) > 0))
+
+	for _, fs := range fss {
+		assert.True(t, fs.Total.Exists(), "filesystem=%#v", fs)
+	}
+}
+
+func TestFileSystemUsageTempDir(t *testing.T) {
+	fs := FSStat{Directory: t.TempDir()}
+	err := fs.GetUsage()
+	assert.NoError(t, err)
+
+	assert.True(t, fs.Total.ValueOr(0) > 0)
+	assert.True(t, fs.Free.Exists())
+	assert.True(t, fs.Avail.Exists())
+	assert.True(t, fs.Used.Pct.Exists())
+}
+
+func TestFileSystemInodeUsage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("inode metrics are not available on windows")
+	}
+	fs := FSStat{Directory: t.TempDir()}
+	err := fs.GetUsage()
+	assert.NoError(t, err)
+
+	assert.True(t, fs.UsedFiles.Count.Exists())
+	assert.Equal(t, fs.Files.ValueOr(0), fs.UsedFiles.Count.ValueOr(0)+fs.FreeFiles.ValueOr(0))
+}
+
+func TestFileSystemInodePercentage(t *testing.T) {
+	fs := FSStat{
+		Files:     opt.UintWith(1000),
+		FreeFiles: opt.UintWith(250),
+	}
+	fs.fillMetrics()
+	assert.Equal(t, uint64(750), fs.UsedFiles.Count.ValueOr(0))
+	assert.Equal(t, 0.75, fs.UsedFiles.Pct.ValueOr(0))
+
+	// filesystems such as btrfs report zero inodes
+	zero := FSStat{
+		Files:     opt.UintWith(0),
+		FreeFiles: opt.UintWith(0),
+	}
+	zero.fillMetrics()
+	assert.False(t, zero.UsedFiles.Pct.Exists())
+}
+
 func TestFileSystemListFiltering(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		// Windows doesn't like these unix paths, the OS-specific code in stdlib will return different results.
@@ -0,0 +1,49 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin || freebsd || netbsd || openbsd
+// +build darwin freebsd netbsd openbsd
+
+package host
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// BootTime returns the time the system was booted, from the kern.boottime sysctl.
+// The sysctl always describes the running kernel, so hostfs isn't used.
+func BootTime(_ resolve.Resolver) (time.Time, error) {
+	tv, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading kern.boottime: %w", err)
+	}
+	return time.Unix(tv.Unix()), nil
+}
+
+// Uptime returns the time since the system was booted
+func Uptime(hostfs resolve.Resolver) (time.Duration, error) {
+	bootTime, err := BootTime(hostfs)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(bootTime), nil
+}
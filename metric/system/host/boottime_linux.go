@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package host
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// BootTime returns the time the system was booted, from the btime line of /proc/stat
+func BootTime(hostfs resolve.Resolver) (time.Time, error) {
+	path := resolve.ProcPath(hostfs, "stat")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return parseBootTime(string(raw))
+}
+
+// Uptime returns the time since the system was booted, from /proc/uptime
+func Uptime(hostfs resolve.Resolver) (time.Duration, error) {
+	path := resolve.ProcPath(hostfs, "uptime")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return parseUptime(string(raw))
+}
+
+func parseBootTime(raw string) (time.Time, error) {
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "btime" {
+			continue
+		}
+		btime, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error parsing btime %s: %w", fields[1], err)
+		}
+		return time.Unix(btime, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("no btime line found")
+}
+
+// parseUptime reads the first value in /proc/uptime, which is the uptime in seconds.
+// The second value is the time spent idle, summed across all CPUs.
+func parseUptime(raw string) (time.Duration, error) {
+	fields := strings.Fields(raw)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty uptime")
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing uptime %s: %w", fields[0], err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
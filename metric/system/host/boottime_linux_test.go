@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestParseBootTime(t *testing.T) {
+	raw := "cpu  2255 34 2290 22625563 6290 127 456 0 0 0\nctxt 1990473\nbtime 1062191376\nprocesses 2915\n"
+	bootTime, err := parseBootTime(raw)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1062191376), bootTime.Unix())
+
+	_, err = parseBootTime("ctxt 1990473\n")
+	assert.Error(t, err)
+}
+
+func TestParseUptime(t *testing.T) {
+	uptime, err := parseUptime("350735.47 234388.90\n")
+	require.NoError(t, err)
+	assert.Equal(t, 350735470*time.Millisecond, uptime)
+}
+
+func TestBootTimeHostfs(t *testing.T) {
+	procRoot := filepath.Join(t.TempDir(), "hostproc")
+	require.NoError(t, os.MkdirAll(procRoot, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "stat"), []byte("ctxt 1990473\nbtime 1062191376\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "uptime"), []byte("350735.47 234388.90\n"), 0o644))
+	hostfs := resolve.NewTestResolverWithProc("/", procRoot)
+
+	bootTime, err := BootTime(hostfs)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1062191376), bootTime.Unix())
+
+	uptime, err := Uptime(hostfs)
+	require.NoError(t, err)
+	assert.Equal(t, 350735470*time.Millisecond, uptime)
+}
@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package host
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgcommon"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// SystemPressure holds the host-wide pressure stall information from /proc/pressure.
+// Each map is keyed by "some" and "full", the same way the pressure metrics of a cgroup are.
+// See https://docs.kernel.org/accounting/psi.html
+type SystemPressure struct {
+	CPU    map[string]cgcommon.Pressure `struct:"cpu,omitempty"`
+	Memory map[string]cgcommon.Pressure `struct:"memory,omitempty"`
+	IO     map[string]cgcommon.Pressure `struct:"io,omitempty"`
+}
+
+// GetPressure returns the host-wide pressure stall information, which doesn't need cgroups.
+// On kernels without PSI support, /proc/pressure doesn't exist, and the maps are left nil.
+func GetPressure(hostfs resolve.Resolver) (SystemPressure, error) {
+	pressure := SystemPressure{}
+	dir := resolve.ProcPath(hostfs, "pressure")
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return pressure, nil
+	}
+
+	for name, target := range map[string]*map[string]cgcommon.Pressure{
+		"cpu":    &pressure.CPU,
+		"memory": &pressure.Memory,
+		"io":     &pressure.IO,
+	} {
+		stats, err := cgcommon.GetPressure(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return pressure, fmt.Errorf("error fetching %s pressure: %w", name, err)
+		}
+		*target = stats
+	}
+
+	return pressure, nil
+}
@@ -0,0 +1,62 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetPressure(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "proc", "pressure")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	files := map[string]string{
+		"cpu":    "some avg10=1.50 avg60=0.75 avg300=0.20 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+		"memory": "some avg10=0.00 avg60=0.10 avg300=0.05 total=4242\nfull avg10=0.00 avg60=0.05 avg300=0.01 total=2121\n",
+		"io":     "some avg10=12.00 avg60=8.00 avg300=4.00 total=987654321\nfull avg10=10.00 avg60=6.00 avg300=3.00 total=876543210\n",
+	}
+	for name, contents := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644))
+	}
+
+	pressure, err := GetPressure(resolve.NewTestResolver(root))
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, pressure.CPU["some"].Ten.Pct)
+	assert.Equal(t, uint64(123456), pressure.CPU["some"].Total.ValueOr(0))
+	assert.Equal(t, uint64(2121), pressure.Memory["full"].Total.ValueOr(0))
+	assert.Equal(t, 6.0, pressure.IO["full"].Sixty.Pct)
+	assert.Equal(t, 3.0, pressure.IO["full"].ThreeHundred.Pct)
+}
+
+func TestGetPressureUnsupported(t *testing.T) {
+	pressure, err := GetPressure(resolve.NewTestResolver(t.TempDir()))
+	require.NoError(t, err)
+	assert.Nil(t, pressure.CPU)
+	assert.Nil(t, pressure.Memory)
+	assert.Nil(t, pressure.IO)
+}
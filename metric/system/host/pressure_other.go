@@ -0,0 +1,38 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !linux
+// +build !linux
+
+package host
+
+import (
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgcommon"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// SystemPressure holds the host-wide pressure stall information, which is only available on linux
+type SystemPressure struct {
+	CPU    map[string]cgcommon.Pressure `struct:"cpu,omitempty"`
+	Memory map[string]cgcommon.Pressure `struct:"memory,omitempty"`
+	IO     map[string]cgcommon.Pressure `struct:"io,omitempty"`
+}
+
+// GetPressure is not implemented on this platform
+func GetPressure(_ resolve.Resolver) (SystemPressure, error) {
+	return SystemPressure{}, ErrNotImplemented
+}
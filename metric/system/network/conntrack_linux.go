@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// Conntrack holds the utilization of the netfilter connection tracking table
+type Conntrack struct {
+	Count opt.Uint  `struct:"count,omitempty"`
+	Max   opt.Uint  `struct:"max,omitempty"`
+	Pct   opt.Float `struct:"pct,omitempty"`
+}
+
+// IsZero implements the IsZero interface for go-structform
+func (ct Conntrack) IsZero() bool {
+	return ct.Count.IsZero() && ct.Max.IsZero() && ct.Pct.IsZero()
+}
+
+// GetConntrack returns the current and maximum number of entries in the conntrack table, and the utilization percentage.
+// If the nf_conntrack module is not loaded, the sysctl files won't exist and all the values will be absent.
+func GetConntrack(hostfs resolve.Resolver) (Conntrack, error) {
+	ct := Conntrack{}
+
+	count, err := readSysctlUint(resolve.ProcPath(hostfs, "sys", "net", "netfilter", "nf_conntrack_count"))
+	if err != nil {
+		return ct, err
+	}
+	maxEntries, err := readSysctlUint(resolve.ProcPath(hostfs, "sys", "net", "netfilter", "nf_conntrack_max"))
+	if err != nil {
+		return ct, err
+	}
+
+	ct.Count = count
+	ct.Max = maxEntries
+	if count.Exists() && maxEntries.ValueOr(0) != 0 {
+		ct.Pct = opt.FloatWith(metric.Round(float64(count.ValueOr(0)) / float64(maxEntries.ValueOr(0))))
+	}
+
+	return ct, nil
+}
+
+// readSysctlUint reads a single integer value from a sysctl file, returning an absent value if the file doesn't exist
+func readSysctlUint(path string) (opt.Uint, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return opt.NewUintNone(), nil
+	} else if err != nil {
+		return opt.NewUintNone(), fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	value, err := strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64)
+	if err != nil {
+		return opt.NewUintNone(), fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return opt.UintWith(value), nil
+}
@@ -0,0 +1,43 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetConntrack(t *testing.T) {
+	ct, err := GetConntrack(resolve.NewTestResolver("./testdata"))
+	require.NoError(t, err)
+	require.Equal(t, uint64(16384), ct.Count.ValueOr(0))
+	require.Equal(t, uint64(262144), ct.Max.ValueOr(0))
+	require.Equal(t, 0.0625, ct.Pct.ValueOr(0))
+}
+
+func TestGetConntrackNotLoaded(t *testing.T) {
+	ct, err := GetConntrack(resolve.NewTestResolver(t.TempDir()))
+	require.NoError(t, err)
+	require.True(t, ct.IsZero())
+}
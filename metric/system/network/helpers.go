@@ -18,6 +18,12 @@
 package network
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/elastic/elastic-agent-libs/mapstr"
 	sysinfotypes "github.com/elastic/go-sysinfo/types"
 )
@@ -33,6 +39,42 @@ func MapProcNetCounters(raw *sysinfotypes.NetworkCountersInfo) mapstr.M {
 	return createMap(raw, []string{"all"})
 }
 
+// MapIPv6CountersWithFilter converts the Ip6 counters returned by ParseSNMP6 to a map, and applies the same filter as MapProcNetCountersWithFilter.
+// As the Ip6 prefix is stripped from the counter names, a single filter key such as "InReceives" will match both the ip and ip6 counters.
+func MapIPv6CountersWithFilter(raw map[string]uint64, filter []string) map[string]interface{} {
+	return combineMap(raw, nil, filter)
+}
+
+// ParseSNMP6 parses the Ip6 counters from a /proc/net/snmp6 or /proc/PID/net/snmp6 file, with the "Ip6" prefix removed from the keys.
+// If the file does not exist, as is the case when IPv6 is disabled, a nil map is returned.
+func ParseSNMP6(path string) (map[string]uint64, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return ParseSNMP6Counters(raw)
+}
+
+// ParseSNMP6Counters parses the Ip6 counters from the contents of a snmp6 file, with the "Ip6" prefix removed from the keys.
+func ParseSNMP6Counters(raw []byte) (map[string]uint64, error) {
+	counters := map[string]uint64{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[0], "Ip6") {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing value %s for %s: %w", fields[1], fields[0], err)
+		}
+		counters[strings.TrimPrefix(fields[0], "Ip6")] = value
+	}
+
+	return counters, nil
+}
+
 func createMap(raw *sysinfotypes.NetworkCountersInfo, filter []string) mapstr.M {
 	eventByProto := mapstr.M{
 		"ip":       combineMap(raw.Netstat.IPExt, raw.SNMP.IP, filter),
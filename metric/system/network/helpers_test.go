@@ -58,3 +58,18 @@ func TestFilter(t *testing.T) {
 
 	require.Equal(t, uint64(0x514d4c), filteredMap["ip"].(map[string]interface{})["InBcastOctets"])
 }
+
+func TestParseSNMP6(t *testing.T) {
+	counters, err := ParseSNMP6("./testdata/proc/net/snmp6")
+	require.NoError(t, err)
+	require.Len(t, counters, 7)
+	require.Equal(t, uint64(290), counters["InReceives"])
+	require.Equal(t, uint64(3), counters["InNoRoutes"])
+
+	filtered := MapIPv6CountersWithFilter(counters, []string{"InReceives", "InSegs"})
+	require.Equal(t, map[string]interface{}{"InReceives": uint64(290)}, filtered)
+
+	missing, err := ParseSNMP6("./testdata/proc/net/does_not_exist")
+	require.NoError(t, err)
+	require.Nil(t, missing)
+}
@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/match"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// InterfaceCounters holds the system-wide counters for a single network interface
+type InterfaceCounters struct {
+	Name string           `struct:"name"`
+	In   InterfaceTraffic `struct:"in"`
+	Out  InterfaceTraffic `struct:"out"`
+}
+
+// InterfaceTraffic wraps the per-direction counters for an interface
+type InterfaceTraffic struct {
+	Bytes   uint64 `struct:"bytes"`
+	Packets uint64 `struct:"packets"`
+	Errors  uint64 `struct:"errors"`
+	Dropped uint64 `struct:"dropped"`
+}
+
+// NetworkCounters returns the per-interface counters from /proc/net/dev.
+// Interfaces are only returned if their name passes the filter function. If filter is nil, all interfaces are returned.
+func NetworkCounters(hostfs resolve.Resolver, filter func(string) bool) ([]InterfaceCounters, error) {
+	path := resolve.ProcPath(hostfs, "net", "dev")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	return parseNetDev(string(raw), filter)
+}
+
+// BuildInterfaceFilter returns a filter for NetworkCounters that matches any interface name
+// against the given list of regular expressions.
+func BuildInterfaceFilter(patterns []string) (func(string) bool, error) {
+	matchers := make([]match.Matcher, 0, len(patterns))
+	for _, pattern := range patterns {
+		reg, err := match.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile interface regexp [%s]: %w", pattern, err)
+		}
+		matchers = append(matchers, reg)
+	}
+
+	return func(name string) bool {
+		for _, reg := range matchers {
+			if reg.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func parseNetDev(raw string, filter func(string) bool) ([]InterfaceCounters, error) {
+	counters := []InterfaceCounters{}
+	for _, line := range strings.Split(raw, "\n") {
+		// The first two lines are headers, and don't have a colon after the interface name
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || strings.Contains(parts[0], "|") {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		if filter != nil && !filter(name) {
+			continue
+		}
+
+		fields := strings.Fields(parts[1])
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("expected 16 fields for interface %s, got %d", name, len(fields))
+		}
+		values := make([]uint64, len(fields))
+		for i, field := range fields {
+			val, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing value %s for interface %s: %w", field, name, err)
+			}
+			values[i] = val
+		}
+
+		counters = append(counters, InterfaceCounters{
+			Name: name,
+			In:   InterfaceTraffic{Bytes: values[0], Packets: values[1], Errors: values[2], Dropped: values[3]},
+			Out:  InterfaceTraffic{Bytes: values[8], Packets: values[9], Errors: values[10], Dropped: values[11]},
+		})
+	}
+
+	return counters, nil
+}
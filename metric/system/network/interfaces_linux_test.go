@@ -0,0 +1,51 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestNetworkCounters(t *testing.T) {
+	counters, err := NetworkCounters(resolve.NewTestResolver("./testdata"), nil)
+	require.NoError(t, err)
+	require.Len(t, counters, 4)
+
+	require.Equal(t, "eth0", counters[1].Name)
+	require.Equal(t, InterfaceTraffic{Bytes: 5333226, Packets: 499, Errors: 3, Dropped: 7}, counters[1].In)
+	require.Equal(t, InterfaceTraffic{Bytes: 69366, Packets: 698, Errors: 1, Dropped: 2}, counters[1].Out)
+	require.Equal(t, "vethab12cd", counters[3].Name)
+}
+
+func TestNetworkCountersFilter(t *testing.T) {
+	filter, err := BuildInterfaceFilter([]string{"^eth", "^lo$"})
+	require.NoError(t, err)
+
+	counters, err := NetworkCounters(resolve.NewTestResolver("./testdata"), filter)
+	require.NoError(t, err)
+	require.Len(t, counters, 2)
+	require.Equal(t, "lo", counters[0].Name)
+	require.Equal(t, "eth0", counters[1].Name)
+}
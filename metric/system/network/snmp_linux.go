@@ -0,0 +1,116 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// TCPCounters are the system-wide TCP counters from the Tcp section of /proc/net/snmp.
+// The keys match the names used in the per-process network.tcp metrics.
+type TCPCounters struct {
+	ActiveOpens  uint64 `struct:"ActiveOpens"`
+	PassiveOpens uint64 `struct:"PassiveOpens"`
+	AttemptFails uint64 `struct:"AttemptFails"`
+	EstabResets  uint64 `struct:"EstabResets"`
+	CurrEstab    uint64 `struct:"CurrEstab"`
+	InSegs       uint64 `struct:"InSegs"`
+	OutSegs      uint64 `struct:"OutSegs"`
+	RetransSegs  uint64 `struct:"RetransSegs"`
+	InErrs       uint64 `struct:"InErrs"`
+	OutRsts      uint64 `struct:"OutRsts"`
+	InCsumErrors uint64 `struct:"InCsumErrors"`
+	// MaxConn is defined by RFC2012 as a signed integer, and is -1 on linux
+	MaxConn int64 `struct:"MaxConn"`
+}
+
+// GetTCPCounters returns the system-wide TCP counters, including retransmits and errors, from /proc/net/snmp
+func GetTCPCounters(hostfs resolve.Resolver) (TCPCounters, error) {
+	path := resolve.ProcPath(hostfs, "net", "snmp")
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return TCPCounters{}, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	section, err := parseSNMPSection(string(raw), "Tcp")
+	if err != nil {
+		return TCPCounters{}, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	counters := TCPCounters{
+		ActiveOpens:  section["ActiveOpens"],
+		PassiveOpens: section["PassiveOpens"],
+		AttemptFails: section["AttemptFails"],
+		EstabResets:  section["EstabResets"],
+		CurrEstab:    section["CurrEstab"],
+		InSegs:       section["InSegs"],
+		OutSegs:      section["OutSegs"],
+		RetransSegs:  section["RetransSegs"],
+		InErrs:       section["InErrs"],
+		OutRsts:      section["OutRsts"],
+		InCsumErrors: section["InCsumErrors"],
+		MaxConn:      int64(section["MaxConn"]),
+	}
+
+	return counters, nil
+}
+
+// parseSNMPSection returns the values of a single section of a /proc/net/snmp file.
+// Each section is a pair of lines; the first holds the counter names, and the second the values.
+// Negative values are returned as their two's complement, the same way the per-process counters are.
+func parseSNMPSection(raw string, name string) (map[string]uint64, error) {
+	prefix := name + ":"
+	var header []string
+	for _, line := range strings.Split(raw, "\n") {
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		fields := strings.Fields(line)[1:]
+		if header == nil {
+			header = fields
+			continue
+		}
+
+		if len(fields) != len(header) {
+			return nil, fmt.Errorf("section %s has %d names but %d values", name, len(header), len(fields))
+		}
+		section := make(map[string]uint64, len(fields))
+		for i, field := range fields {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				signed, err := strconv.ParseInt(field, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing value %s for %s: %w", field, header[i], err)
+				}
+				value = uint64(signed)
+			}
+			section[header[i]] = value
+		}
+		return section, nil
+	}
+
+	return nil, fmt.Errorf("section %s not found", name)
+}
@@ -0,0 +1,49 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetTCPCounters(t *testing.T) {
+	counters, err := GetTCPCounters(resolve.NewTestResolver("./testdata"))
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(2417), counters.RetransSegs)
+	require.Equal(t, uint64(3), counters.InErrs)
+	require.Equal(t, uint64(758), counters.OutRsts)
+	require.Equal(t, uint64(1), counters.InCsumErrors)
+	require.Equal(t, uint64(9), counters.CurrEstab)
+	require.Equal(t, int64(-1), counters.MaxConn)
+}
+
+func TestParseSNMPSectionMismatch(t *testing.T) {
+	_, err := parseSNMPSection("Tcp: RtoAlgorithm RtoMin\nTcp: 1\n", "Tcp")
+	require.Error(t, err)
+
+	_, err = parseSNMPSection("Udp: InDatagrams\nUdp: 1\n", "Tcp")
+	require.Error(t, err)
+}
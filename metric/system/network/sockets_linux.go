@@ -0,0 +1,215 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// SocketSummary holds the count of sockets on the system, by protocol and state
+type SocketSummary struct {
+	TCP TCPSocketSummary `struct:"tcp"`
+	UDP UDPSocketSummary `struct:"udp"`
+}
+
+// TCPSocketSummary wraps the tcp.all.* socket counts
+type TCPSocketSummary struct {
+	All TCPStateCounts `struct:"all"`
+}
+
+// TCPStateCounts is the number of TCP sockets in each state
+type TCPStateCounts struct {
+	Count       uint64 `struct:"count"`
+	Established uint64 `struct:"established"`
+	SynSent     uint64 `struct:"syn_sent"`
+	SynRecv     uint64 `struct:"syn_recv"`
+	FinWait1    uint64 `struct:"fin_wait1"`
+	FinWait2    uint64 `struct:"fin_wait2"`
+	TimeWait    uint64 `struct:"time_wait"`
+	Close       uint64 `struct:"close"`
+	CloseWait   uint64 `struct:"close_wait"`
+	LastAck     uint64 `struct:"last_ack"`
+	Listening   uint64 `struct:"listening"`
+	Closing     uint64 `struct:"closing"`
+}
+
+// UDPSocketSummary wraps the udp.all.* socket counts
+type UDPSocketSummary struct {
+	All UDPCount `struct:"all"`
+}
+
+// UDPCount is the number of UDP sockets currently in use
+type UDPCount struct {
+	Count uint64 `struct:"count"`
+}
+
+// TCP states, as defined in include/net/tcp_states.h
+const (
+	tcpEstablished = "01"
+	tcpSynSent     = "02"
+	tcpSynRecv     = "03"
+	tcpFinWait1    = "04"
+	tcpFinWait2    = "05"
+	tcpTimeWait    = "06"
+	tcpClose       = "07"
+	tcpCloseWait   = "08"
+	tcpLastAck     = "09"
+	tcpListen      = "0A"
+	tcpClosing     = "0B"
+)
+
+// TCPStates maps the hex state values in the socket tables to a human-readable name
+var TCPStates = map[string]string{
+	tcpEstablished: "established",
+	tcpSynSent:     "syn_sent",
+	tcpSynRecv:     "syn_recv",
+	tcpFinWait1:    "fin_wait1",
+	tcpFinWait2:    "fin_wait2",
+	tcpTimeWait:    "time_wait",
+	tcpClose:       "close",
+	tcpCloseWait:   "close_wait",
+	tcpLastAck:     "last_ack",
+	tcpListen:      "listen",
+	tcpClosing:     "closing",
+}
+
+// GetSocketSummary returns a count of the IPv4 and IPv6 TCP sockets by state, and the number of UDP sockets in use.
+// The socket tables are summarized line by line, so no per-socket data is kept in memory.
+func GetSocketSummary(hostfs resolve.Resolver) (SocketSummary, error) {
+	summary := SocketSummary{}
+
+	for _, file := range []string{"tcp", "tcp6"} {
+		err := ReadSocketTable(resolve.ProcPath(hostfs, "net", file), func(fields []string) {
+			summary.TCP.All.add(fields[3])
+		})
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	for _, file := range []string{"udp", "udp6"} {
+		err := ReadSocketTable(resolve.ProcPath(hostfs, "net", file), func(_ []string) {
+			summary.UDP.All.Count++
+		})
+		if err != nil {
+			return summary, err
+		}
+	}
+
+	return summary, nil
+}
+
+func (counts *TCPStateCounts) add(state string) {
+	counts.Count++
+	switch state {
+	case tcpEstablished:
+		counts.Established++
+	case tcpSynSent:
+		counts.SynSent++
+	case tcpSynRecv:
+		counts.SynRecv++
+	case tcpFinWait1:
+		counts.FinWait1++
+	case tcpFinWait2:
+		counts.FinWait2++
+	case tcpTimeWait:
+		counts.TimeWait++
+	case tcpClose:
+		counts.Close++
+	case tcpCloseWait:
+		counts.CloseWait++
+	case tcpLastAck:
+		counts.LastAck++
+	case tcpListen:
+		counts.Listening++
+	case tcpClosing:
+		counts.Closing++
+	}
+}
+
+// ReadSocketTable calls handler with the fields of every socket entry in a /proc/net/{tcp,udp}* file.
+// A missing file is not treated as an error, as the tcp6 and udp6 tables don't exist if IPv6 is disabled.
+func ReadSocketTable(path string, handler func([]string)) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := ScanSocketTable(file, handler); err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// ScanSocketTable is ReadSocketTable for the contents of a socket table that's already been opened
+func ScanSocketTable(table io.Reader, handler func([]string)) error {
+	scanner := bufio.NewScanner(table)
+	// skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		handler(fields)
+	}
+	return scanner.Err()
+}
+
+// ParseSocketAddr parses an address from the socket tables, such as "0100007F:0050", into an IP and port.
+// The kernel prints the address as a series of 32-bit words in host byte order, so we assume little-endian here.
+func ParseSocketAddr(raw string) (net.IP, int, error) {
+	parts := strings.SplitN(raw, ":", 2)
+	if len(parts) != 2 {
+		return nil, 0, fmt.Errorf("malformed socket address %s", raw)
+	}
+
+	ipRaw, err := hex.DecodeString(parts[0])
+	if err != nil || (len(ipRaw) != net.IPv4len && len(ipRaw) != net.IPv6len) {
+		return nil, 0, fmt.Errorf("malformed IP in socket address %s", raw)
+	}
+	ip := make(net.IP, len(ipRaw))
+	for word := 0; word < len(ipRaw); word += 4 {
+		for i := 0; i < 4; i++ {
+			ip[word+i] = ipRaw[word+3-i]
+		}
+	}
+
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error parsing port in socket address %s: %w", raw, err)
+	}
+
+	return ip, int(port), nil
+}
@@ -0,0 +1,61 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestSocketSummary(t *testing.T) {
+	// testdata has no udp6 file, which should be skipped
+	summary, err := GetSocketSummary(resolve.NewTestResolver("./testdata"))
+	require.NoError(t, err)
+
+	require.Equal(t, uint64(7), summary.TCP.All.Count)
+	require.Equal(t, uint64(3), summary.TCP.All.Listening)
+	require.Equal(t, uint64(2), summary.TCP.All.Established)
+	require.Equal(t, uint64(1), summary.TCP.All.TimeWait)
+	require.Equal(t, uint64(1), summary.TCP.All.CloseWait)
+	require.Equal(t, uint64(2), summary.UDP.All.Count)
+}
+
+func TestParseSocketAddr(t *testing.T) {
+	ip, port, err := ParseSocketAddr("0100007F:BC8F")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", ip.String())
+	require.Equal(t, 48271, port)
+
+	ip, port, err = ParseSocketAddr("0000000000000000FFFF00000F02000A:0016")
+	require.NoError(t, err)
+	require.Equal(t, "10.0.2.15", ip.String())
+	require.Equal(t, 22, port)
+
+	ip, _, err = ParseSocketAddr("00000000000000000000000001000000:0016")
+	require.NoError(t, err)
+	require.Equal(t, "::1", ip.String())
+
+	_, _, err = ParseSocketAddr("nonsense")
+	require.Error(t, err)
+}
@@ -43,9 +43,14 @@ func getCPU() (int, bool, error) {
 	}
 
 	rawFile, err := ioutil.ReadFile(cpuPath)
-	// if the file doesn't exist, assume it's a support issue and not a bug
+	// if the file doesn't exist, assume it's a support issue and not a bug.
+	// /sys isn't always mounted in containers, so try /proc/stat before giving up.
+	// /proc/stat only lists the online CPUs, so it can't stand in for a present count.
 	if errors.Is(err, os.ErrNotExist) {
-		return -1, false, nil
+		if isPresent {
+			return -1, false, nil
+		}
+		return getProcStatCPU()
 	}
 	if err != nil {
 		return -1, false, fmt.Errorf("error reading file %s: %w", cpuPath, err)
@@ -58,6 +63,37 @@ func getCPU() (int, bool, error) {
 	return cpuCount, true, nil
 }
 
+// getProcStatCPU counts the online CPUs from the per-CPU lines in /proc/stat,
+// which only lists the CPUs that are currently online.
+func getProcStatCPU() (int, bool, error) {
+	rawFile, err := ioutil.ReadFile("/proc/stat")
+	if errors.Is(err, os.ErrNotExist) {
+		return -1, false, nil
+	}
+	if err != nil {
+		return -1, false, fmt.Errorf("error reading file /proc/stat: %w", err)
+	}
+
+	cpuCount := parseProcStatCPUs(string(rawFile))
+	if cpuCount == 0 {
+		return -1, false, nil
+	}
+	return cpuCount, true, nil
+}
+
+// parseProcStatCPUs counts the cpuN lines in /proc/stat, skipping the aggregate "cpu" line
+func parseProcStatCPUs(raw string) int {
+	count := 0
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
 // parse the weird list files we get from sysfs
 func parseCPUList(raw string) (int, error) {
 
@@ -47,3 +47,19 @@ func TestCPUParse(t *testing.T) {
 	}
 
 }
+
+func TestProcStatCPUParse(t *testing.T) {
+	// A host with 4 configured CPUs, where cpu1 and cpu3 have been taken offline
+	raw := `cpu  2255 34 2290 22625563 6290 127 456 0 0 0
+cpu0 1132 34 1441 11311718 3675 127 438 0 0 0
+cpu2 1123 0 849 11313845 2614 0 18 0 0 0
+intr 114930548 113199788 3 0 5 263 0 4 [... lots more numbers ...]
+ctxt 1990473
+btime 1062191376
+processes 2915
+procs_running 1
+procs_blocked 0
+`
+	assert.Equal(t, 2, parseProcStatCPUs(raw))
+	assert.Equal(t, 0, parseProcStatCPUs("intr 0\nctxt 0\n"))
+}
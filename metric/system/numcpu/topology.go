@@ -0,0 +1,31 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package numcpu
+
+import "errors"
+
+// ErrNotImplemented indicates that a feature is not available on the current platform.
+var ErrNotImplemented = errors.New("not implemented on this platform")
+
+// CPUTopology is the number of sockets, physical cores and logical CPUs on the system.
+// LogicalCPUs is greater than PhysicalCores when hyperthreading (SMT) is enabled.
+type CPUTopology struct {
+	Sockets       int `struct:"sockets"`
+	PhysicalCores int `struct:"physical_cores"`
+	LogicalCPUs   int `struct:"logical_cpus"`
+}
@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package numcpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Topology returns the CPU topology from sysfs, counting the online CPUs.
+// see https://www.kernel.org/doc/Documentation/admin-guide/cputopology.rst
+// If /sys isn't mounted, this returns ErrNotImplemented.
+func Topology() (CPUTopology, error) {
+	return topologyFromSysfs("/sys/devices/system/cpu")
+}
+
+func topologyFromSysfs(cpuDir string) (CPUTopology, error) {
+	dirs, err := filepath.Glob(filepath.Join(cpuDir, "cpu[0-9]*"))
+	if err != nil {
+		return CPUTopology{}, fmt.Errorf("error listing %s: %w", cpuDir, err)
+	}
+
+	type core struct {
+		pkg, id int
+	}
+	sockets := map[int]bool{}
+	cores := map[core]bool{}
+	logical := 0
+	for _, dir := range dirs {
+		// offline CPUs don't have a topology directory
+		pkg, err := readTopologyID(dir, "physical_package_id")
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return CPUTopology{}, err
+		}
+		id, err := readTopologyID(dir, "core_id")
+		if err != nil {
+			return CPUTopology{}, err
+		}
+		sockets[pkg] = true
+		cores[core{pkg: pkg, id: id}] = true
+		logical++
+	}
+
+	if logical == 0 {
+		return CPUTopology{}, ErrNotImplemented
+	}
+	return CPUTopology{Sockets: len(sockets), PhysicalCores: len(cores), LogicalCPUs: logical}, nil
+}
+
+// readTopologyID reads one of the ID files in the topology directory of a CPU.
+// Core IDs are only unique within a package, and aren't necessarily contiguous.
+func readTopologyID(cpuPath, name string) (int, error) {
+	path := filepath.Join(cpuPath, "topology", name)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return id, nil
+}
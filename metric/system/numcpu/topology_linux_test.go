@@ -0,0 +1,57 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package numcpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopology(t *testing.T) {
+	topology, err := Topology()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, topology.LogicalCPUs, topology.PhysicalCores)
+	assert.GreaterOrEqual(t, topology.PhysicalCores, topology.Sockets)
+	assert.Greater(t, topology.Sockets, 0)
+}
+
+func TestTopologyFromSysfs(t *testing.T) {
+	// Two sockets with two hyperthreaded cores each, numbered the way x86 does it,
+	// and an offline CPU with no topology
+	cpuDir := t.TempDir()
+	for cpu := 0; cpu < 8; cpu++ {
+		dir := filepath.Join(cpuDir, fmt.Sprintf("cpu%d", cpu), "topology")
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "physical_package_id"), []byte(fmt.Sprintf("%d\n", cpu%2)), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "core_id"), []byte(fmt.Sprintf("%d\n", (cpu/2)%2)), 0o644))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(cpuDir, "cpu8"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(cpuDir, "cpufreq"), 0o755))
+
+	topology, err := topologyFromSysfs(cpuDir)
+	require.NoError(t, err)
+	assert.Equal(t, CPUTopology{Sockets: 2, PhysicalCores: 4, LogicalCPUs: 8}, topology)
+
+	_, err = topologyFromSysfs(t.TempDir())
+	assert.ErrorIs(t, err, ErrNotImplemented)
+}
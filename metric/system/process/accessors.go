@@ -0,0 +1,86 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build (darwin && cgo) || freebsd || linux || windows || aix
+// +build darwin,cgo freebsd linux windows aix
+
+package process
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// GetProcRSS returns the resident set size of a process in bytes.
+// Unlike GetOne or GetSelf, this only reads the memory data for the process,
+// which makes it cheap enough to call frequently.
+func GetProcRSS(hostfs resolve.Resolver, pid int) (opt.Uint, error) {
+	mem, err := getProcMem(hostfs, pid)
+	if err != nil {
+		return opt.NewUintNone(), fmt.Errorf("error fetching memory for pid %d: %w", pid, toProcError(err))
+	}
+	return mem.Rss.Bytes, nil
+}
+
+// GetProcCPUTicks returns the total user and system CPU time used by a process, in the same ticks as ProcCPUInfo.
+// Like GetProcRSS, this only reads the CPU data for the process.
+func GetProcCPUTicks(hostfs resolve.Resolver, pid int) (opt.Uint, error) {
+	cpu, err := getProcCPU(hostfs, pid)
+	if err != nil {
+		return opt.NewUintNone(), fmt.Errorf("error fetching CPU times for pid %d: %w", pid, toProcError(err))
+	}
+	return cpu.Total.Ticks, nil
+}
+
+// GetMemory returns the processes whose names match Procs, with only their memory metrics filled out along with the basic PID info.
+// It skips the CPU, network, environment and other metrics that Get reads, so it's much cheaper for memory-focused views.
+// Like MatchingPIDs, MaxProcs and IncludeTop aren't applied. Processes that exit, or that we don't have permission to read, are left out.
+func (procStats *Stats) GetMemory() ([]ProcState, error) {
+	plist, err := procStats.MatchingPIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	var totalPhyMem uint64
+	if procStats.host != nil {
+		if memStats, err := procStats.host.Memory(); err == nil {
+			totalPhyMem = memStats.Total
+		}
+	}
+
+	procs := make([]ProcState, 0, len(plist))
+	for _, proc := range plist {
+		pid := proc.Pid.ValueOr(0)
+		mem, err := getProcMem(procStats.Hostfs, pid)
+		if err != nil {
+			err = toProcError(err)
+			if errors.Is(err, ErrProcNotExist) || errors.Is(err, ErrProcPermission) {
+				continue
+			}
+			return nil, fmt.Errorf("error fetching memory for pid %d: %w", pid, err)
+		}
+		// some platforms read the CPU times along with the basic PID info
+		proc.CPU = ProcCPUInfo{}
+		proc.Memory = mem
+		proc.Memory.Rss.Pct = GetProcMemPercentage(proc, totalPhyMem)
+		procs = append(procs, proc)
+	}
+	return procs, nil
+}
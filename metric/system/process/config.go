@@ -17,6 +17,11 @@
 
 package process
 
+import (
+	"fmt"
+	"regexp"
+)
+
 // IncludeTopConfig is the configuration for the "top N processes
 // filtering" feature
 type IncludeTopConfig struct {
@@ -24,3 +29,42 @@ type IncludeTopConfig struct {
 	ByCPU    int  `config:"by_cpu"`
 	ByMemory int  `config:"by_memory"`
 }
+
+// active returns true if the configuration will filter down the list of processes
+func (cfg IncludeTopConfig) active() bool {
+	return cfg.Enabled && (cfg.ByCPU > 0 || cfg.ByMemory > 0)
+}
+
+// NameRewriteConfig rewrites process names that match Pattern, such as
+// versioned binaries, so they're reported under a single name.
+// Replace may refer to capture groups in Pattern, such as `${1}`.
+type NameRewriteConfig struct {
+	Pattern string `config:"pattern"`
+	Replace string `config:"replace"`
+}
+
+// nameRewrite is a compiled NameRewriteConfig
+type nameRewrite struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+func compileNameRewrites(cfgs []NameRewriteConfig) ([]nameRewrite, error) {
+	rewrites := make([]nameRewrite, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		reg, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile name rewrite regexp [%s]: %w", cfg.Pattern, err)
+		}
+		rewrites = append(rewrites, nameRewrite{pattern: reg, replace: cfg.Replace})
+	}
+	return rewrites, nil
+}
+
+// rewriteName applies each rewrite to the name in turn
+func rewriteName(rewrites []nameRewrite, name string) string {
+	for _, rewrite := range rewrites {
+		name = rewrite.pattern.ReplaceAllString(name, rewrite.replace)
+	}
+	return name
+}
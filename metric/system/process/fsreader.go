@@ -0,0 +1,61 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build freebsd || linux
+// +build freebsd linux
+
+package process
+
+import (
+	"io/fs"
+	"os"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// fsReader is the set of file operations used to read process metrics from procfs.
+// If the resolver passed to the process code also implements fsReader, its methods are used
+// instead of the OS filesystem. This allows procfs to be provided by something other than
+// a mounted filesystem, for example in tests. Paths are passed already resolved by the resolver.
+type fsReader interface {
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Readlink(name string) (string, error)
+}
+
+// osReader is the default fsReader, which reads from the OS filesystem
+type osReader struct{}
+
+func (osReader) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (osReader) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osReader) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// readerFor returns the fsReader to use with the given resolver
+func readerFor(hostfs resolve.Resolver) fsReader {
+	if reader, ok := hostfs.(fsReader); ok {
+		return reader
+	}
+	return osReader{}
+}
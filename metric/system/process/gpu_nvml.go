@@ -0,0 +1,247 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build gpu && linux && cgo
+// +build gpu,linux,cgo
+
+package process
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stddef.h>
+
+// NVML is loaded at runtime, so the library doesn't have to be present at build time,
+// and hosts without an NVIDIA driver can still run the binary.
+// The types are from nvml.h; nvmlProcessInfo_v2_t is what the _v2 process functions take.
+
+typedef void *nvmlDevice_t;
+
+typedef struct {
+	unsigned int pid;
+	unsigned long long usedGpuMemory;
+	unsigned int gpuInstanceId;
+	unsigned int computeInstanceId;
+} nvmlProcessInfo_v2_t;
+
+typedef struct {
+	unsigned int pid;
+	unsigned long long timeStamp;
+	unsigned int smUtil;
+	unsigned int memUtil;
+	unsigned int encUtil;
+	unsigned int decUtil;
+} nvmlProcessUtilizationSample_t;
+
+static int (*nvmlInitFn)(void);
+static int (*nvmlDeviceGetCountFn)(unsigned int *);
+static int (*nvmlDeviceGetHandleByIndexFn)(unsigned int, nvmlDevice_t *);
+static int (*nvmlDeviceGetComputeRunningProcessesFn)(nvmlDevice_t, unsigned int *, nvmlProcessInfo_v2_t *);
+static int (*nvmlDeviceGetGraphicsRunningProcessesFn)(nvmlDevice_t, unsigned int *, nvmlProcessInfo_v2_t *);
+static int (*nvmlDeviceGetProcessUtilizationFn)(nvmlDevice_t, nvmlProcessUtilizationSample_t *, unsigned int *, unsigned long long);
+
+// nvmlLoad opens and initializes NVML, returning -1 if the library or any of the functions we use are missing
+static int nvmlLoad(void) {
+	void *lib = dlopen("libnvidia-ml.so.1", RTLD_NOW);
+	if (lib == NULL) {
+		return -1;
+	}
+	nvmlInitFn = dlsym(lib, "nvmlInit_v2");
+	nvmlDeviceGetCountFn = dlsym(lib, "nvmlDeviceGetCount_v2");
+	nvmlDeviceGetHandleByIndexFn = dlsym(lib, "nvmlDeviceGetHandleByIndex_v2");
+	nvmlDeviceGetComputeRunningProcessesFn = dlsym(lib, "nvmlDeviceGetComputeRunningProcesses_v2");
+	nvmlDeviceGetGraphicsRunningProcessesFn = dlsym(lib, "nvmlDeviceGetGraphicsRunningProcesses_v2");
+	nvmlDeviceGetProcessUtilizationFn = dlsym(lib, "nvmlDeviceGetProcessUtilization");
+	if (nvmlInitFn == NULL || nvmlDeviceGetCountFn == NULL || nvmlDeviceGetHandleByIndexFn == NULL ||
+		nvmlDeviceGetComputeRunningProcessesFn == NULL || nvmlDeviceGetGraphicsRunningProcessesFn == NULL ||
+		nvmlDeviceGetProcessUtilizationFn == NULL) {
+		dlclose(lib);
+		return -1;
+	}
+	return nvmlInitFn();
+}
+
+static int nvmlDeviceCount(unsigned int *count) {
+	return nvmlDeviceGetCountFn(count);
+}
+
+static int nvmlDeviceHandle(unsigned int index, nvmlDevice_t *device) {
+	return nvmlDeviceGetHandleByIndexFn(index, device);
+}
+
+static int nvmlDeviceProcesses(nvmlDevice_t device, int graphics, unsigned int *count, nvmlProcessInfo_v2_t *infos) {
+	if (graphics) {
+		return nvmlDeviceGetGraphicsRunningProcessesFn(device, count, infos);
+	}
+	return nvmlDeviceGetComputeRunningProcessesFn(device, count, infos);
+}
+
+static int nvmlDeviceUtilization(nvmlDevice_t device, nvmlProcessUtilizationSample_t *samples, unsigned int *count) {
+	return nvmlDeviceGetProcessUtilizationFn(device, samples, count, 0);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+)
+
+// NVML return codes, from nvml.h
+const (
+	nvmlSuccess               = 0
+	nvmlErrorNotFound         = 6
+	nvmlErrorInsufficientSize = 7
+)
+
+// nvmlValueNotAvailable is reported as the used memory when it can't be attributed to a process, such as with MIG
+const nvmlValueNotAvailable = ^uint64(0)
+
+var (
+	nvmlOnce sync.Once
+	nvmlErr  error
+)
+
+// loadNVML loads and initializes NVML the first time it's called.
+// NVML isn't shut down, as it's shared by every Stats instance for the life of the process.
+func loadNVML() error {
+	nvmlOnce.Do(func() {
+		ret := C.nvmlLoad()
+		if ret == -1 {
+			nvmlErr = fmt.Errorf("%w: libnvidia-ml.so.1 couldn't be loaded", ErrNotImplemented)
+		} else if ret != nvmlSuccess {
+			nvmlErr = fmt.Errorf("%w: nvmlInit returned error %d", ErrNotImplemented, int(ret))
+		}
+	})
+	return nvmlErr
+}
+
+// getGPUUsage returns the GPU memory and utilization of every process using an NVIDIA GPU, keyed by PID
+func getGPUUsage() (map[int]ProcGPUInfo, error) {
+	if err := loadNVML(); err != nil {
+		return nil, err
+	}
+
+	var count C.uint
+	if ret := C.nvmlDeviceCount(&count); ret != nvmlSuccess {
+		return nil, fmt.Errorf("nvmlDeviceGetCount returned error %d", int(ret))
+	}
+
+	memory := map[int]uint64{}
+	utilization := map[int]float64{}
+	for i := C.uint(0); i < count; i++ {
+		var device C.nvmlDevice_t
+		if ret := C.nvmlDeviceHandle(i, &device); ret != nvmlSuccess {
+			return nil, fmt.Errorf("nvmlDeviceGetHandleByIndex returned error %d for device %d", int(ret), int(i))
+		}
+
+		deviceMemory, err := deviceProcessMemory(device)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching processes for device %d: %w", int(i), err)
+		}
+		for pid, used := range deviceMemory {
+			memory[pid] += used
+		}
+
+		deviceUtil, err := deviceProcessUtilization(device)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching utilization for device %d: %w", int(i), err)
+		}
+		for pid, util := range deviceUtil {
+			utilization[pid] += util
+		}
+	}
+
+	usage := make(map[int]ProcGPUInfo, len(memory))
+	for pid, used := range memory {
+		info := usage[pid]
+		info.MemoryBytes = opt.UintWith(used)
+		usage[pid] = info
+	}
+	for pid, util := range utilization {
+		info := usage[pid]
+		info.UtilizationPct = opt.FloatWith(metric.Round(util))
+		usage[pid] = info
+	}
+	return usage, nil
+}
+
+// deviceProcessMemory returns the memory used on a device by each compute and graphics process.
+// A process can be in both lists, with the same memory, so it's only counted once.
+func deviceProcessMemory(device C.nvmlDevice_t) (map[int]uint64, error) {
+	memory := map[int]uint64{}
+	for _, graphics := range []C.int{0, 1} {
+		// the count is updated to the number of processes if the buffer is too small
+		infos := make([]C.nvmlProcessInfo_v2_t, 64)
+		count := C.uint(len(infos))
+		ret := C.nvmlDeviceProcesses(device, graphics, &count, &infos[0])
+		if ret == nvmlErrorInsufficientSize {
+			infos = make([]C.nvmlProcessInfo_v2_t, count)
+			ret = C.nvmlDeviceProcesses(device, graphics, &count, &infos[0])
+		}
+		if ret != nvmlSuccess {
+			return nil, fmt.Errorf("nvmlDeviceGetRunningProcesses returned error %d", int(ret))
+		}
+
+		for _, info := range infos[:count] {
+			used := uint64(info.usedGpuMemory)
+			if used == nvmlValueNotAvailable {
+				continue
+			}
+			if pid := int(info.pid); used > memory[pid] {
+				memory[pid] = used
+			}
+		}
+	}
+	return memory, nil
+}
+
+// deviceProcessUtilization returns the most recent SM utilization of each process on a device, from 0 to 1.
+// The driver keeps a short history of samples, so there can be several for each process.
+func deviceProcessUtilization(device C.nvmlDevice_t) (map[int]float64, error) {
+	var count C.uint
+	ret := C.nvmlDeviceUtilization(device, nil, &count)
+	if ret == nvmlErrorNotFound || (ret == nvmlSuccess && count == 0) {
+		return nil, nil
+	}
+	if ret != nvmlErrorInsufficientSize {
+		return nil, fmt.Errorf("nvmlDeviceGetProcessUtilization returned error %d", int(ret))
+	}
+
+	samples := make([]C.nvmlProcessUtilizationSample_t, count)
+	ret = C.nvmlDeviceUtilization(device, &samples[0], &count)
+	if ret == nvmlErrorNotFound {
+		return nil, nil
+	}
+	if ret != nvmlSuccess {
+		return nil, fmt.Errorf("nvmlDeviceGetProcessUtilization returned error %d", int(ret))
+	}
+
+	utilization := map[int]float64{}
+	latest := map[int]uint64{}
+	for _, sample := range samples[:count] {
+		pid := int(sample.pid)
+		if ts := uint64(sample.timeStamp); ts >= latest[pid] {
+			latest[pid] = ts
+			utilization[pid] = float64(sample.smUtil) / 100
+		}
+	}
+	return utilization, nil
+}
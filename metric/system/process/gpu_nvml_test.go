@@ -0,0 +1,60 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build gpu && linux && cgo
+// +build gpu,linux,cgo
+
+package process
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGPUUsage(t *testing.T) {
+	usage, err := getGPUUsage()
+	available := err == nil
+	if errors.Is(err, ErrNotImplemented) {
+		t.Logf("NVML isn't available: %s", err)
+	} else {
+		require.NoError(t, err)
+		for pid, info := range usage {
+			assert.Greater(t, pid, 0)
+			assert.False(t, info.IsZero())
+		}
+	}
+
+	// without a GPU the event is left without any gpu metrics, instead of failing
+	testConfig := Stats{
+		Procs:     []string{".*"},
+		Hostfs:    resolve.NewTestResolver("/"),
+		EnableGPU: true,
+	}
+	require.NoError(t, testConfig.Init())
+	event, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	if !available {
+		_, err := event.GetValue("gpu")
+		assert.Error(t, err)
+	}
+}
@@ -18,19 +18,37 @@
 package process
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"time"
 
+	"github.com/elastic/elastic-agent-libs/mapstr"
 	"github.com/elastic/elastic-agent-libs/opt"
 	"github.com/elastic/elastic-agent-libs/transform/typeconv"
 	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/numcpu"
 )
 
 // unixTimeMsToTime converts a unix time given in milliseconds since Unix epoch
 // to a typeconv.Time value.
 func unixTimeMsToTime(unixTimeMs uint64) string {
-	return typeconv.Time(time.Unix(0, int64(unixTimeMs*1000000))).String()
+	if unixTimeMs > math.MaxInt64 {
+		unixTimeMs = math.MaxInt64
+	}
+	return typeconv.Time(time.UnixMilli(int64(unixTimeMs))).String()
+}
+
+// saturatingAdd adds two counters, capping the sum at math.MaxUint64 instead of wrapping
+func saturatingAdd(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
 }
 
 func stripNullByte(buf []byte) string { //nolint: deadcode,unused,nolintlint // it is used in platform specific code
@@ -43,13 +61,130 @@ func stripNullByteRaw(buf []byte) []byte { //nolint: deadcode,unused,nolintlint
 
 // GetProcMemPercentage returns process memory usage as a percent of total memory usage
 func GetProcMemPercentage(proc ProcState, totalPhyMem uint64) opt.Float {
-	if totalPhyMem == 0 {
+	return metric.Pct(proc.Memory.Rss.Bytes.ValueOr(0), totalPhyMem)
+}
+
+// GetProcCgroupMemPercentage returns process memory usage as a percent of the memory limit of its cgroup.
+// The result is unset if the process has no cgroup memory stats, or if its cgroup limit isn't below totalPhyMem,
+// in which case the host memory is the effective limit and GetProcMemPercentage should be used.
+func GetProcCgroupMemPercentage(proc ProcState, totalPhyMem uint64) opt.Float {
+	limit := cgroupMemLimit(proc.Cgroup)
+	if limit == 0 || (totalPhyMem > 0 && limit >= totalPhyMem) {
+		return opt.NewFloatNone()
+	}
+	return metric.Pct(proc.Memory.Rss.Bytes.ValueOr(0), limit)
+}
+
+// cgroupMemLimit returns the memory limit of a cgroup, or 0 if it has none.
+// V1 cgroups without a limit report a very large value, which is left to the caller to compare with the host memory.
+func cgroupMemLimit(stats cgroup.CGStats) uint64 {
+	switch stats := stats.(type) {
+	case *cgroup.StatsV1:
+		if stats.Memory != nil {
+			return stats.Memory.Mem.Limit.Bytes
+		}
+	case *cgroup.StatsV2:
+		if stats.Memory != nil {
+			return stats.Memory.Mem.Max.Bytes.ValueOr(0)
+		}
+	}
+	return 0
+}
+
+// sumUint adds two optional values; the sum is only absent if both are
+func sumUint(a, b opt.Uint) opt.Uint {
+	if !a.Exists() && !b.Exists() {
+		return opt.NewUintNone()
+	}
+	return opt.UintWith(a.ValueOr(0) + b.ValueOr(0))
+}
+
+// sumFloat adds two optional values; the sum is only absent if both are
+func sumFloat(a, b opt.Float) opt.Float {
+	if !a.Exists() && !b.Exists() {
 		return opt.NewFloatNone()
 	}
+	return opt.FloatWith(a.ValueOr(0) + b.ValueOr(0))
+}
+
+// ArgsPrefix returns the first n arguments of argv, along with the basename of the binary.
+// All of argv is returned if n isn't greater than zero, or argv has no more than n arguments.
+func ArgsPrefix(argv []string, n int) ([]string, string) {
+	if len(argv) == 0 {
+		return argv, ""
+	}
+	binary := filepath.Base(argv[0])
+	if n <= 0 || len(argv) <= n {
+		return argv, binary
+	}
+	return argv[:n], binary
+}
+
+// changedEnvKeys returns the sorted names of the variables that were added, removed or modified between two environments.
+// The result is never nil, so an unchanged environment can be told apart from one that wasn't compared.
+func changedEnvKeys(prev, cur mapstr.M) []string {
+	changed := []string{}
+	for key, value := range cur {
+		if prevValue, ok := prev[key]; !ok || prevValue != value {
+			changed = append(changed, key)
+		}
+	}
+	for key := range prev {
+		if _, ok := cur[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
 
-	perc := (float64(proc.Memory.Rss.Bytes.ValueOr(0)) / float64(totalPhyMem))
+// entityID hashes the fields that identify a single run of a process.
+// On linux, the start time only has second precision, so a PID reused within the same second isn't told apart.
+func entityID(pid int, startTime, bootID string) string {
+	if startTime == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strconv.Itoa(pid) + "|" + startTime + "|" + bootID))
+	return hex.EncodeToString(sum[:16])
+}
 
-	return opt.FloatWith(metric.Round(perc))
+// MergeResults combines the events from several Stats instances, such as ones with different Procs filters,
+// so a process matched by more than one of them is only reported once.
+// Events are keyed by `pid`, or by `process.pid` for root events; where a PID appears more than once,
+// the last event wins, but keeps the position of the first. Events without a PID are always kept.
+// Get moves the PID to the root events, so its process events can't be merged on their own.
+func MergeResults(results ...[]mapstr.M) []mapstr.M {
+	merged := []mapstr.M{}
+	positions := map[int]int{}
+	for _, events := range results {
+		for _, event := range events {
+			pid, ok := eventPid(event)
+			if !ok {
+				merged = append(merged, event)
+				continue
+			}
+			if pos, seen := positions[pid]; seen {
+				merged[pos] = event
+				continue
+			}
+			positions[pid] = len(merged)
+			merged = append(merged, event)
+		}
+	}
+	return merged
+}
+
+// eventPid returns the PID of an event formatted by Stats
+func eventPid(event mapstr.M) (int, bool) {
+	for _, key := range []string{"pid", "process.pid"} {
+		val, err := event.GetValue(key)
+		if err != nil {
+			continue
+		}
+		pid, ok := val.(int)
+		return pid, ok
+	}
+	return 0, false
 }
 
 // isProcessInSlice looks up proc in the processes slice and returns if
@@ -75,26 +210,48 @@ func isProcessInSlice(processes []ProcState, proc *ProcState) bool {
 // available between samples. This could result in incorrect percentages if the
 // wall-clock is adjusted (prior to Go 1.9) or the machine is suspended.
 func GetProcCPUPercentage(s0, s1 ProcState) ProcState {
-	// Skip if we're missing the total ticks
-	if s0.CPU.Total.Ticks.IsZero() || s1.CPU.Total.Ticks.IsZero() {
+	pct := CPUPercentageBetween(s0, s1)
+	if !pct.Pct.Exists() {
 		return s1
 	}
 
-	timeDelta := s1.SampleTime.Sub(s0.SampleTime)
+	s1.CPU.Total.Norm.Pct = pct.Norm
+	s1.CPU.Total.Pct = pct.Pct
+
+	return s1
+}
+
+// CPUPercentages holds the CPU usage of a process between two samples
+type CPUPercentages struct {
+	// Pct ranges on [0, number_of_cores]
+	Pct opt.Float
+	// Norm is Pct normalized by the number of cores, so it ranges on [0, 1]
+	Norm opt.Float
+}
+
+// CPUPercentageBetween computes the same percentages as GetProcCPUPercentage, without modifying either sample.
+// The values are absent if either sample is missing the total ticks, or if no time passed between the samples.
+func CPUPercentageBetween(prev, cur ProcState) CPUPercentages {
+	none := CPUPercentages{Pct: opt.NewFloatNone(), Norm: opt.NewFloatNone()}
+	// Skip if we're missing the total ticks
+	if prev.CPU.Total.Ticks.IsZero() || cur.CPU.Total.Ticks.IsZero() {
+		return none
+	}
+
+	timeDelta := cur.SampleTime.Sub(prev.SampleTime)
 	timeDeltaDur := timeDelta / time.Millisecond
-	totalCPUDeltaMillis := int64(s1.CPU.Total.Ticks.ValueOr(0) - s0.CPU.Total.Ticks.ValueOr(0))
+	totalCPUDeltaMillis := int64(cur.CPU.Total.Ticks.ValueOr(0) - prev.CPU.Total.Ticks.ValueOr(0))
 
 	pct := float64(totalCPUDeltaMillis) / float64(timeDeltaDur)
 	// In theory this can only happen if the time delta is 0, which is unlikely but possible.
 	// With all the type conversion and non-integer math, this is probably the safest way to check.
-	if math.IsNaN(pct) {
-		return s1
+	if math.IsNaN(pct) || math.IsInf(pct, 0) {
+		return none
 	}
 	normalizedPct := pct / float64(numcpu.NumCPU())
 
-	s1.CPU.Total.Norm.Pct = opt.FloatWith(metric.Round(normalizedPct))
-	s1.CPU.Total.Pct = opt.FloatWith(metric.Round(pct))
-
-	return s1
-
+	return CPUPercentages{
+		Pct:  opt.FloatWith(metric.Round(pct)),
+		Norm: opt.FloatWith(metric.Round(normalizedPct)),
+	}
 }
@@ -0,0 +1,48 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package process
+
+/*
+#include <libproc.h>
+#include <sys/resource.h>
+*/
+import "C"
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getIO returns the storage I/O counters from proc_pid_rusage
+func getIO(_ resolve.Resolver, pid int) (ProcIOInfo, error) {
+	info := C.struct_rusage_info_v2{}
+	ret, err := C.proc_pid_rusage(C.int(pid), C.RUSAGE_INFO_V2, (*C.rusage_info_t)(unsafe.Pointer(&info)))
+	if ret != 0 {
+		return ProcIOInfo{}, fmt.Errorf("proc_pid_rusage failed for pid %d: %w", pid, err)
+	}
+
+	return ProcIOInfo{
+		ReadBytes:  opt.UintWith(uint64(info.ri_diskio_bytesread)),
+		WriteBytes: opt.UintWith(uint64(info.ri_diskio_byteswritten)),
+	}, nil
+}
@@ -0,0 +1,74 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getIO returns the storage I/O counters from /proc/PID/io
+func getIO(hostfs resolve.Resolver, pid int) (ProcIOInfo, error) {
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "io")
+	data, err := readerFor(hostfs).ReadFile(path)
+	if err != nil {
+		return ProcIOInfo{}, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+
+	io, err := parseIO(string(data))
+	if err != nil {
+		return io, fmt.Errorf("error parsing IO counters for pid %d: %w", pid, err)
+	}
+	return io, nil
+}
+
+// parseIO reads the counters we report from the "name: value" lines of /proc/PID/io
+func parseIO(raw string) (ProcIOInfo, error) {
+	io := ProcIOInfo{}
+	targets := map[string]*opt.Uint{
+		"read_bytes":  &io.ReadBytes,
+		"write_bytes": &io.WriteBytes,
+		"syscr":       &io.SyscallRead,
+		"syscw":       &io.SyscallWrite,
+	}
+
+	for _, line := range strings.Split(raw, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		target, ok := targets[parts[0]]
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return io, fmt.Errorf("error parsing %s: %w", parts[0], err)
+		}
+		*target = opt.UintWith(value)
+	}
+
+	return io, nil
+}
@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetIO(t *testing.T) {
+	testConfig := Stats{
+		Procs:    []string{".*"},
+		Hostfs:   resolve.NewTestResolver("/"),
+		EnableIO: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	// the values can be zero, as reads may be served from the page cache
+	assert.True(t, self.IO.ReadBytes.Exists())
+	assert.True(t, self.IO.WriteBytes.Exists())
+	// we've at least read our own procfs files
+	assert.Greater(t, self.IO.SyscallRead.ValueOr(0), uint64(0))
+	assert.True(t, self.IO.SyscallWrite.Exists())
+}
+
+func TestParseIO(t *testing.T) {
+	raw := `rchar: 323934931
+wchar: 323929600
+syscr: 632687
+syscw: 632675
+read_bytes: 4096
+write_bytes: 323932160
+cancelled_write_bytes: 0
+`
+	io, err := parseIO(raw)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4096), io.ReadBytes.ValueOr(0))
+	assert.Equal(t, uint64(323932160), io.WriteBytes.ValueOr(0))
+	assert.Equal(t, uint64(632687), io.SyscallRead.ValueOr(0))
+	assert.Equal(t, uint64(632675), io.SyscallWrite.ValueOr(0))
+
+	_, err = parseIO("read_bytes: lots\n")
+	assert.Error(t, err)
+}
@@ -0,0 +1,41 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"strconv"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// kthreaddPid is the PID of kthreadd, the parent of every kernel thread
+const kthreaddPid = 2
+
+// isKernelThread returns true if the process is kthreadd or one of its children, and has no command line.
+// Userspace processes always have a command line, unless they're zombies or have cleared it themselves.
+func isKernelThread(hostfs resolve.Resolver, state ProcState) bool {
+	pid := state.Pid.ValueOr(0)
+	if pid != kthreaddPid && state.Ppid.ValueOr(0) != kthreaddPid {
+		return false
+	}
+	cmdline, err := readerFor(hostfs).ReadFile(resolve.ProcPath(hostfs, strconv.Itoa(pid), "cmdline"))
+	return err == nil && len(cmdline) == 0
+}
@@ -0,0 +1,92 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getLimits returns the resource limits from /proc/PID/limits
+func getLimits(hostfs resolve.Resolver, pid int) (ProcRlimits, error) {
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "limits")
+	data, err := readerFor(hostfs).ReadFile(path)
+	if err != nil {
+		return ProcRlimits{}, fmt.Errorf("error opening file %s: %w", path, err)
+	}
+
+	limits, err := parseLimits(string(data))
+	if err != nil {
+		return limits, fmt.Errorf("error parsing limits for pid %d: %w", pid, err)
+	}
+	return limits, nil
+}
+
+// parseLimits reads the soft and hard values of the limits we report.
+// Each line is the name of the limit, the soft and hard values, and optionally the units.
+func parseLimits(raw string) (ProcRlimits, error) {
+	limits := ProcRlimits{}
+	targets := map[string]*ProcLimits{
+		"Max address space": &limits.AS,
+		"Max resident set":  &limits.RSS,
+		"Max open files":    &limits.NOFile,
+		"Max processes":     &limits.NProc,
+	}
+
+	for _, line := range strings.Split(raw, "\n") {
+		for name, target := range targets {
+			if !strings.HasPrefix(line, name) {
+				continue
+			}
+			fields := strings.Fields(line[len(name):])
+			if len(fields) < 2 {
+				return limits, fmt.Errorf("expected soft and hard values in line '%s'", line)
+			}
+			var err error
+			target.Soft, err = parseLimitValue(fields[0])
+			if err != nil {
+				return limits, fmt.Errorf("error parsing soft limit for '%s': %w", name, err)
+			}
+			target.Hard, err = parseLimitValue(fields[1])
+			if err != nil {
+				return limits, fmt.Errorf("error parsing hard limit for '%s': %w", name, err)
+			}
+		}
+	}
+
+	return limits, nil
+}
+
+// parseLimitValue returns an absent value for unlimited
+func parseLimitValue(raw string) (opt.Uint, error) {
+	if raw == "unlimited" {
+		return opt.NewUintNone(), nil
+	}
+	value, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return opt.NewUintNone(), err
+	}
+	return opt.UintWith(value), nil
+}
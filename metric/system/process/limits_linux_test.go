@@ -0,0 +1,66 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetLimits(t *testing.T) {
+	testConfig := Stats{
+		Procs:        []string{".*"},
+		Hostfs:       resolve.NewTestResolver("/"),
+		EnableLimits: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	event, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	soft, err := event.GetValue("limits.nofile.soft")
+	require.NoError(t, err)
+	assert.Greater(t, soft, uint64(0))
+}
+
+func TestParseLimits(t *testing.T) {
+	raw := `Limit                     Soft Limit           Hard Limit           Units
+Max cpu time              unlimited            unlimited            seconds
+Max resident set          unlimited            unlimited            bytes
+Max processes             63422                63422                processes
+Max open files            1024                 524288               files
+Max address space         8589934592           unlimited            bytes
+`
+	limits, err := parseLimits(raw)
+	require.NoError(t, err)
+
+	assert.False(t, limits.RSS.Soft.Exists())
+	assert.False(t, limits.RSS.Hard.Exists())
+	assert.Equal(t, uint64(63422), limits.NProc.Soft.ValueOr(0))
+	assert.Equal(t, uint64(1024), limits.NOFile.Soft.ValueOr(0))
+	assert.Equal(t, uint64(524288), limits.NOFile.Hard.ValueOr(0))
+	assert.Equal(t, uint64(8589934592), limits.AS.Soft.ValueOr(0))
+	assert.False(t, limits.AS.Hard.Exists())
+}
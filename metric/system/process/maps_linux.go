@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getNumMaps returns the number of memory mappings of a process, which is the number of lines in /proc/[PID]/maps.
+// The kernel builds the file on every read, so it's costly for processes with many mappings.
+func getNumMaps(hostfs resolve.Resolver, pid int) (opt.Uint, error) {
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "maps")
+	data, err := readerFor(hostfs).ReadFile(path)
+	if err != nil {
+		return opt.NewUintNone(), fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return opt.UintWith(uint64(bytes.Count(data, []byte{'\n'}))), nil
+}
+
+// GetMaxMapCount returns the most memory mappings a process may have, from /proc/sys/vm/max_map_count.
+// Allocations fail once a process reaches it, which usually crashes the process.
+func GetMaxMapCount(hostfs resolve.Resolver) (int, error) {
+	path := resolve.ProcPath(hostfs, "sys", "vm", "max_map_count")
+	data, err := readerFor(hostfs).ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	maxMapCount, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return maxMapCount, nil
+}
@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestNumMaps(t *testing.T) {
+	testConfig := Stats{
+		Procs:      []string{".*"},
+		Hostfs:     resolve.NewTestResolver("/"),
+		EnableMaps: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Greater(t, self.Memory.NumMaps.ValueOr(0), uint64(0))
+
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.files["proc/4242/maps"] = &fstest.MapFile{Data: []byte(
+		"55d0c8a00000-55d0c8a02000 r--p 00000000 fd:01 1234 /usr/bin/synthetic\n" +
+			"7ffd1c5e0000-7ffd1c601000 rw-p 00000000 00:00 0 [stack]\n" +
+			"ffffffffff600000-ffffffffff601000 --xp 00000000 00:00 0 [vsyscall]\n")}
+	testConfig.Hostfs = procfs
+	require.NoError(t, testConfig.Init())
+
+	proc, err := testConfig.GetOne(4242)
+	require.NoError(t, err)
+	numMaps, err := proc.GetValue("memory.num_maps")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), numMaps)
+
+	// not collected unless enabled
+	testConfig.EnableMaps = false
+	require.NoError(t, testConfig.Init())
+	proc, err = testConfig.GetOne(4242)
+	require.NoError(t, err)
+	_, err = proc.GetValue("memory.num_maps")
+	assert.Error(t, err)
+}
+
+func TestGetMaxMapCount(t *testing.T) {
+	maxMapCount, err := GetMaxMapCount(resolve.NewTestResolver("/"))
+	require.NoError(t, err)
+	assert.Greater(t, maxMapCount, 0)
+
+	procfs := newMemProcFS()
+	procfs.files["proc/sys/vm/max_map_count"] = &fstest.MapFile{Data: []byte("262144\n")}
+	maxMapCount, err = GetMaxMapCount(procfs)
+	require.NoError(t, err)
+	assert.Equal(t, 262144, maxMapCount)
+}
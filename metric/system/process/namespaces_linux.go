@@ -0,0 +1,68 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// namespaceTypes are the namespaces read from /proc/PID/ns
+var namespaceTypes = []string{"pid", "net", "mnt", "uts", "ipc", "user", "cgroup"}
+
+// getNamespaces returns the inode numbers of the namespaces a process is in, from the /proc/PID/ns symlinks.
+// Processes share a namespace if they have the same inode for it. Types the kernel doesn't support are left out.
+func getNamespaces(hostfs resolve.Resolver, pid int) (map[string]uint64, error) {
+	var namespaces map[string]uint64
+	for _, nsType := range namespaceTypes {
+		path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "ns", nsType)
+		link, err := readerFor(hostfs).Readlink(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading link %s: %w", path, err)
+		}
+		inode, err := parseNamespaceLink(link, nsType)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing link %s: %w", path, err)
+		}
+		if namespaces == nil {
+			namespaces = make(map[string]uint64, len(namespaceTypes))
+		}
+		namespaces[nsType] = inode
+	}
+	return namespaces, nil
+}
+
+// parseNamespaceLink parses the inode number from a namespace link, such as net:[4026531840]
+func parseNamespaceLink(link, nsType string) (uint64, error) {
+	inode := strings.TrimPrefix(link, nsType+":[")
+	if inode == link || !strings.HasSuffix(inode, "]") {
+		return 0, fmt.Errorf("unexpected namespace link '%s'", link)
+	}
+	return strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64)
+}
@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetNamespaces(t *testing.T) {
+	testConfig := Stats{
+		Procs:            []string{".*"},
+		Hostfs:           resolve.NewTestResolver("/"),
+		EnableNamespaces: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.NotZero(t, self.Namespaces["net"])
+	assert.NotZero(t, self.Namespaces["mnt"])
+
+	event, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	net, err := event.GetValue("namespaces.net")
+	require.NoError(t, err)
+	assert.Equal(t, self.Namespaces["net"], net)
+}
+
+func TestGetNamespacesShared(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.addProc("4243", 100)
+	// both processes are in the same network namespace, but the second has its own pid namespace.
+	// The kernel has no time namespace support, so it's left out.
+	procfs.links["/proc/4242/ns/net"] = "net:[4026531840]"
+	procfs.links["/proc/4242/ns/pid"] = "pid:[4026531836]"
+	procfs.links["/proc/4243/ns/net"] = "net:[4026531840]"
+	procfs.links["/proc/4243/ns/pid"] = "pid:[4026532001]"
+
+	testConfig := Stats{
+		Procs:            []string{".*"},
+		Hostfs:           procfs,
+		EnableNamespaces: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	first, _, err := testConfig.pidFill(4242, false)
+	require.NoError(t, err)
+	second, _, err := testConfig.pidFill(4243, false)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"net": 4026531840, "pid": 4026531836}, first.Namespaces)
+	assert.Equal(t, first.Namespaces["net"], second.Namespaces["net"])
+	assert.NotEqual(t, first.Namespaces["pid"], second.Namespaces["pid"])
+
+	procfs.links["/proc/4243/ns/net"] = "4026531840"
+	_, _, err = testConfig.pidFill(4243, false)
+	require.Error(t, err)
+}
@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build (darwin && cgo) || freebsd || linux || windows || aix
+// +build darwin,cgo freebsd linux windows aix
+
+// Package otelexport reports the process metrics from process.Stats through OpenTelemetry instruments.
+package otelexport
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/process"
+)
+
+// instrumentDef describes an instrument, and the key in the process events it's read from
+type instrumentDef struct {
+	key  string
+	name string
+	unit string
+	desc string
+}
+
+// The ticks are only reported if Stats.CPUTicks is set
+var tickCounters = []instrumentDef{
+	{key: "cpu.user.ticks", name: "process.cpu.user.ticks", unit: "ms", desc: "Time spent in user space."},
+	{key: "cpu.system.ticks", name: "process.cpu.system.ticks", unit: "ms", desc: "Time spent in kernel space."},
+	{key: "cpu.total.ticks", name: "process.cpu.total.ticks", unit: "ms", desc: "Total CPU time."},
+}
+
+var intGauges = []instrumentDef{
+	{key: "memory.size", name: "process.memory.size", unit: "By", desc: "Total virtual memory."},
+	{key: "memory.share", name: "process.memory.share", unit: "By", desc: "Shared memory."},
+	{key: "memory.rss.bytes", name: "process.memory.rss.bytes", unit: "By", desc: "Resident set size."},
+	{key: "fd.open", name: "process.fd.open", unit: "{file_descriptor}", desc: "Number of open file descriptors."},
+}
+
+var floatGauges = []instrumentDef{
+	{key: "cpu.total.pct", name: "process.cpu.total.pct", unit: "1", desc: "CPU usage since the last sample, as a fraction of a single core."},
+	{key: "cpu.total.norm.pct", name: "process.cpu.total.norm.pct", unit: "1", desc: "CPU usage since the last sample, normalized by the number of cores."},
+	{key: "memory.rss.pct", name: "process.memory.rss.pct", unit: "1", desc: "Resident set size as a fraction of total physical memory."},
+}
+
+type intInstrument struct {
+	key        string
+	observable metric.Int64Observable
+}
+
+type floatInstrument struct {
+	key        string
+	observable metric.Float64Observable
+}
+
+// Register creates the process instruments on the given meter, and registers a callback that fetches the
+// configured processes from stats on every collection. stats must already be initialized with Init().
+// Ticks are reported as observable counters, and memory, FD and percentage values as observable gauges.
+func Register(meter metric.Meter, stats *process.Stats) (metric.Registration, error) {
+	ints := []intInstrument{}
+	floats := []floatInstrument{}
+	observables := []metric.Observable{}
+
+	for _, def := range tickCounters {
+		counter, err := meter.Int64ObservableCounter(def.name, metric.WithUnit(def.unit), metric.WithDescription(def.desc))
+		if err != nil {
+			return nil, fmt.Errorf("error creating counter %s: %w", def.name, err)
+		}
+		ints = append(ints, intInstrument{key: def.key, observable: counter})
+		observables = append(observables, counter)
+	}
+	for _, def := range intGauges {
+		gauge, err := meter.Int64ObservableGauge(def.name, metric.WithUnit(def.unit), metric.WithDescription(def.desc))
+		if err != nil {
+			return nil, fmt.Errorf("error creating gauge %s: %w", def.name, err)
+		}
+		ints = append(ints, intInstrument{key: def.key, observable: gauge})
+		observables = append(observables, gauge)
+	}
+	for _, def := range floatGauges {
+		gauge, err := meter.Float64ObservableGauge(def.name, metric.WithUnit(def.unit), metric.WithDescription(def.desc))
+		if err != nil {
+			return nil, fmt.Errorf("error creating gauge %s: %w", def.name, err)
+		}
+		floats = append(floats, floatInstrument{key: def.key, observable: gauge})
+		observables = append(observables, gauge)
+	}
+
+	callback := func(_ context.Context, observer metric.Observer) error {
+		procs, roots, err := stats.Get()
+		if err != nil {
+			return fmt.Errorf("error fetching processes: %w", err)
+		}
+		if len(procs) != len(roots) {
+			return fmt.Errorf("got %d process events but %d root events", len(procs), len(roots))
+		}
+
+		for i, proc := range procs {
+			attrs := metric.WithAttributes(processAttributes(roots[i])...)
+			for _, inst := range ints {
+				if value, ok := getInt(proc, inst.key); ok {
+					observer.ObserveInt64(inst.observable, value, attrs)
+				}
+			}
+			for _, inst := range floats {
+				if value, ok := getFloat(proc, inst.key); ok {
+					observer.ObserveFloat64(inst.observable, value, attrs)
+				}
+			}
+		}
+		return nil
+	}
+
+	registration, err := meter.RegisterCallback(callback, observables...)
+	if err != nil {
+		return nil, fmt.Errorf("error registering process callback: %w", err)
+	}
+	return registration, nil
+}
+
+// processAttributes returns the identifying attributes for a process from its root event
+func processAttributes(root mapstr.M) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{}
+	if pid, ok := getInt(root, "process.pid"); ok {
+		attrs = append(attrs, attribute.Int64("process.pid", pid))
+	}
+	if name, err := root.GetValue("process.name"); err == nil {
+		attrs = append(attrs, attribute.String("process.name", fmt.Sprint(name)))
+	}
+	return attrs
+}
+
+func getInt(event mapstr.M, key string) (int64, bool) {
+	raw, err := event.GetValue(key)
+	if err != nil {
+		return 0, false
+	}
+	switch val := raw.(type) {
+	case int:
+		return int64(val), true
+	case int64:
+		return val, true
+	case uint64:
+		return int64(val), true
+	}
+	return 0, false
+}
+
+func getFloat(event mapstr.M, key string) (float64, bool) {
+	raw, err := event.GetValue(key)
+	if err != nil {
+		return 0, false
+	}
+	switch val := raw.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	}
+	return 0, false
+}
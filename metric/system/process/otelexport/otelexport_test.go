@@ -0,0 +1,89 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build (darwin && cgo) || freebsd || linux || windows
+// +build darwin,cgo freebsd linux windows
+
+package otelexport
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/process"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestRegister(t *testing.T) {
+	stats := process.Stats{
+		Procs:    []string{".*"},
+		Hostfs:   resolve.NewTestResolver("/"),
+		CPUTicks: true,
+	}
+	require.NoError(t, stats.Init())
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	registration, err := Register(provider.Meter("test"), &stats)
+	require.NoError(t, err)
+	defer func() {
+		_ = registration.Unregister()
+	}()
+
+	rm := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+
+	byName := map[string]metricdata.Metrics{}
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		byName[m.Name] = m
+	}
+
+	ticks, ok := byName["process.cpu.total.ticks"]
+	require.True(t, ok, "missing process.cpu.total.ticks")
+	sum, ok := ticks.Data.(metricdata.Sum[int64])
+	require.True(t, ok, "expected a sum, got %T", ticks.Data)
+	assert.True(t, sum.IsMonotonic)
+	assert.NotEmpty(t, sum.DataPoints)
+
+	rss, ok := byName["process.memory.rss.bytes"]
+	require.True(t, ok, "missing process.memory.rss.bytes")
+	gauge, ok := rss.Data.(metricdata.Gauge[int64])
+	require.True(t, ok, "expected a gauge, got %T", rss.Data)
+
+	// The test process should be reported, with its PID and name as attributes
+	self := int64(os.Getpid())
+	found := false
+	for _, point := range gauge.DataPoints {
+		pid, ok := point.Attributes.Value(attribute.Key("process.pid"))
+		require.True(t, ok)
+		_, ok = point.Attributes.Value(attribute.Key("process.name"))
+		assert.True(t, ok)
+		if pid.AsInt64() == self {
+			found = true
+			assert.Greater(t, point.Value, int64(0))
+		}
+	}
+	assert.True(t, found, "pid %d not found", self)
+}
@@ -0,0 +1,43 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetPIDMax(t *testing.T) {
+	pidMax, err := GetPIDMax(resolve.NewTestResolver("/"))
+	require.NoError(t, err)
+	assert.Greater(t, pidMax, 1)
+
+	procfs := newMemProcFS()
+	procfs.files["proc/sys/kernel/pid_max"] = &fstest.MapFile{Data: []byte("4194304\n")}
+	pidMax, err = GetPIDMax(procfs)
+	require.NoError(t, err)
+	assert.Equal(t, 4194304, pidMax)
+}
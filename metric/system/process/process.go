@@ -22,11 +22,12 @@ package process
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"sort"
 	"strings"
-	"time"
+	"unicode/utf8"
 
 	psutil "github.com/shirou/gopsutil/process"
 
@@ -34,7 +35,7 @@ import (
 	"github.com/elastic/elastic-agent-libs/opt"
 	"github.com/elastic/elastic-agent-libs/transform/typeconv"
 	"github.com/elastic/elastic-agent-system-metrics/metric"
-	"github.com/elastic/elastic-agent-system-metrics/metric/system/network"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 	"github.com/elastic/go-sysinfo"
 	sysinfotypes "github.com/elastic/go-sysinfo/types"
@@ -62,8 +63,105 @@ func ListStates(hostfs resolve.Resolver) ([]ProcState, error) {
 	return plist, nil
 }
 
+// MatchingPIDs returns the processes whose names match Procs, with only the basic PID info filled out.
+// This is much cheaper than Get, as no other metrics are read. MaxProcs and IncludeTop aren't applied,
+// and with MatchCmdline, processes are still only matched by name, as the command line isn't read.
+func (procStats *Stats) MatchingPIDs() ([]ProcState, error) {
+	if len(procStats.Procs) == 0 {
+		return nil, nil
+	}
+
+	matcher := *procStats
+	matcher.skipExtended = true
+	matcher.MaxProcs = 0
+	_, plist, err := matcher.FetchPids()
+	if err != nil {
+		return nil, fmt.Errorf("error gathering PIDs: %w", err)
+	}
+	return plist, nil
+}
+
+// SummarizeStates counts the given processes by state, such as the list returned by ListStates
+func SummarizeStates(procs []ProcState) StateSummary {
+	summary := StateSummary{Total: len(procs)}
+	for _, proc := range procs {
+		switch proc.State {
+		case Running:
+			summary.Running++
+		case Sleeping:
+			summary.Sleeping++
+		case Idle:
+			summary.Idle++
+		case DiskSleep:
+			summary.DiskSleep++
+		case Stopped:
+			summary.Stopped++
+		case Zombie:
+			summary.Zombie++
+		case Dead:
+			summary.Dead++
+		default:
+			summary.Unknown++
+		}
+	}
+	return summary
+}
+
+// AggregateGroup rolls the given processes, such as those sharing a name or cgroup, up into a single ProcState.
+// The counters are summed, and so are the CPU and memory percentages, as they share a denominator across processes.
+// A metric is only set in the result if it's set in at least one of the processes.
+// The name and username are kept if all the processes share them; per-process fields such as the PID are left unset.
+func AggregateGroup(procs []ProcState) ProcState {
+	group := ProcState{}
+	for i, proc := range procs {
+		if i == 0 {
+			group.Name = proc.Name
+			group.Username = proc.Username
+		}
+		if group.Name != proc.Name {
+			group.Name = ""
+		}
+		if group.Username != proc.Username {
+			group.Username = ""
+		}
+		if proc.SampleTime.After(group.SampleTime) {
+			group.SampleTime = proc.SampleTime
+		}
+
+		group.CPU.Total.Value = sumFloat(group.CPU.Total.Value, proc.CPU.Total.Value)
+		group.CPU.Total.Ticks = sumUint(group.CPU.Total.Ticks, proc.CPU.Total.Ticks)
+		group.CPU.Total.Pct = sumFloat(group.CPU.Total.Pct, proc.CPU.Total.Pct)
+		group.CPU.Total.Norm.Pct = sumFloat(group.CPU.Total.Norm.Pct, proc.CPU.Total.Norm.Pct)
+		group.CPU.User.Ticks = sumUint(group.CPU.User.Ticks, proc.CPU.User.Ticks)
+		group.CPU.System.Ticks = sumUint(group.CPU.System.Ticks, proc.CPU.System.Ticks)
+		group.CPU.IOWait.Ticks = sumUint(group.CPU.IOWait.Ticks, proc.CPU.IOWait.Ticks)
+		group.CPU.Children.Total.Ticks = sumUint(group.CPU.Children.Total.Ticks, proc.CPU.Children.Total.Ticks)
+		group.CPU.Children.User.Ticks = sumUint(group.CPU.Children.User.Ticks, proc.CPU.Children.User.Ticks)
+		group.CPU.Children.System.Ticks = sumUint(group.CPU.Children.System.Ticks, proc.CPU.Children.System.Ticks)
+
+		group.Memory.Size = sumUint(group.Memory.Size, proc.Memory.Size)
+		group.Memory.Share = sumUint(group.Memory.Share, proc.Memory.Share)
+		group.Memory.Rss.Bytes = sumUint(group.Memory.Rss.Bytes, proc.Memory.Rss.Bytes)
+		group.Memory.Rss.Pct = sumFloat(group.Memory.Rss.Pct, proc.Memory.Rss.Pct)
+		group.Memory.MinFlt = sumUint(group.Memory.MinFlt, proc.Memory.MinFlt)
+		group.Memory.MajFlt = sumUint(group.Memory.MajFlt, proc.Memory.MajFlt)
+		group.Memory.ChildMinFlt = sumUint(group.Memory.ChildMinFlt, proc.Memory.ChildMinFlt)
+		group.Memory.ChildMajFlt = sumUint(group.Memory.ChildMajFlt, proc.Memory.ChildMajFlt)
+		group.Memory.NumMaps = sumUint(group.Memory.NumMaps, proc.Memory.NumMaps)
+
+		group.FD.Open = sumUint(group.FD.Open, proc.FD.Open)
+		group.IO.ReadBytes = sumUint(group.IO.ReadBytes, proc.IO.ReadBytes)
+		group.IO.WriteBytes = sumUint(group.IO.WriteBytes, proc.IO.WriteBytes)
+		group.IO.SyscallRead = sumUint(group.IO.SyscallRead, proc.IO.SyscallRead)
+		group.IO.SyscallWrite = sumUint(group.IO.SyscallWrite, proc.IO.SyscallWrite)
+		group.GPU.MemoryBytes = sumUint(group.GPU.MemoryBytes, proc.GPU.MemoryBytes)
+		group.GPU.UtilizationPct = sumFloat(group.GPU.UtilizationPct, proc.GPU.UtilizationPct)
+	}
+	return group
+}
+
 // GetPIDState returns the state of a given PID
-// It will return ProcNotExist if the process was not found.
+// It will return ErrProcNotExist if the process was not found.
 func GetPIDState(hostfs resolve.Resolver, pid int) (PidState, error) {
 	// This library still doesn't have a good cross-platform way to distinguish between "does not eixst" and other process errors.
 	// This is a fairly difficult problem to solve in a cross-platform way
@@ -72,7 +170,7 @@ func GetPIDState(hostfs resolve.Resolver, pid int) (PidState, error) {
 		return "", fmt.Errorf("Error trying to find process: %d: %w", pid, err)
 	}
 	if !exists {
-		return "", ProcNotExist
+		return "", ErrProcNotExist
 	}
 	//GetInfoForPid will return the smallest possible dataset for a PID
 	procState, err := GetInfoForPid(hostfs, pid)
@@ -85,22 +183,80 @@ func GetPIDState(hostfs resolve.Resolver, pid int) (PidState, error) {
 
 // Get fetches the configured processes and returns a list of formatted events and root ECS fields
 func (procStats *Stats) Get() ([]mapstr.M, []mapstr.M, error) {
+	_, procs, rootEvents, err := procStats.getProcesses()
+	return procs, rootEvents, err
+}
+
+// GetByCgroup fetches the configured processes and returns their formatted events, keyed by cgroup path.
+// This requires EnableCgroups; processes without cgroup data are reported under an empty key.
+func (procStats *Stats) GetByCgroup() (map[string][]mapstr.M, error) {
+	if !procStats.EnableCgroups {
+		return nil, errors.New("GetByCgroup requires EnableCgroups")
+	}
+	plist, procs, _, err := procStats.getProcesses()
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := map[string][]mapstr.M{}
+	for i, process := range plist {
+		path := cgroupPath(process.Cgroup)
+		grouped[path] = append(grouped[path], procs[i])
+	}
+	return grouped, nil
+}
+
+// cgroupPath returns the path of the cgroup a process belongs to, or an empty string if it has none
+func cgroupPath(stats cgroup.CGStats) string {
+	switch cg := stats.(type) {
+	case *cgroup.StatsV1:
+		return cg.Path
+	case *cgroup.StatsV2:
+		return cg.Path
+	}
+	return ""
+}
+
+// getProcesses fetches the configured processes, and returns them along with their formatted events and root ECS fields.
+// The returned slices are in the same order.
+func (procStats *Stats) getProcesses() ([]ProcState, []mapstr.M, []mapstr.M, error) {
 	//If the user hasn't configured any kind of process glob, return
 	if len(procStats.Procs) == 0 {
-		return nil, nil, nil
+		return nil, nil, nil, nil
+	}
+
+	procStats.resetCgroupCache()
+	procStats.gpuUsage = nil
+	procStats.truncated = false
+	procStats.collection = CollectionStats{}
+	if procStats.Counters != nil {
+		// drop anything left over from a collection that failed partway
+		procStats.Counters.next = nil
 	}
+	start := procStats.now()
+	defer func() {
+		procStats.collection.Duration = procStats.now().Sub(start)
+	}()
 
 	// actually fetch the PIDs from the OS-specific code
 	pidMap, plist, err := procStats.FetchPids()
 
 	if err != nil {
-		return nil, nil, fmt.Errorf("error gathering PIDs: %w", err)
+		return nil, nil, nil, fmt.Errorf("error gathering PIDs: %w", err)
 	}
 	// We use this to track processes over time.
+	// Replacing the whole map prunes any PIDs that weren't seen in this collection,
+	// including any added by GetOne(), so the map doesn't grow on hosts with a lot of process churn.
 	procStats.ProcsMap.SetMap(pidMap)
 
 	// filter the process list that will be passed down to users
 	plist = procStats.includeTopProcesses(plist)
+	if procStats.MaxProcs > 0 && len(plist) > procStats.MaxProcs {
+		plist = plist[:procStats.MaxProcs]
+		procStats.truncated = true
+	}
+	procStats.collection.Filtered += len(pidMap) - len(plist)
+	procStats.collection.Emitted = len(plist)
 
 	// This is a holdover until we migrate this library to metricbeat/internal
 	// At which point we'll use the memory code there.
@@ -122,67 +278,171 @@ func (procStats *Stats) Get() ([]mapstr.M, []mapstr.M, error) {
 	for _, process := range plist {
 		process := process
 		// Add the RSS pct memory first
-		process.Memory.Rss.Pct = GetProcMemPercentage(process, totalPhyMem)
+		if procStats.wantField("memory") {
+			process.Memory.Rss.Pct = GetProcMemPercentage(process, totalPhyMem)
+			process.Memory.Rss.CgroupPct = GetProcCgroupMemPercentage(process, totalPhyMem)
+		}
 		//Create the root event
 		root := process.FormatForRoot()
 		rootMap := mapstr.M{}
 		_ = typeconv.Convert(&rootMap, root)
+		if procStats.truncated {
+			_, _ = rootMap.Put("process.truncated", true)
+		}
 
 		proc, err := procStats.getProcessEvent(&process)
 		if err != nil {
-			return nil, nil, fmt.Errorf("error converting process for pid %d: %w", process.Pid.ValueOr(0), err)
+			return nil, nil, nil, fmt.Errorf("error converting process for pid %d: %w", process.Pid.ValueOr(0), err)
+		}
+		if procStats.Counters != nil {
+			if rates := procStats.Counters.rates(process.EntityID, process.SampleTime, proc); len(rates) > 0 {
+				proc["rates"] = rates
+			}
 		}
 
 		procs = append(procs, proc)
 		rootEvents = append(rootEvents, rootMap)
 	}
 
-	return procs, rootEvents, nil
+	if procStats.Counters != nil {
+		procStats.Counters.commit()
+	}
+
+	return plist, procs, rootEvents, nil
+}
+
+// LastCollectionStats describes the most recent call to Get, such as how long it took, and how many processes were left out.
+func (procStats *Stats) LastCollectionStats() CollectionStats {
+	return procStats.collection
 }
 
 // GetOne fetches process data for a given PID if its name matches the regexes provided from the host.
 func (procStats *Stats) GetOne(pid int) (mapstr.M, error) {
+	pidStat, err := procStats.GetOneTyped(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return procStats.getProcessEvent(&pidStat)
+}
+
+// GetOneTyped is GetOne, returning the process data as a ProcState instead of a formatted event.
+func (procStats *Stats) GetOneTyped(pid int) (ProcState, error) {
+	procStats.resetCgroupCache()
+	procStats.gpuUsage = nil
 	pidStat, _, err := procStats.pidFill(pid, false)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching PID %d: %w", pid, err)
+		return ProcState{}, fmt.Errorf("error fetching PID %d: %w", pid, err)
 	}
+	procStats.enrich(&pidStat)
 
 	procStats.ProcsMap.SetPid(pid, pidStat)
-
-	return procStats.getProcessEvent(&pidStat)
+	return pidStat, nil
 }
 
 // GetSelf gets process info for the beat itself
+// If Init found that procfs isn't available, only the metrics that can be found with syscalls are reported.
 func (procStats *Stats) GetSelf() (ProcState, error) {
-	self := os.Getpid()
-
-	pidStat, _, err := procStats.pidFill(self, false)
-	if err != nil {
-		return ProcState{}, fmt.Errorf("error fetching PID %d: %w", self, err)
+	if procStats.noProcfs {
+		return selfState(procStats.now())
 	}
+	return procStats.GetOneTyped(os.Getpid())
+}
 
-	procStats.ProcsMap.SetPid(self, pidStat)
-	return pidStat, nil
+// resetCgroupCache starts a new collection cycle for the cgroup reader,
+// so cgroup stats are read again instead of reusing those from the last call.
+func (procStats *Stats) resetCgroupCache() {
+	if procStats.EnableCgroups {
+		procStats.cgroups.ResetCache()
+	}
 }
 
 // pidIter wraps a few lines of generic code that all OS-specific FetchPids() functions must call.
 // this also handles the process of adding to the maps/lists in order to limit the code duplication in all the OS implementations
 func (procStats *Stats) pidIter(pid int, procMap ProcsMap, proclist []ProcState) (ProcsMap, []ProcState) {
-	status, saved, err := procStats.pidFill(pid, true)
+	procStats.collection.Seen++
+	// Without IncludeTop there's nothing to rank, so we can stop collecting once we're at the cap.
+	// The remaining processes are only checked until we know at least one of them would have been reported.
+	if procStats.MaxProcs > 0 && !procStats.IncludeTop.active() && len(proclist) >= procStats.MaxProcs {
+		if !procStats.truncated && !(procStats.ExcludeSelf && pid == os.Getpid()) {
+			status, err := GetInfoForPid(procStats.Hostfs, pid)
+			procStats.truncated = err == nil && (procStats.skipExtended || procStats.matchProcess(status.Name)) &&
+				!(procStats.SkipKernelThreads && isKernelThread(procStats.Hostfs, status))
+		}
+		procStats.collection.Filtered++
+		return procMap, proclist
+	}
+
+	status, saved, err := procStats.pidFillWithTimeout(pid, true)
 	if err != nil {
-		procStats.logger.Debugf("Error fetching PID info for %d, skipping: %s", pid, err)
+		// Processes exiting while we collect are expected, so skip them quietly
+		if errors.Is(err, context.DeadlineExceeded) {
+			procStats.logger.Warnf("Timed out fetching PID info for %d, skipping: %s", pid, err)
+		} else if !errors.Is(err, ErrProcNotExist) {
+			procStats.logger.Debugf("Error fetching PID info for %d, skipping: %s", pid, err)
+		}
+		procStats.collection.Errors.add(err)
 		return procMap, proclist
 	}
 	if !saved {
+		procStats.collection.Filtered++
 		procStats.logger.Debugf("Process name does not match the provided regex; PID=%d; name=%s", pid, status.Name)
 		return procMap, proclist
 	}
+	if !procStats.skipExtended {
+		procStats.enrich(&status)
+	}
 	procMap[pid] = status
 	proclist = append(proclist, status)
 
 	return procMap, proclist
 }
 
+// add counts a process that was skipped because of the given error
+func (errs *CollectionErrors) add(err error) {
+	switch {
+	case errors.Is(err, ErrProcNotExist):
+		errs.Exited++
+	case errors.Is(err, ErrProcPermission):
+		errs.Permission++
+	case errors.Is(err, context.DeadlineExceeded):
+		errs.Timeout++
+	default:
+		errs.Other++
+	}
+}
+
+// pidFillWithTimeout calls pidFill, giving up once PerProcTimeout has passed.
+// The fill keeps running in the background until whatever it's blocked on returns, and its result is thrown away,
+// so it works on a snapshot of procStats rather than racing with the fills that come after it.
+func (procStats *Stats) pidFillWithTimeout(pid int, filter bool) (ProcState, bool, error) {
+	if procStats.PerProcTimeout <= 0 {
+		return procStats.pidFill(pid, filter)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), procStats.PerProcTimeout)
+	defer cancel()
+
+	type fillResult struct {
+		status ProcState
+		saved  bool
+		err    error
+	}
+	// buffered, so the fill can finish after we've stopped waiting for it
+	done := make(chan fillResult, 1)
+	snapshot := procStats.fillSnapshot(pid)
+	go func() {
+		status, saved, err := snapshot.pidFill(pid, filter)
+		done <- fillResult{status: status, saved: saved, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.status, res.saved, res.err
+	case <-ctx.Done():
+		return ProcState{}, true, fmt.Errorf("collection exceeded %s: %w", procStats.PerProcTimeout, ctx.Err())
+	}
+}
+
 // pidFill is an entrypoint used by OS-specific code to fill out a pid.
 // This in turn calls various OS-specific code to fill out the various bits of PID data
 // This is done to minimize the code duplication between different OS implementations
@@ -190,48 +450,79 @@ func (procStats *Stats) pidIter(pid int, procMap ProcsMap, proclist []ProcState)
 func (procStats *Stats) pidFill(pid int, filter bool) (ProcState, bool, error) {
 	// Fetch proc state so we can get the name for filtering based on user's filter.
 
+	if filter && procStats.ExcludeSelf && pid == os.Getpid() {
+		return ProcState{Pid: opt.IntWith(pid)}, false, nil
+	}
+
 	// OS-specific entrypoint, get basic info so we can at least run matchProcess
 	status, err := GetInfoForPid(procStats.Hostfs, pid)
 	if err != nil {
-		return status, true, fmt.Errorf("GetInfoForPid: %w", err)
+		return status, true, fmt.Errorf("GetInfoForPid: %w", toProcError(err))
+	}
+	if filter && procStats.SkipKernelThreads && isKernelThread(procStats.Hostfs, status) {
+		return status, false, nil
 	}
 	if procStats.skipExtended {
-		return status, true, nil
+		return status, !filter || procStats.matchProcess(status.Name), nil
 	}
 	status = procStats.cacheCmdLine(status)
 
 	// Filter based on user-supplied func
-	if filter {
-		if !procStats.matchProcess(status.Name) {
-			return status, false, nil
-		}
+	// With MatchCmdline, processes that don't match by name are filtered once we have the command line.
+	nameMatched := !filter || procStats.matchProcess(status.Name)
+	if !nameMatched && !procStats.MatchCmdline {
+		return status, false, nil
 	}
 
 	//If we've passed the filter, continue to fill out the rest of the metrics
-	status, err = FillPidMetrics(procStats.Hostfs, pid, status, procStats.isWhitelistedEnvVar)
+	envFilter := procStats.isWhitelistedEnvVar
+	if !procStats.wantField("env") {
+		envFilter = func(string) bool { return false }
+	}
+	status, err = FillPidMetrics(procStats.Hostfs, pid, status, envFilter)
 	if err != nil {
-		return status, true, fmt.Errorf("FillPidMetrics: %w", err)
+		return status, true, fmt.Errorf("FillPidMetrics: %w", toProcError(err))
 	}
+	status.Name = rewriteName(procStats.nameRewrites, status.Name)
+	status.EntityID = entityID(pid, status.CPU.StartTime, procStats.bootID)
 	if len(status.Args) > 0 && status.Cmdline == "" {
 		status.Cmdline = strings.Join(status.Args, " ")
 	}
+	if !nameMatched && !procStats.matchProcess(status.Cmdline) {
+		return status, false, nil
+	}
+	status = prefixCmdline(status, procStats.CmdlinePrefixLen)
+	status = truncateCmdline(status, procStats.MaxCmdlineBytes)
+	if !procStats.IncludeChildStats {
+		status.CPU.Children = ChildCPUInfo{}
+	}
 
 	//postprocess with cgroups and percentages
 	last, ok := procStats.ProcsMap.GetPid(status.Pid.ValueOr(0))
-	status.SampleTime = time.Now()
-	if procStats.EnableCgroups {
+	// a PID that's been reused by a new process, or a process restarted with the same PID, has nothing to compare against
+	ok = ok && last.EntityID == status.EntityID
+	status.SampleTime = procStats.now()
+	if ok && procStats.DetectEnvChanges && procStats.wantField("env") {
+		status.EnvChangedKeys = changedEnvKeys(last.Env, status.Env)
+		status.EnvChanged = len(status.EnvChangedKeys) > 0
+	}
+	if procStats.EnableCgroups && procStats.wantField("cgroup") {
 		cgStats, err := procStats.cgroups.GetStatsForPid(status.Pid.ValueOr(0))
 		if err != nil {
-			return status, true, fmt.Errorf("cgroups.GetStatsForPid: %w", err)
+			return status, true, fmt.Errorf("cgroups.GetStatsForPid: %w", toProcError(err))
 		}
 		status.Cgroup = cgStats
-		if ok {
+		path := cgroupPath(cgStats)
+		status.Runtime = cgroup.ContainerRuntime(path)
+		status.ContainerID = cgroup.ContainerID(path)
+		status.PodUID = cgroup.PodUID(path)
+		if ok && status.Cgroup != nil {
 			status.Cgroup.FillPercentages(last.Cgroup, status.SampleTime, last.SampleTime)
 		}
 	} // end cgroups processor
 
 	// network data
-	if procStats.EnableNetwork {
+	if procStats.EnableNetwork && procStats.wantField("network") {
 		procHandle, err := sysinfo.Process(pid)
 		// treat this as a soft error
 		if err != nil {
@@ -243,33 +534,217 @@ func (procStats *Stats) pidFill(pid int, filter bool) (ProcState, bool, error) {
 				if err != nil {
 					procStats.logger.Debugf("error fetching network counters for process %d: %w", pid, err)
 				}
+				status.NetworkIPv6, err = procStats.getIPv6Counters(pid)
+				if err != nil {
+					procStats.logger.Debugf("error fetching IPv6 network counters for process %d: %v", pid, err)
+				}
 			}
 		}
 	}
 
+	if procStats.EnableLimits && procStats.wantField("limits") {
+		status.Limits, err = getLimits(procStats.Hostfs, pid)
+		if err != nil && !errors.Is(err, ErrNotImplemented) {
+			return status, true, fmt.Errorf("getLimits: %w", toProcError(err))
+		}
+	}
+
+	if procStats.EnableIO && procStats.wantField("io") {
+		status.IO, err = getIO(procStats.Hostfs, pid)
+		if err != nil && !errors.Is(err, ErrNotImplemented) && !errors.Is(err, os.ErrPermission) {
+			return status, true, fmt.Errorf("getIO: %w", toProcError(err))
+		}
+	}
+
+	if procStats.EnableRoot && procStats.wantField("root") {
+		status.Root, err = getRoot(procStats.Hostfs, pid)
+		if err != nil && !errors.Is(err, ErrNotImplemented) && !errors.Is(err, os.ErrPermission) {
+			return status, true, fmt.Errorf("getRoot: %w", toProcError(err))
+		}
+	}
+
+	if procStats.EnableNamespaces && procStats.wantField("namespaces") {
+		status.Namespaces, err = getNamespaces(procStats.Hostfs, pid)
+		if err != nil && !errors.Is(err, ErrNotImplemented) && !errors.Is(err, os.ErrPermission) {
+			return status, true, fmt.Errorf("getNamespaces: %w", toProcError(err))
+		}
+	}
+
+	if procStats.EnableMaps && procStats.wantField("memory") {
+		status.Memory.NumMaps, err = getNumMaps(procStats.Hostfs, pid)
+		if err != nil && !errors.Is(err, ErrNotImplemented) && !errors.Is(err, os.ErrPermission) {
+			return status, true, fmt.Errorf("getNumMaps: %w", toProcError(err))
+		}
+	}
+
+	if procStats.SumTaskCPU && procStats.wantField("cpu") {
+		status.CPU, err = getTaskCPUTime(procStats.Hostfs, pid, status.CPU)
+		if err != nil && !errors.Is(err, ErrNotImplemented) && !errors.Is(err, os.ErrPermission) {
+			return status, true, fmt.Errorf("getTaskCPUTime: %w", toProcError(err))
+		}
+	}
+
+	if procStats.EnableGPU && procStats.wantField("gpu") {
+		status.GPU = procStats.gpuUsageFor(pid)
+	}
+
 	if status.CPU.Total.Ticks.Exists() {
 		status.CPU.Total.Value = opt.FloatWith(metric.Round(float64(status.CPU.Total.Ticks.ValueOr(0))))
 	}
 	if ok {
-		status = GetProcCPUPercentage(last, status)
+		status = procStats.fillCPUPercentage(last, status)
 	}
+	status = procStats.dropUnwantedFields(status)
 
 	return status, true, nil
 }
 
+// enrich runs the Enrichers on a filled process.
+// It's kept out of pidFill, so enrichers are never called from a fill that's been abandoned after a timeout.
+func (procStats *Stats) enrich(status *ProcState) {
+	for _, enrich := range procStats.Enrichers {
+		if err := enrich(status); err != nil {
+			procStats.logger.Warnf("error enriching process %d: %s", status.Pid.ValueOr(0), err)
+		}
+	}
+}
+
+// fillSnapshot returns a copy of procStats for filling pid that shares no mutable state with it:
+// it has its own ProcsMap, holding only the previous sample of pid, and the GPU usage of pid is read up front.
+func (procStats *Stats) fillSnapshot(pid int) *Stats {
+	snapshot := *procStats
+	snapshot.ProcsMap = NewProcsTrack()
+	if last, ok := procStats.ProcsMap.GetPid(pid); ok {
+		snapshot.ProcsMap.SetPid(pid, last)
+	}
+	if procStats.EnableGPU && procStats.wantField("gpu") {
+		snapshot.gpuUsage = map[int]ProcGPUInfo{pid: procStats.gpuUsageFor(pid)}
+	}
+	snapshot.Enrichers = nil
+	return &snapshot
+}
+
+// gpuUsageFor returns the GPU usage of a process.
+// NVML reports the usage of every process on a GPU at once, so it's only read once per collection.
+func (procStats *Stats) gpuUsageFor(pid int) ProcGPUInfo {
+	if procStats.gpuUsage == nil {
+		usage, err := getGPUUsage()
+		if err != nil {
+			if !errors.Is(err, ErrNotImplemented) {
+				procStats.logger.Debugf("error fetching GPU usage: %s", err)
+			}
+			usage = map[int]ProcGPUInfo{}
+		}
+		procStats.gpuUsage = usage
+	}
+	return procStats.gpuUsage[pid]
+}
+
+// fillCPUPercentage computes CPU percentages between the previous and current samples of a process.
+// If the current sample is within MinSampleInterval of the sample the previous percentages were computed from,
+// those percentages are reused, and that sample is kept as the base for the next computation.
+func (procStats *Stats) fillCPUPercentage(last, cur ProcState) ProcState {
+	base := last
+	if last.cpuBase != nil {
+		base = *last.cpuBase
+	}
+	if procStats.MinSampleInterval > 0 && cur.SampleTime.Sub(base.SampleTime) < procStats.MinSampleInterval {
+		cur.CPU.Total.Pct = last.CPU.Total.Pct
+		cur.CPU.Total.Norm.Pct = last.CPU.Total.Norm.Pct
+		cur.cpuBase = &ProcState{CPU: ProcCPUInfo{Total: base.CPU.Total}, SampleTime: base.SampleTime}
+		return cur
+	}
+	return GetProcCPUPercentage(base, cur)
+}
+
 // cacheCmdLine fills out Env and arg metrics from any stored previous metrics for the pid
 func (procStats *Stats) cacheCmdLine(in ProcState) ProcState {
 	if previousProc, ok := procStats.ProcsMap.GetPid(in.Pid.ValueOr(0)); ok {
 		if procStats.CacheCmdLine {
 			in.Args = previousProc.Args
 			in.Cmdline = previousProc.Cmdline
+			in.CmdlineTruncated = previousProc.CmdlineTruncated
+		}
+		// With DetectEnvChanges the environment is read every time, so it can be compared against the previous one
+		if !procStats.DetectEnvChanges {
+			in.Env = previousProc.Env
+		}
+		if procStats.CacheSelf && in.Pid.ValueOr(0) == os.Getpid() {
+			in.Username = previousProc.Username
+			in.Exe = previousProc.Exe
 		}
-		env := previousProc.Env
-		in.Env = env
 	}
 	return in
 }
 
+// dropUnwantedFields clears any metrics that aren't in Stats.Fields, so they aren't reported.
+// Metrics that come from the same OS call as a wanted field are still collected, but are removed here.
+func (procStats *Stats) dropUnwantedFields(in ProcState) ProcState {
+	if procStats.fields == nil {
+		return in
+	}
+	if !procStats.wantField("cpu") {
+		in.CPU = ProcCPUInfo{}
+	}
+	if !procStats.wantField("memory") {
+		in.Memory = ProcMemInfo{}
+	}
+	if !procStats.wantField("fd") {
+		in.FD = ProcFDInfo{}
+	}
+	if !procStats.wantField("cmdline") {
+		in.Args = nil
+		in.Cmdline = ""
+		in.CmdlineTruncated = false
+	}
+	if !procStats.wantField("env") {
+		in.Env = nil
+	}
+	if !procStats.wantField("cwd") {
+		in.Cwd = ""
+	}
+	if !procStats.wantField("exe") {
+		in.Exe = ""
+	}
+	if !procStats.wantField("username") {
+		in.Username = ""
+	}
+	return in
+}
+
+// cmdlineTruncatedMarker is appended to a command line that's been truncated
+const cmdlineTruncatedMarker = "..."
+
+// prefixCmdline drops all but the first n arguments from the args and command line.
+// The command line is marked as truncated if any of them were dropped.
+func prefixCmdline(in ProcState, n int) ProcState {
+	prefix, _ := ArgsPrefix(in.Args, n)
+	if len(prefix) == len(in.Args) {
+		return in
+	}
+	in.Args = prefix
+	in.Cmdline = strings.Join(prefix, " ")
+	in.CmdlineTruncated = true
+	return in
+}
+
+// truncateCmdline cuts the command line down to maxBytes, not counting the marker.
+// The cut is moved back to the start of a UTF-8 sequence, so we never emit a partial character.
+// A command line cached from a previous sample has already been cut, so it's left alone.
+func truncateCmdline(in ProcState, maxBytes int) ProcState {
+	alreadyCut := in.CmdlineTruncated && strings.HasSuffix(in.Cmdline, cmdlineTruncatedMarker)
+	if maxBytes <= 0 || alreadyCut || len(in.Cmdline) <= maxBytes {
+		return in
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(in.Cmdline[cut]) {
+		cut--
+	}
+	in.Cmdline = in.Cmdline[:cut] + cmdlineTruncatedMarker
+	in.CmdlineTruncated = true
+	return in
+}
+
 // return a formatted MapStr of the process metrics
 func (procStats *Stats) getProcessEvent(process *ProcState) (mapstr.M, error) {
 
@@ -278,16 +753,11 @@ func (procStats *Stats) getProcessEvent(process *ProcState) (mapstr.M, error) {
 		process.CPU.User.Ticks = opt.NewUintNone()
 		process.CPU.System.Ticks = opt.NewUintNone()
 		process.CPU.Total.Ticks = opt.NewUintNone()
+		process.CPU.IOWait.Ticks = opt.NewUintNone()
 	}
 
-	proc := mapstr.M{}
-	err := typeconv.Convert(&proc, process)
-
-	if procStats.EnableNetwork && process.Network != nil {
-		proc["network"] = network.MapProcNetCountersWithFilter(process.Network, procStats.NetworkMetrics)
-	}
-
-	return proc, err
+	// Network is only populated if EnableNetwork is set
+	return process.toMapStr(procStats.NetworkMetrics)
 }
 
 // matchProcess checks if the provided process name matches any of the process regexes
@@ -301,10 +771,9 @@ func (procStats *Stats) matchProcess(name string) bool {
 }
 
 // includeTopProcesses filters down the metrics based on top CPU or top Memory settings
+// Ties are broken by PID, lowest first, so the selection doesn't depend on the order of the input.
 func (procStats *Stats) includeTopProcesses(processes []ProcState) []ProcState {
-	if !procStats.IncludeTop.Enabled ||
-		(procStats.IncludeTop.ByCPU == 0 && procStats.IncludeTop.ByMemory == 0) {
-
+	if !procStats.IncludeTop.active() {
 		return processes
 	}
 
@@ -316,7 +785,11 @@ func (procStats *Stats) includeTopProcesses(processes []ProcState) []ProcState {
 		}
 
 		sort.Slice(processes, func(i, j int) bool {
-			return processes[i].CPU.Total.Pct.ValueOr(0) > processes[j].CPU.Total.Pct.ValueOr(0)
+			left, right := processes[i].CPU.Total.Pct.ValueOr(0), processes[j].CPU.Total.Pct.ValueOr(0)
+			if left == right {
+				return processes[i].Pid.ValueOr(0) < processes[j].Pid.ValueOr(0)
+			}
+			return left > right
 		})
 		result = append(result, processes[:numProcs]...)
 	}
@@ -328,7 +801,11 @@ func (procStats *Stats) includeTopProcesses(processes []ProcState) []ProcState {
 		}
 
 		sort.Slice(processes, func(i, j int) bool {
-			return processes[i].Memory.Rss.Bytes.ValueOr(0) > processes[j].Memory.Rss.Bytes.ValueOr(0)
+			left, right := processes[i].Memory.Rss.Bytes.ValueOr(0), processes[j].Memory.Rss.Bytes.ValueOr(0)
+			if left == right {
+				return processes[i].Pid.ValueOr(0) < processes[j].Pid.ValueOr(0)
+			}
+			return left > right
 		})
 		for _, proc := range processes[:numProcs] {
 			proc := proc
@@ -23,7 +23,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/user"
 	"strconv"
 	"syscall"
 	"unsafe"
@@ -99,12 +98,7 @@ func GetInfoForPid(_ resolve.Resolver, pid int) (ProcState, error) {
 
 	// Get process username. Fallback to UID if username is not available.
 	uid := strconv.Itoa(int(info.pi_uid))
-	userID, err := user.LookupId(uid)
-	if err == nil && userID.Username != "" {
-		state.Username = userID.Username
-	} else {
-		state.Username = uid
-	}
+	state.Username = lookupUsername(uid)
 
 	return state, nil
 }
@@ -195,3 +189,15 @@ func FillPidMetrics(_ resolve.Resolver, pid int, state ProcState, filter func(st
 
 	return state, nil
 }
+
+// getProcMem is used by GetProcRSS. The memory data comes from the same getprocs call as the rest of FillPidMetrics.
+func getProcMem(hostfs resolve.Resolver, pid int) (ProcMemInfo, error) {
+	state, err := FillPidMetrics(hostfs, pid, ProcState{}, nil)
+	return state.Memory, err
+}
+
+// getProcCPU is used by GetProcCPUTicks
+func getProcCPU(hostfs resolve.Resolver, pid int) (ProcCPUInfo, error) {
+	state, err := FillPidMetrics(hostfs, pid, ProcState{}, nil)
+	return state.CPU, err
+}
@@ -23,7 +23,14 @@ package process
 import (
 	"errors"
 	"fmt"
+	"os"
+	"regexp"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
+
+	"github.com/joeshaw/multierror"
 
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/match"
@@ -34,10 +41,62 @@ import (
 	sysinfo "github.com/elastic/go-sysinfo"
 )
 
+// ErrProcNotExist indicates that a process was not found.
+var ErrProcNotExist = errors.New("process does not exist")
+
 // ProcNotExist indicates that a process was not found.
-var ProcNotExist = errors.New("process does not exist")
+//
+// Deprecated: use ErrProcNotExist
+var ProcNotExist = ErrProcNotExist
+
+// ErrProcPermission indicates that we don't have permission to read a process.
+var ErrProcPermission = errors.New("permission denied reading process")
+
+// ErrNotImplemented indicates that a feature is not available on the current platform.
+var ErrNotImplemented = errors.New("not implemented on this platform")
+
+// ErrProcUnavailable indicates that procfs isn't mounted, as is common in minimal containers.
+var ErrProcUnavailable = errors.New("procfs is not available")
+
+// procError ties an underlying OS error to one of the sentinel errors above,
+// so callers can use errors.Is with either the sentinel or the original error.
+type procError struct {
+	sentinel error
+	err      error
+}
+
+func (e procError) Error() string {
+	return e.err.Error()
+}
+
+func (e procError) Is(target error) bool {
+	return target == e.sentinel
+}
+
+func (e procError) Unwrap() error {
+	return e.err
+}
+
+// toProcError wraps err with ErrProcNotExist or ErrProcPermission if the underlying OS error matches either.
+// Other errors are returned as-is.
+func toProcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var already procError
+	if errors.As(err, &already) {
+		return err
+	}
+	switch {
+	case errors.Is(err, syscall.ESRCH), errors.Is(err, os.ErrNotExist):
+		return procError{sentinel: ErrProcNotExist, err: err}
+	case errors.Is(err, os.ErrPermission):
+		return procError{sentinel: ErrProcPermission, err: err}
+	}
+	return err
+}
 
-//ProcsMap is a convinence wrapper for the oft-used ideom of map[int]ProcState
+// ProcsMap is a convinence wrapper for the oft-used ideom of map[int]ProcState
 type ProcsMap map[int]ProcState
 
 // ProcsTrack is a thread-safe wrapper for a process Stat object's internal map of processes.
@@ -72,6 +131,13 @@ func (pm *ProcsTrack) SetMap(pids map[int]ProcState) {
 
 }
 
+// Len returns the number of processes currently tracked
+func (pm *ProcsTrack) Len() int {
+	pm.mut.RLock()
+	defer pm.mut.RUnlock()
+	return len(pm.pids)
+}
+
 // ProcCallback is a function that FetchPid* methods can call at various points to do OS-agnostic processing
 type ProcCallback func(in ProcState) (ProcState, error)
 
@@ -87,29 +153,157 @@ type CgroupPctStats struct {
 
 // Stats stores the stats of processes on the host.
 type Stats struct {
-	Hostfs        resolve.Resolver
-	Procs         []string
-	ProcsMap      *ProcsTrack
-	CPUTicks      bool
-	EnvWhitelist  []string
-	CacheCmdLine  bool
-	IncludeTop    IncludeTopConfig
-	CgroupOpts    cgroup.ReaderOptions
-	EnableCgroups bool
-	EnableNetwork bool
+	Hostfs       resolve.Resolver
+	Procs        []string
+	ProcsMap     *ProcsTrack
+	CPUTicks     bool
+	EnvWhitelist []string
+	// EnvWhitelistMode sets how EnvWhitelist entries are matched. Defaults to EnvWhitelistRegex.
+	EnvWhitelistMode EnvWhitelistMode
+	CacheCmdLine     bool
+	// MaxCmdlineBytes truncates the reported command line to the given number of bytes, if greater than zero.
+	MaxCmdlineBytes int
+	IncludeTop      IncludeTopConfig
+	CgroupOpts      cgroup.ReaderOptions
+	EnableCgroups   bool
+	EnableNetwork   bool
+	EnableLimits    bool
 	// NetworkMetrics is an allowlist of network metrics,
 	// the names of which can be found in /proc/PID/net/snmp and /proc/PID/net/netstat
 	NetworkMetrics []string
+	// Fields limits collection to the given groups of metrics, such as "cpu", "memory" or "cmdline".
+	// The basic process info (name, pid, state and so on) is always reported. If empty, everything is collected.
+	Fields []string
+	// IncludeChildStats reports the cumulative CPU ticks of waited-for children as cpu.children, on linux.
+	// Child major page faults are always reported as memory.cmajflt.
+	IncludeChildStats bool
+	// PerProcTimeout limits the time Get spends collecting a single process, if greater than zero.
+	// Processes that time out are skipped, though the read that's blocking them can't be interrupted.
+	PerProcTimeout time.Duration
+	// MaxProcs caps the number of processes returned by Get, if greater than zero.
+	// The cap is applied after IncludeTop; without it, collection stops once the cap is reached.
+	// If any processes were left out, the root events are marked with process.truncated.
+	MaxProcs int
+	// DetectEnvChanges reads the environment of a process on every collection, instead of caching it,
+	// and reports env_changed along with the names of any EnvWhitelist variables that changed since the previous collection.
+	DetectEnvChanges bool
+	// CacheSelf reuses the username and executable path of our own process from the previous collection,
+	// as they don't change for a live process. Volatile metrics are still fetched on every call.
+	// The start time isn't cached, as it is parsed from the same stat read as the CPU times, so caching it would save no reads.
+	CacheSelf bool
+	// MinSampleInterval is the shortest time between two samples of a process that CPU percentages are computed from.
+	// Samples that come sooner reuse the previous percentages, as percentages over a tiny delta are noisy.
+	MinSampleInterval time.Duration
+	// EnableIO reports the bytes a process has read from and written to storage, on linux and darwin.
+	// On linux, this needs the same access as ptrace, so it's skipped for processes we can't trace.
+	EnableIO bool
+	// ProcNameRewrite rewrites the names of the processes that are reported, in order.
+	// Procs is matched against the original name, while IncludeTop and the reported events use the rewritten one.
+	ProcNameRewrite []NameRewriteConfig
+	// EnableRoot reports the root directory of a process, which differs from / for chrooted and containerized processes.
+	// It's only available on linux, and is left empty for processes we don't have permission to inspect.
+	EnableRoot bool
+	// MatchCmdline also matches Procs against the full command line, so `java -jar a.jar` can be told apart from `java -jar b.jar`.
+	// The command line can only be read along with the rest of the metrics, so this makes collection slower.
+	MatchCmdline bool
+	// Logger is used for all of the logging done while collecting, instead of a named child of the global logger.
+	// It's also passed on to the cgroup reader, unless CgroupOpts sets its own.
+	Logger *logp.Logger
+	// EnableGPU reports the NVIDIA GPU memory and utilization of each process, using NVML.
+	// It's only available on linux in builds with the gpu tag; without it, or without an NVIDIA driver, nothing is reported.
+	EnableGPU bool
+	// EnableNamespaces reports the inode numbers of the pid, net, mnt, uts, ipc, user and cgroup namespaces of each process,
+	// so processes can be grouped by the namespaces they share. It's only available on linux.
+	EnableNamespaces bool
+	// SkipKernelThreads leaves out kernel threads, which are children of kthreadd with no command line.
+	// Kernel threads are only detected on linux, and GetOne still reports them.
+	SkipKernelThreads bool
+	// CmdlinePrefixLen only keeps the given number of arguments, including the binary, in the reported args and command line,
+	// to keep their cardinality down. Procs is still matched against the whole command line. Everything is kept if it's zero.
+	CmdlinePrefixLen int
+	// SumTaskCPU reports the CPU times of each process as the sum of the times of its threads, from /proc/PID/task.
+	// This avoids reading the process-wide times while threads are updating them, but reads a file per thread,
+	// which is costly for processes with many threads. As the sums miss threads that have exited, each time is never reported
+	// below the process-wide one. It's only available on linux.
+	SumTaskCPU bool
+	// Enrichers are called in order with each process once its metrics are collected, so embedders can add their own fields,
+	// usually to ProcState.Annotations. An error from an enricher is logged, and the process is still reported.
+	Enrichers []func(*ProcState) error
+	// ExcludeSelf leaves the current process out of Get, as agents usually report their own metrics separately.
+	// GetSelf and GetOne still report it.
+	ExcludeSelf bool
+	// EnableMaps reports the number of memory mappings of each process as memory.num_maps, to be compared with GetMaxMapCount.
+	// Counting them has the kernel walk every mapping, which is costly for large processes. It's only available on linux.
+	EnableMaps bool
+	// Counters reports the per-second rates of the given counters in the events returned by Get, under "rates".
+	Counters *CounterSet
 
 	skipExtended bool
+	truncated    bool            // Set if MaxProcs left out any processes in the current call to Get
 	procRegexps  []match.Matcher // List of regular expressions used to whitelist processes.
 	envRegexps   []match.Matcher // List of regular expressions used to whitelist env vars.
+	fields       map[string]bool // Set of Fields, nil if all fields are wanted.
+	nameRewrites []nameRewrite   // Compiled ProcNameRewrite
 	cgroups      *cgroup.Reader
 	logger       *logp.Logger
+	now          func() time.Time // Used for the sample time, so tests can control the clock
 	host         types.Host
+	gpuUsage     map[int]ProcGPUInfo
+	bootID       string
+	collection   CollectionStats
+	noProcfs     bool
+}
+
+// EnvWhitelistMode sets how the entries in Stats.EnvWhitelist are matched against environment variable names
+type EnvWhitelistMode string
+
+const (
+	// EnvWhitelistRegex treats entries as unanchored regular expressions, so `PATH` will also match `MYPATH`
+	EnvWhitelistRegex EnvWhitelistMode = "regex"
+	// EnvWhitelistExact only matches variables with exactly the given name
+	EnvWhitelistExact EnvWhitelistMode = "exact"
+	// EnvWhitelistPrefix matches variables that start with the given string
+	EnvWhitelistPrefix EnvWhitelistMode = "prefix"
+)
+
+// compile returns a matcher for a single whitelist entry
+func (mode EnvWhitelistMode) compile(pattern string) (match.Matcher, error) {
+	switch mode {
+	case EnvWhitelistRegex, "":
+		return match.Compile(pattern)
+	case EnvWhitelistExact:
+		return match.Compile("^" + regexp.QuoteMeta(pattern) + "$")
+	case EnvWhitelistPrefix:
+		return match.Compile("^" + regexp.QuoteMeta(pattern))
+	}
+	return match.Matcher{}, fmt.Errorf("unknown env whitelist mode '%s'", mode)
+}
+
+// selectableFields are the groups of metrics that can be set in Stats.Fields
+var selectableFields = map[string]bool{
+	"cpu":        true,
+	"memory":     true,
+	"fd":         true,
+	"cmdline":    true,
+	"env":        true,
+	"cwd":        true,
+	"exe":        true,
+	"username":   true,
+	"cgroup":     true,
+	"network":    true,
+	"limits":     true,
+	"io":         true,
+	"root":       true,
+	"gpu":        true,
+	"namespaces": true,
 }
 
-//PidState are the constants for various PID states
+// wantField returns true if the given group of metrics should be collected
+func (procStats *Stats) wantField(name string) bool {
+	return procStats.fields == nil || procStats.fields[name]
+}
+
+// PidState are the constants for various PID states
 type PidState string
 
 var (
@@ -152,10 +346,62 @@ var PidStates = map[byte]PidState{
 	'P': Parked,
 }
 
-// Init initializes a Stats instance. It returns errors if the provided process regexes
-// cannot be compiled.
+// Validate checks the configuration without reading anything from the host, and returns all of the problems found.
+// Init calls it before anything else, so it only needs to be called directly to check a configuration ahead of time.
+func (procStats *Stats) Validate() error {
+	var errs multierror.Errors
+	for _, field := range procStats.Fields {
+		if !selectableFields[field] {
+			errs = append(errs, fmt.Errorf("unknown process field '%s'", field))
+		}
+	}
+	for _, pattern := range procStats.Procs {
+		if _, err := match.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("failed to compile regexp [%s]: %w", pattern, err))
+		}
+	}
+	for _, pattern := range procStats.EnvWhitelist {
+		if _, err := procStats.EnvWhitelistMode.compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("failed to compile env whitelist regexp [%v]: %w", pattern, err))
+		}
+	}
+	for _, name := range procStats.NetworkMetrics {
+		if strings.TrimSpace(name) == "" {
+			errs = append(errs, errors.New("network metric names can't be empty"))
+			break
+		}
+	}
+	if procStats.Counters != nil {
+		for _, name := range procStats.Counters.counters {
+			if strings.TrimSpace(name) == "" {
+				errs = append(errs, errors.New("counter names can't be empty"))
+				break
+			}
+		}
+	}
+	if _, err := compileNameRewrites(procStats.ProcNameRewrite); err != nil {
+		errs = append(errs, err)
+	}
+	if procStats.IncludeTop.ByCPU < 0 || procStats.IncludeTop.ByMemory < 0 {
+		errs = append(errs, fmt.Errorf("include_top counts can't be negative, got by_cpu %d and by_memory %d",
+			procStats.IncludeTop.ByCPU, procStats.IncludeTop.ByMemory))
+	}
+	if procStats.MaxProcs < 0 {
+		errs = append(errs, fmt.Errorf("MaxProcs can't be negative, got %d", procStats.MaxProcs))
+	}
+	return errs.Err()
+}
+
+// Init initializes a Stats instance. It returns errors if the configuration isn't valid,
+// such as when the provided process regexes cannot be compiled.
 func (procStats *Stats) Init() error {
-	procStats.logger = logp.NewLogger("processes")
+	procStats.logger = procStats.Logger
+	if procStats.logger == nil {
+		procStats.logger = logp.NewLogger("processes")
+	}
+	if err := procStats.Validate(); err != nil {
+		return err
+	}
 	var err error
 	procStats.host, err = sysinfo.Host()
 	if err != nil {
@@ -163,10 +409,21 @@ func (procStats *Stats) Init() error {
 		procStats.logger.Warnf("Getting host details: %v", err)
 	}
 
+	if procStats.now == nil {
+		procStats.now = time.Now
+	}
+
 	//footcannon prevention
 	if procStats.Hostfs == nil {
 		procStats.Hostfs = resolve.NewTestResolver("/")
 	}
+	// GetSelf can still report some metrics without procfs, so remember that it's missing
+	procStats.noProcfs = false
+	if err := checkProcfs(procStats.Hostfs); err != nil {
+		procStats.noProcfs = errors.Is(err, ErrProcUnavailable)
+		return err
+	}
+	procStats.bootID = getBootID(procStats.Hostfs)
 
 	if procStats.EnableNetwork && len(procStats.NetworkMetrics) == 0 {
 		procStats.logger.Warnf("Collecting all network metrics per-process; this will produce a large volume of data.")
@@ -174,6 +431,19 @@ func (procStats *Stats) Init() error {
 
 	procStats.ProcsMap = NewProcsTrack()
 
+	procStats.fields = nil
+	if len(procStats.Fields) > 0 {
+		procStats.fields = make(map[string]bool, len(procStats.Fields))
+		for _, field := range procStats.Fields {
+			procStats.fields[field] = true
+		}
+	}
+
+	procStats.nameRewrites, err = compileNameRewrites(procStats.ProcNameRewrite)
+	if err != nil {
+		return err
+	}
+
 	if len(procStats.Procs) == 0 {
 		return nil
 	}
@@ -189,7 +459,7 @@ func (procStats *Stats) Init() error {
 
 	procStats.envRegexps = make([]match.Matcher, 0, len(procStats.EnvWhitelist))
 	for _, pattern := range procStats.EnvWhitelist {
-		reg, err := match.Compile(pattern)
+		reg, err := procStats.EnvWhitelistMode.compile(pattern)
 		if err != nil {
 			return fmt.Errorf("failed to compile env whitelist regexp [%v]: %w", pattern, err)
 		}
@@ -197,9 +467,15 @@ func (procStats *Stats) Init() error {
 	}
 
 	if procStats.EnableCgroups {
-		cgReader, err := cgroup.NewReaderOptions(procStats.CgroupOpts)
+		// processes often share a cgroup, so only read each one once per call to Get()
+		cgOpts := procStats.CgroupOpts
+		cgOpts.CacheStats = true
+		if cgOpts.Logger == nil {
+			cgOpts.Logger = procStats.logger
+		}
+		cgReader, err := cgroup.NewReaderOptions(cgOpts)
 		if errors.Is(err, cgroup.ErrCgroupsMissing) {
-			logp.Warn("cgroup data collection will be disabled: %v", err)
+			procStats.logger.Warnf("cgroup data collection will be disabled: %v", err)
 			procStats.EnableCgroups = false
 		} else if err != nil {
 			return fmt.Errorf("error initializing cgroup reader: %w", err)
@@ -36,7 +36,6 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"os/user"
 	"strconv"
 	"syscall"
 	"time"
@@ -115,16 +114,17 @@ func GetInfoForPid(_ resolve.Resolver, pid int) (ProcState, error) {
 
 	// Get process username. Fallback to UID if username is not available.
 	uid := strconv.Itoa(int(info.pbsd.pbi_uid))
-	user, err := user.LookupId(uid)
-	if err == nil && user.Username != "" {
-		status.Username = user.Username
-	} else {
-		status.Username = uid
-	}
+	status.Username = lookupUsername(uid)
 
 	// grab memory info + process time while we have it from struct_proc_taskallinfo
 	status.Memory.Size = opt.UintWith(uint64(info.ptinfo.pti_virtual_size))
 	status.Memory.Rss.Bytes = opt.UintWith(uint64(info.ptinfo.pti_resident_size))
+	// pti_faults counts all page faults, and pti_pageins the ones that needed I/O
+	faults, pageins := uint64(info.ptinfo.pti_faults), uint64(info.ptinfo.pti_pageins)
+	status.Memory.MajFlt = opt.UintWith(pageins)
+	if faults >= pageins {
+		status.Memory.MinFlt = opt.UintWith(faults - pageins)
+	}
 
 	status.CPU.User.Ticks = opt.UintWith(uint64(info.ptinfo.pti_total_user) / uint64(time.Millisecond))
 	status.CPU.System.Ticks = opt.UintWith(uint64(info.ptinfo.pti_total_system) / uint64(time.Millisecond))
@@ -248,3 +248,15 @@ func sysctl(mib []C.int, old *byte, oldlen *uintptr,
 	}
 	return err
 }
+
+// getProcMem is used by GetProcRSS. The memory data comes from the same task info call as the rest of GetInfoForPid.
+func getProcMem(hostfs resolve.Resolver, pid int) (ProcMemInfo, error) {
+	state, err := GetInfoForPid(hostfs, pid)
+	return state.Memory, err
+}
+
+// getProcCPU is used by GetProcCPUTicks
+func getProcCPU(hostfs resolve.Resolver, pid int) (ProcCPUInfo, error) {
+	state, err := GetInfoForPid(hostfs, pid)
+	return state.CPU, err
+}
@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build freebsd
+// +build freebsd
+
+package process
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestSysctlCwd(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	cwd, err := sysctlCwd(resolve.NewTestResolver("/"), os.Getpid())
+	require.NoError(t, err)
+	assert.Equal(t, wd, cwd)
+
+	_, err = sysctlCwd(resolve.NewTestResolver("/hostfs"), os.Getpid())
+	assert.ErrorIs(t, err, ErrNotImplemented)
+}
+
+func TestSysctlEnv(t *testing.T) {
+	t.Setenv("SYSCTL_ENV_TEST", "value")
+
+	env, err := sysctlEnv(resolve.NewTestResolver("/"), os.Getpid(), nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, env)
+
+	env, err = sysctlEnv(resolve.NewTestResolver("/"), os.Getpid(), func(key string) bool { return key == "PATH" })
+	require.NoError(t, err)
+	assert.Equal(t, os.Getenv("PATH"), env["PATH"])
+	assert.Len(t, env, 1)
+}
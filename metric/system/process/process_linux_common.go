@@ -25,16 +25,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"math"
 	"os"
-	"os/user"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
 
-	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
 	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 )
 
@@ -42,38 +42,29 @@ import (
 // This value obviously won't change while this code is running.
 var bootTime uint64 = 0
 
-// system tick multiplier, see C.sysconf(C._SC_CLK_TCK)
-const ticks = 100
-
 // FetchPids is the linux implementation of FetchPids
 func (procStats *Stats) FetchPids() (ProcsMap, []ProcState, error) {
-	dir, err := os.Open(procStats.Hostfs.ResolveHostFS("proc"))
-	if err != nil {
-		return nil, nil, fmt.Errorf("error reading from procfs %s: %w", procStats.Hostfs.ResolveHostFS("/"), err)
+	if procStats.noProcfs {
+		return nil, nil, ErrProcUnavailable
 	}
-	defer dir.Close()
-
-	const readAllDirnames = -1 // see os.File.Readdirnames doc
-
-	names, err := dir.Readdirnames(readAllDirnames)
+	entries, err := readerFor(procStats.Hostfs).ReadDir(resolve.ProcPath(procStats.Hostfs))
 	if err != nil {
-		return nil, nil, fmt.Errorf("error reading directory names: %w", err)
+		return nil, nil, fmt.Errorf("error reading from procfs %s: %w", procStats.Hostfs.ResolveHostFS("/"), err)
 	}
 
 	procMap := make(ProcsMap)
 	var plist []ProcState
 
 	// Iterate over the directory, fetch just enough info so we can filter based on user input.
-	logger := logp.L()
-	for _, name := range names {
-
+	for _, entry := range entries {
+		name := entry.Name()
 		if !dirIsPid(name) {
 			continue
 		}
 		// Will this actually fail?
 		pid, err := strconv.Atoi(name)
 		if err != nil {
-			logger.Debugf("Error converting PID name %s", name)
+			procStats.logger.Debugf("Error converting PID name %s", name)
 			continue
 		}
 		procMap, plist = procStats.pidIter(pid, procMap, plist)
@@ -91,10 +82,15 @@ func FillPidMetrics(hostfs resolve.Resolver, pid int, state ProcState, filter fu
 	}
 
 	// CPU Data
-	state.CPU, err = getCPUTime(hostfs, pid)
+	var faults ProcMemInfo
+	state.CPU, faults, err = getCPUTime(hostfs, pid)
 	if err != nil {
 		return state, fmt.Errorf("error getting CPU data for pid %d: %w", pid, err)
 	}
+	state.Memory.MinFlt = faults.MinFlt
+	state.Memory.MajFlt = faults.MajFlt
+	state.Memory.ChildMinFlt = faults.ChildMinFlt
+	state.Memory.ChildMajFlt = faults.ChildMajFlt
 
 	// CLI args
 	if len(state.Args) == 0 {
@@ -113,26 +109,68 @@ func FillPidMetrics(hostfs resolve.Resolver, pid int, state ProcState, filter fu
 
 	if state.Env == nil {
 		// env vars
-		state.Env, _ = getEnvData(hostfs, pid, filter)
+		state.Env, err = getEnvData(hostfs, pid, filter)
+		if err != nil && !errors.Is(err, os.ErrPermission) {
+			state.Env, _ = sysctlEnv(hostfs, pid, filter)
+		}
 	}
 
-	state.Exe, state.Cwd, err = getProcStringData(hostfs, pid)
+	state.Exe, state.Cwd, err = getProcStringData(hostfs, pid, state.Exe)
 	if err != nil && !errors.Is(err, os.ErrPermission) { // ignore permission errors
 		return state, fmt.Errorf("error getting metadata for pid %d: %w", pid, err)
 	}
+	if state.Exe != "" {
+		state.Name = exeName(state.Exe)
+	}
 
-	//username
-	state.Username, err = getUser(hostfs, pid)
+	//username, along with the numeric IDs
+	status, err := getProcStatus(hostfs, pid)
+	if err != nil {
+		return state, fmt.Errorf("error fetching user ID for pid %d: %w", pid, err)
+	}
+	state.UIDs, err = getIDs(status, "Uid")
 	if err != nil {
-		return state, fmt.Errorf("error creating username for pid %d: %w", pid, err)
+		return state, fmt.Errorf("error fetching user IDs for pid %d: %w", pid, err)
+	}
+	state.GIDs, err = getIDs(status, "Gid")
+	if err != nil {
+		return state, fmt.Errorf("error fetching group IDs for pid %d: %w", pid, err)
+	}
+	state.Groups, err = getGroups(status)
+	if err != nil {
+		return state, fmt.Errorf("error fetching supplementary groups for pid %d: %w", pid, err)
+	}
+	state.hasIDs = true
+	if state.Username == "" {
+		state.Username = getUser(state.UIDs[0])
+	}
+
+	// wait channel, useful for finding out why a process is blocked
+	if state.State != Running {
+		state.WChan = getWChan(hostfs, pid)
 	}
 	return state, nil
 }
 
+// getWChan returns the kernel function the process is waiting in, from /proc/[PID]/wchan.
+// This is best-effort: the file may be unreadable without ptrace access, or restricted by the kernel config,
+// in which case we return an empty string. The kernel reports "0" if the process isn't waiting.
+func getWChan(hostfs resolve.Resolver, pid int) string {
+	data, err := readerFor(hostfs).ReadFile(resolve.ProcPath(hostfs, strconv.Itoa(pid), "wchan"))
+	if err != nil {
+		return ""
+	}
+	wchan := strings.TrimSpace(string(data))
+	if wchan == "0" {
+		return ""
+	}
+	return wchan
+}
+
 // GetInfoForPid fetches the basic hostinfo from /proc/[PID]/stat
 func GetInfoForPid(hostfs resolve.Resolver, pid int) (ProcState, error) {
-	path := hostfs.Join("proc", strconv.Itoa(pid), "stat")
-	data, err := ioutil.ReadFile(path)
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "stat")
+	data, err := readerFor(hostfs).ReadFile(path)
 	// Transform the error into a more sensible error in cases where the directory doesn't exist, i.e the process is gone
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -151,6 +189,7 @@ func GetInfoForPid(hostfs resolve.Resolver, pid int) (ProcState, error) {
 		return state, fmt.Errorf("failed to extract comm for pid %d from '%v': %w", pid, string(data), err)
 	}
 	state.Name = string(data[lIdx+1 : rIdx])
+	state.CommName = state.Name
 
 	// Extract the rest of the fields that we are interested in.
 	fields := bytes.Fields(data[rIdx+2:])
@@ -162,15 +201,19 @@ func GetInfoForPid(hostfs resolve.Resolver, pid int) (ProcState, error) {
 		fields[0], // state
 		fields[1], // ppid
 		fields[2], // pgrp
+		fields[3], // session
+		fields[4], // tty_nr
 	}, []byte(" "))
 
 	var procState string
-	var ppid, pgid int
+	var ppid, pgid, sid, ttyNr int
 
 	_, err = fmt.Fscan(bytes.NewBuffer(interests),
 		&procState,
 		&ppid,
 		&pgid,
+		&sid,
+		&ttyNr,
 	)
 	if err != nil {
 		return state, fmt.Errorf("failed to parse stat fields for pid %d from '%v': %w", pid, string(data), err)
@@ -179,28 +222,94 @@ func GetInfoForPid(hostfs resolve.Resolver, pid int) (ProcState, error) {
 	state.Ppid = opt.IntWith(ppid)
 	state.Pgid = opt.IntWith(pgid)
 	state.Pid = opt.IntWith(pid)
+	state.SessionID = opt.IntWith(sid)
+	state.IsSessionLeader = sid == pid
+	state.TTY = decodeTTY(ttyNr)
+	// exit_code was added in linux 3.5
+	if len(fields) > 49 {
+		state.StateDetail = stateDetail(state.State, string(fields[49]))
+	}
 
 	return state, nil
 }
 
-func getProcStringData(hostfs resolve.Resolver, pid int) (string, string, error) {
-	exe, err := os.Readlink(hostfs.Join("proc", strconv.Itoa(pid), "exe"))
-	if errors.Is(err, os.ErrPermission) { // pass through permission errors
-		return "", "", err
-	} else if err != nil {
-		return "", "", fmt.Errorf("error fetching exe from pid %d: %w", pid, err)
+// stateDetail describes why a process is stopped or a zombie, from the exit_code field of /proc/[PID]/stat.
+// For zombies this is the status that would be returned by wait(), and for stopped processes it's the stopping signal.
+// The kernel reports zero if we don't have permission to read it, in which case no detail is returned.
+func stateDetail(state PidState, rawCode string) string {
+	code, err := strconv.Atoi(rawCode)
+	if err != nil || code == 0 {
+		return ""
+	}
+	switch state {
+	case Zombie:
+		status := syscall.WaitStatus(code)
+		if status.Signaled() {
+			return fmt.Sprintf("killed by signal %d", status.Signal())
+		}
+		return fmt.Sprintf("exited with code %d", status.ExitStatus())
+	case Stopped:
+		return fmt.Sprintf("stopped by signal %d", code)
+	}
+	return ""
+}
+
+// decodeTTY turns the tty_nr field of /proc/[PID]/stat into a device name relative to /dev,
+// falling back to "major:minor" for devices we don't know how to name. Returns an empty string if there's no controlling terminal.
+func decodeTTY(ttyNr int) string {
+	if ttyNr == 0 {
+		return ""
+	}
+	// see MAJOR() and MINOR() in include/linux/kdev_t.h
+	major := (ttyNr >> 8) & 0xfff
+	minor := (ttyNr & 0xff) | ((ttyNr >> 12) & 0xfff00)
+
+	switch {
+	// Unix98 PTY slaves, see Documentation/admin-guide/devices.txt
+	case major >= 136 && major <= 143:
+		return fmt.Sprintf("pts/%d", (major-136)*256+minor)
+	case major == 4 && minor < 64:
+		return fmt.Sprintf("tty%d", minor)
+	case major == 4:
+		return fmt.Sprintf("ttyS%d", minor-64)
+	case major == 5 && minor == 1:
+		return "console"
+	}
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
+// getProcStringData returns the exe and cwd of a process. The exe is only read if it isn't already known.
+func getProcStringData(hostfs resolve.Resolver, pid int, exe string) (string, string, error) {
+	if exe == "" {
+		var err error
+		exe, err = readerFor(hostfs).Readlink(resolve.ProcPath(hostfs, strconv.Itoa(pid), "exe"))
+		if errors.Is(err, os.ErrPermission) { // pass through permission errors
+			return "", "", err
+		} else if err != nil {
+			return "", "", fmt.Errorf("error fetching exe from pid %d: %w", pid, err)
+		}
 	}
 
-	cwd, err := os.Readlink(hostfs.Join("proc", strconv.Itoa(pid), "cwd"))
+	cwd, err := readerFor(hostfs).Readlink(resolve.ProcPath(hostfs, strconv.Itoa(pid), "cwd"))
 	if errors.Is(err, os.ErrPermission) {
 		return "", "", err
 	} else if err != nil {
-		return "", "", fmt.Errorf("error fetching cwd for pid %d: %w", pid, err)
+		// linprocfs on freebsd can't always resolve the cwd, but the kernel can
+		sysCwd, sysErr := sysctlCwd(hostfs, pid)
+		if sysErr != nil {
+			return "", "", fmt.Errorf("error fetching cwd for pid %d: %w", pid, err)
+		}
+		cwd = sysCwd
 	}
 
 	return exe, cwd, nil
 }
 
+// exeName returns the base name of an executable, without the marker the kernel adds once it's been deleted
+func exeName(exe string) string {
+	return filepath.Base(strings.TrimSuffix(exe, " (deleted)"))
+}
+
 func dirIsPid(name string) bool {
 	if name[0] < '0' || name[0] > '9' {
 		return false
@@ -208,35 +317,62 @@ func dirIsPid(name string) bool {
 	return true
 }
 
-func getUser(hostfs resolve.Resolver, pid int) (string, error) {
-	status, err := getProcStatus(hostfs, pid)
-	if err != nil {
-		return "", fmt.Errorf("error fetching user ID for pid %d: %w", pid, err)
-	}
-	uidValues, ok := status["Uid"]
+// getUser resolves a uid to a username, falling back to the uid itself if it can't be looked up
+func getUser(uid int) string {
+	return lookupUsername(strconv.Itoa(uid))
+}
+
+// getIDs parses the real, effective, saved set and filesystem IDs from the Uid or Gid line of /proc/[PID]/status
+func getIDs(status map[string]string, key string) ([4]int, error) {
+	ids := [4]int{}
+	values, ok := status[key]
 	if !ok {
-		return "", fmt.Errorf("field Uid not found in proc status: %w", err)
+		return ids, fmt.Errorf("field %s not found in proc status", key)
 	}
-	uidStrings := strings.Fields(uidValues)
-	var userFinal string
-	user, err := user.LookupId(uidStrings[0])
-	if err == nil {
-		userFinal = user.Username
-	} else {
-		userFinal = uidStrings[0]
+	fields := strings.Fields(values)
+	if len(fields) != len(ids) {
+		return ids, fmt.Errorf("expected %d values in field %s, got '%s'", len(ids), key, values)
 	}
+	for i, field := range fields {
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return ids, fmt.Errorf("error parsing field %s: %w", key, err)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
 
-	return userFinal, nil
+// getGroups parses the supplementary group IDs from the Groups line of /proc/[PID]/status
+func getGroups(status map[string]string) ([]int, error) {
+	fields := strings.Fields(status["Groups"])
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	groups := make([]int, 0, len(fields))
+	for _, field := range fields {
+		group, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing field Groups: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
 }
 
 func getEnvData(hostfs resolve.Resolver, pid int, filter func(string) bool) (mapstr.M, error) {
-	path := hostfs.Join("proc", strconv.Itoa(pid), "environ")
-	data, err := ioutil.ReadFile(path)
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "environ")
+	data, err := readerFor(hostfs).ReadFile(path)
 	if errors.Is(err, os.ErrPermission) { // pass through permission errors
 		return nil, err
 	} else if err != nil {
 		return nil, fmt.Errorf("error opening file %s: %w", path, err)
 	}
+	return parseEnv(data, filter), nil
+}
+
+// parseEnv parses NUL-separated KEY=value pairs, keeping the keys that match filter
+func parseEnv(data []byte, filter func(string) bool) mapstr.M {
 	env := mapstr.M{}
 
 	pairs := bytes.Split(data, []byte{0})
@@ -255,19 +391,22 @@ func getEnvData(hostfs resolve.Resolver, pid int, filter func(string) bool) (map
 			env[key] = string(bytes.TrimSpace(parts[1]))
 		}
 	}
-	return env, nil
+	return env
 }
 
 func getMemData(hostfs resolve.Resolver, pid int) (ProcMemInfo, error) {
 	// Memory data
 	state := ProcMemInfo{}
-	path := hostfs.Join("proc", strconv.Itoa(pid), "statm")
-	data, err := ioutil.ReadFile(path)
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "statm")
+	data, err := readerFor(hostfs).ReadFile(path)
 	if err != nil {
 		return state, fmt.Errorf("error opening file %s: %w", path, err)
 	}
 
 	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return state, fmt.Errorf("expected at least 3 fields in %s, got %d", path, len(fields))
+	}
 
 	size, err := strconv.ParseUint(fields[0], 10, 64)
 	if err != nil {
@@ -287,52 +426,127 @@ func getMemData(hostfs resolve.Resolver, pid int) (ProcMemInfo, error) {
 	return state, nil
 }
 
-func getCPUTime(hostfs resolve.Resolver, pid int) (ProcCPUInfo, error) {
+// getCPUTime returns the CPU times from /proc/[PID]/stat.
+// The page fault counters are returned as well, since they come from the same file.
+func getCPUTime(hostfs resolve.Resolver, pid int) (ProcCPUInfo, ProcMemInfo, error) {
 	state := ProcCPUInfo{}
+	faults := ProcMemInfo{}
 
-	pathCPU := hostfs.Join("proc", strconv.Itoa(pid), "stat")
-	data, err := ioutil.ReadFile(pathCPU)
+	pathCPU := resolve.ProcPath(hostfs, strconv.Itoa(pid), "stat")
+	data, err := readerFor(hostfs).ReadFile(pathCPU)
 	if err != nil {
-		return state, fmt.Errorf("error opening file %s: %w", pathCPU, err)
+		return state, faults, fmt.Errorf("error opening file %s: %w", pathCPU, err)
+	}
+	// fields[N-3] is field N of proc(5)
+	fields, err := statFieldsAfterComm(string(data))
+	if err != nil {
+		return state, faults, fmt.Errorf("error parsing %s: %w", pathCPU, err)
+	}
+	if len(fields) < 20 {
+		return state, faults, fmt.Errorf("expected at least 20 fields after comm in %s, got %d", pathCPU, len(fields))
 	}
-	fields := strings.Fields(string(data))
 
-	user, err := strconv.ParseUint(fields[13], 10, 64)
+	user, err := strconv.ParseUint(fields[11], 10, 64)
 	if err != nil {
-		return state, fmt.Errorf("error parsing user CPU times for pid %d: %w", pid, err)
+		return state, faults, fmt.Errorf("error parsing user CPU times for pid %d: %w", pid, err)
 	}
-	sys, err := strconv.ParseUint(fields[14], 10, 64)
+	sys, err := strconv.ParseUint(fields[12], 10, 64)
 	if err != nil {
-		return state, fmt.Errorf("error parsing system CPU times for pid %d: %w", pid, err)
+		return state, faults, fmt.Errorf("error parsing system CPU times for pid %d: %w", pid, err)
+	}
+
+	// cutime and cstime, the times of waited-for children
+	childFields := make([]uint64, 2)
+	for i := range childFields {
+		childFields[i], err = strconv.ParseUint(fields[13+i], 10, 64)
+		if err != nil {
+			return state, faults, fmt.Errorf("error parsing child CPU times for pid %d: %w", pid, err)
+		}
+	}
+
+	// minflt, cminflt, majflt and cmajflt
+	faultFields := make([]opt.Uint, 4)
+	for i := range faultFields {
+		value, err := strconv.ParseUint(fields[7+i], 10, 64)
+		if err != nil {
+			return state, faults, fmt.Errorf("error parsing page faults for pid %d: %w", pid, err)
+		}
+		faultFields[i] = opt.UintWith(value)
 	}
+	faults.MinFlt, faults.ChildMinFlt, faults.MajFlt, faults.ChildMajFlt = faultFields[0], faultFields[1], faultFields[2], faultFields[3]
 
 	btime, err := getLinuxBootTime(hostfs)
 	if err != nil {
-		return state, fmt.Errorf("error feting boot time for pid %d: %w", pid, err)
+		return state, faults, fmt.Errorf("error feting boot time for pid %d: %w", pid, err)
 	}
 
 	// convert to milliseconds from USER_HZ
 	// This effectively means our definition of "ticks" throughout the process code is a millisecond
-	state.User.Ticks = opt.UintWith(user * (1000 / ticks))
-	state.System.Ticks = opt.UintWith(sys * (1000 / ticks))
-	state.Total.Ticks = opt.UintWith(opt.SumOptUint(state.User.Ticks, state.System.Ticks))
+	state.User.Ticks = opt.UintWith(metric.TicksToMsUint(user))
+	state.System.Ticks = opt.UintWith(metric.TicksToMsUint(sys))
+	state.Total.Ticks = opt.UintWith(saturatingAdd(state.User.Ticks.ValueOr(0), state.System.Ticks.ValueOr(0)))
+	state.Children.User.Ticks = opt.UintWith(metric.TicksToMsUint(childFields[0]))
+	state.Children.System.Ticks = opt.UintWith(metric.TicksToMsUint(childFields[1]))
+	state.Children.Total.Ticks = opt.UintWith(saturatingAdd(state.Children.User.Ticks.ValueOr(0), state.Children.System.Ticks.ValueOr(0)))
+
+	// delayacct_blkio_ticks is always zero if delay accounting is disabled, so treat that as unavailable
+	if len(fields) > 39 {
+		blkio, err := strconv.ParseUint(fields[39], 10, 64)
+		if err != nil {
+			return state, faults, fmt.Errorf("error parsing block IO delay for pid %d: %w", pid, err)
+		}
+		if blkio > 0 {
+			state.IOWait.Ticks = opt.UintWith(metric.TicksToMsUint(blkio))
+		}
+	}
 
-	startTime, err := strconv.ParseUint(fields[21], 10, 64)
+	// processor, the CPU the process last ran on
+	if len(fields) > 36 {
+		lastCPU, err := strconv.Atoi(fields[36])
+		if err != nil {
+			return state, faults, fmt.Errorf("error parsing last CPU for pid %d: %w", pid, err)
+		}
+		state.LastCPU = opt.IntWith(lastCPU)
+	}
+
+	// policy, the scheduling policy, as returned by sched_getscheduler
+	if len(fields) > 38 {
+		policy, err := strconv.Atoi(fields[38])
+		if err != nil {
+			return state, faults, fmt.Errorf("error parsing scheduling policy for pid %d: %w", pid, err)
+		}
+		state.SchedPolicy = schedPolicyName(policy)
+	}
+
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
 	if err != nil {
-		return state, fmt.Errorf("error parsing start time value %s for pid %d: %w", fields[21], pid, err)
+		return state, faults, fmt.Errorf("error parsing start time value %s for pid %d: %w", fields[19], pid, err)
 	}
 
-	startTime /= ticks
-	startTime += btime
+	// the boot time only has second precision, so the start time is truncated to the second
+	startTime = saturatingAdd(metric.TicksToMsUint(startTime)/1000, btime)
+	if startTime > math.MaxUint64/1000 {
+		startTime = math.MaxUint64 / 1000
+	}
 	startTime *= 1000
 
 	state.StartTime = unixTimeMsToTime(startTime)
-	return state, nil
+	return state, faults, nil
+}
+
+// statFieldsAfterComm returns the fields of a stat file after comm, which can contain spaces and parentheses,
+// so the fields are split after its last ")". The first of them is state, the 3rd field of the file.
+func statFieldsAfterComm(data string) ([]string, error) {
+	rIdx := strings.LastIndex(data, ")")
+	if rIdx < 0 {
+		return nil, errors.New("failed to find the end of comm")
+	}
+	return strings.Fields(data[rIdx+1:]), nil
 }
 
 func getArgs(hostfs resolve.Resolver, pid int) ([]string, error) {
-	path := hostfs.Join("proc", strconv.Itoa(pid), "cmdline")
-	data, err := ioutil.ReadFile(path)
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "cmdline")
+	data, err := readerFor(hostfs).ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("error opening file %s: %w", path, err)
 	}
@@ -343,6 +557,10 @@ func getArgs(hostfs resolve.Resolver, pid int) ([]string, error) {
 	for {
 		arg, err := bbuf.ReadBytes(0)
 		if err == io.EOF {
+			// Processes that overwrite their argv, such as with setproctitle, may not NUL-terminate the last argument.
+			if len(arg) > 0 {
+				args = append(args, string(arg))
+			}
 			break
 		}
 		trimmedArg := string(arg[0 : len(arg)-1])
@@ -355,8 +573,8 @@ func getArgs(hostfs resolve.Resolver, pid int) ([]string, error) {
 func getFDStats(hostfs resolve.Resolver, pid int) (ProcFDInfo, error) {
 	state := ProcFDInfo{}
 
-	path := hostfs.Join("proc", strconv.Itoa(pid), "limits")
-	data, err := ioutil.ReadFile(path)
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "limits")
+	data, err := readerFor(hostfs).ReadFile(path)
 	if err != nil {
 		return state, fmt.Errorf("error opening file %s: %w", path, err)
 	}
@@ -382,8 +600,8 @@ func getFDStats(hostfs resolve.Resolver, pid int) (ProcFDInfo, error) {
 		}
 	}
 
-	pathFD := hostfs.Join("proc", strconv.Itoa(pid), "fd")
-	fds, err := ioutil.ReadDir(pathFD)
+	pathFD := resolve.ProcPath(hostfs, strconv.Itoa(pid), "fd")
+	fds, err := readerFor(hostfs).ReadDir(pathFD)
 	if errors.Is(err, os.ErrPermission) { //ignore permission errors, passthrough other data
 		return state, nil
 	} else if err != nil {
@@ -399,9 +617,9 @@ func getLinuxBootTime(hostfs resolve.Resolver) (uint64, error) {
 		return bootTime, nil
 	}
 
-	path := hostfs.Join("proc", "stat")
+	path := resolve.ProcPath(hostfs, "stat")
 	// grab system boot time
-	data, err := ioutil.ReadFile(path)
+	data, err := readerFor(hostfs).ReadFile(path)
 	if err != nil {
 		return 0, fmt.Errorf("error opening file %s: %w", path, err)
 	}
@@ -424,8 +642,8 @@ func getLinuxBootTime(hostfs resolve.Resolver) (uint64, error) {
 
 func getProcStatus(hostfs resolve.Resolver, pid int) (map[string]string, error) {
 	status := make(map[string]string, 42)
-	path := hostfs.Join("proc", strconv.Itoa(pid), "status")
-	data, err := ioutil.ReadFile(path)
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "status")
+	data, err := readerFor(hostfs).ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("error opening file %s: %w", path, err)
 	}
@@ -439,6 +657,24 @@ func getProcStatus(hostfs resolve.Resolver, pid int) (map[string]string, error)
 	return status, err
 }
 
+// schedPolicies are the names of the SCHED_* scheduling policies, by value
+var schedPolicies = map[int]string{
+	0: "other",
+	1: "fifo",
+	2: "rr",
+	3: "batch",
+	5: "idle",
+	6: "deadline",
+}
+
+func schedPolicyName(policy int) string {
+	name, ok := schedPolicies[policy]
+	if ok {
+		return name
+	}
+	return "unknown"
+}
+
 func getProcState(b byte) PidState {
 	state, ok := PidStates[b]
 	if ok {
@@ -446,3 +682,14 @@ func getProcState(b byte) PidState {
 	}
 	return Unknown
 }
+
+// getProcMem is used by GetProcRSS
+func getProcMem(hostfs resolve.Resolver, pid int) (ProcMemInfo, error) {
+	return getMemData(hostfs, pid)
+}
+
+// getProcCPU is used by GetProcCPUTicks
+func getProcCPU(hostfs resolve.Resolver, pid int) (ProcCPUInfo, error) {
+	cpu, _, err := getCPUTime(hostfs, pid)
+	return cpu, err
+}
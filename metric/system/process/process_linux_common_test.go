@@ -0,0 +1,1404 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build freebsd || linux
+// +build freebsd linux
+
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/numcpu"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetArgs(t *testing.T) {
+	cases := map[string][]string{
+		"java\x00-jar\x00my app.jar\x00": {"java", "-jar", "my app.jar"},
+		// setproctitle-style rewrites may drop the trailing NUL
+		"nginx: worker process": {"nginx: worker process"},
+		"":                      nil,
+	}
+
+	for raw, expected := range cases {
+		root := t.TempDir()
+		procDir := filepath.Join(root, "proc", "1")
+		require.NoError(t, os.MkdirAll(procDir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, "cmdline"), []byte(raw), 0o644))
+
+		args, err := getArgs(resolve.NewTestResolver(root), 1)
+		require.NoError(t, err)
+		assert.Equal(t, expected, args, "cmdline %q", raw)
+	}
+}
+
+func TestDecodeTTY(t *testing.T) {
+	cases := map[int]string{
+		0:                    "",
+		34816:                "pts/0",
+		34816 + 3:            "pts/3",
+		(137 << 8) | 2:       "pts/258",
+		(4 << 8) | 1:         "tty1",
+		(4 << 8) | 64:        "ttyS0",
+		(5 << 8) | 1:         "console",
+		(204 << 8) | 64:      "204:64",
+		(4 << 8) | (1 << 20): "ttyS192",
+	}
+	for ttyNr, expected := range cases {
+		assert.Equal(t, expected, decodeTTY(ttyNr), "tty_nr %d", ttyNr)
+	}
+}
+
+func TestGetInfoForPidSession(t *testing.T) {
+	state, err := GetInfoForPid(resolve.NewTestResolver("/"), os.Getpid())
+	require.NoError(t, err)
+	assert.Greater(t, state.SessionID.ValueOr(0), 0)
+	assert.Equal(t, state.SessionID.ValueOr(0) == os.Getpid(), state.IsSessionLeader)
+
+	testConfig := Stats{Procs: []string{".*"}}
+	require.NoError(t, testConfig.Init())
+	event, err := testConfig.getProcessEvent(&state)
+	require.NoError(t, err)
+	assert.Equal(t, state.IsSessionLeader, event["session_leader"])
+}
+
+func TestExitedProcessSkipped(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+
+	// A process that has exited after we've read /proc/[PID]/stat, so the rest of its files are gone
+	root := t.TempDir()
+	procDir := filepath.Join(root, "proc", "4242")
+	require.NoError(t, os.MkdirAll(procDir, 0o755))
+	stat := "4242 (exiting) S 1 4242 4242 0 -1 4194304 84 0 0 0 0 0 0 0 20 0 1 0 161454 2703360 272 18446744073709551615 " +
+		"1 1 1 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 1 1 1 1 1 1 1 0"
+	require.NoError(t, os.WriteFile(filepath.Join(procDir, "stat"), []byte(stat), 0o644))
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver(root),
+	}
+	require.NoError(t, testConfig.Init())
+
+	_, _, err := testConfig.pidFill(4242, true)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrProcNotExist), "expected ErrProcNotExist, got: %s", err)
+
+	procMap, plist, err := testConfig.FetchPids()
+	require.NoError(t, err)
+	assert.Empty(t, procMap)
+	assert.Empty(t, plist)
+	assert.Zero(t, logp.ObserverLogs().FilterMessageSnippet("Error fetching PID info").Len())
+}
+
+func TestGetByCgroup(t *testing.T) {
+	root := t.TempDir()
+	cgroupRoot := filepath.Join(root, "sys", "fs", "cgroup")
+	files := map[string]string{
+		"proc/stat":                            "cpu  0 0 0 0 0 0 0 0 0 0\nbtime 1700000000\n",
+		"proc/cgroups":                         "#subsys_name\thierarchy\tnum_cgroups\tenabled\nmemory\t0\t1\t1\n",
+		"proc/self/mountinfo":                  "26 25 0:23 / " + cgroupRoot + " rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw,nsdelegate\n",
+		"sys/fs/cgroup/memory.stat":            "anon 300\n",
+		"sys/fs/cgroup/docker/aaa/memory.stat": "anon 100\n",
+		"sys/fs/cgroup/docker/bbb/memory.stat": "anon 200\n",
+	}
+	// the last process is in the root cgroup, which is ignored
+	procs := map[string]string{"100": "/docker/aaa", "200": "/docker/bbb", "300": "/"}
+	for pid, cgroupPath := range procs {
+		procDir := filepath.Join("proc", pid)
+		files[filepath.Join(procDir, "stat")] = pid + " (synthetic) S 1 " + pid + " " + pid + " 0 -1 4194304 84 0 2 0 150 50 0 0 20 0 1 0 1000 2703360 272 18446744073709551615 " +
+			"1 1 1 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 1 1 1 1 1 1 1 0"
+		files[filepath.Join(procDir, "statm")] = "2048 512 128 1 0 100 0\n"
+		files[filepath.Join(procDir, "status")] = "Name:\tsynthetic\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\n"
+		files[filepath.Join(procDir, "cmdline")] = "/usr/bin/synthetic\x00"
+		files[filepath.Join(procDir, "limits")] = "Max open files            1024                 4096                 files\n"
+		files[filepath.Join(procDir, "fd", "0")] = ""
+		files[filepath.Join(procDir, "cgroup")] = "0::" + cgroupPath + "\n"
+	}
+	for name, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(contents), 0o644))
+	}
+	for pid := range procs {
+		require.NoError(t, os.Symlink("/usr/bin/synthetic", filepath.Join(root, "proc", pid, "exe")))
+		require.NoError(t, os.Symlink("/", filepath.Join(root, "proc", pid, "cwd")))
+	}
+
+	testConfig := Stats{
+		Procs:         []string{".*"},
+		Hostfs:        resolve.NewTestResolver(root),
+		EnableCgroups: true,
+		CgroupOpts: cgroup.ReaderOptions{
+			RootfsMountpoint:  resolve.NewTestResolver(root),
+			IgnoreRootCgroups: true,
+		},
+	}
+	require.NoError(t, testConfig.Init())
+
+	grouped, err := testConfig.GetByCgroup()
+	require.NoError(t, err)
+	require.Len(t, grouped, 3)
+	for id, cgroupPath := range map[string]string{"aaa": "/docker/aaa", "bbb": "/docker/bbb"} {
+		require.Len(t, grouped[cgroupPath], 1, cgroupPath)
+		got, err := grouped[cgroupPath][0].GetValue("cgroup.id")
+		require.NoError(t, err)
+		assert.Equal(t, id, got)
+		runtime, err := grouped[cgroupPath][0].GetValue("container_runtime")
+		require.NoError(t, err)
+		assert.Equal(t, "docker", runtime)
+	}
+	require.Len(t, grouped[""], 1)
+	assert.NotContains(t, grouped[""][0], "cgroup")
+	assert.NotContains(t, grouped[""][0], "container_runtime")
+
+	testConfig.EnableCgroups = false
+	_, err = testConfig.GetByCgroup()
+	assert.Error(t, err)
+}
+
+func TestProcsMapPruned(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	child := cmd.Process.Pid
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+
+	_, _, err := testConfig.Get()
+	require.NoError(t, err)
+	_, ok := testConfig.ProcsMap.GetPid(child)
+	require.True(t, ok, "child process %d not tracked", child)
+
+	require.NoError(t, cmd.Process.Kill())
+	_ = cmd.Wait()
+	// Entries added outside of Get(), such as by GetOne(), should also be pruned
+	testConfig.ProcsMap.SetPid(999999999, ProcState{})
+
+	plist, _, err := testConfig.Get()
+	require.NoError(t, err)
+	_, ok = testConfig.ProcsMap.GetPid(child)
+	assert.False(t, ok, "exited process %d should have been pruned", child)
+	_, ok = testConfig.ProcsMap.GetPid(999999999)
+	assert.False(t, ok)
+	assert.Equal(t, len(plist), testConfig.ProcsMap.Len())
+}
+
+func TestGetWChan(t *testing.T) {
+	// The result depends on the kernel config and what the test process is doing, so just make sure it doesn't fail
+	state, err := FillPidMetrics(resolve.NewTestResolver("/"), os.Getpid(), ProcState{}, func(string) bool { return false })
+	require.NoError(t, err)
+	t.Logf("wchan: %q", state.WChan)
+
+	root := t.TempDir()
+	procDir := filepath.Join(root, "proc", "1")
+	require.NoError(t, os.MkdirAll(procDir, 0o755))
+	hostfs := resolve.NewTestResolver(root)
+	assert.Equal(t, "", getWChan(hostfs, 1), "missing file")
+
+	require.NoError(t, os.WriteFile(filepath.Join(procDir, "wchan"), []byte("0"), 0o644))
+	assert.Equal(t, "", getWChan(hostfs, 1), "not waiting")
+
+	require.NoError(t, os.WriteFile(filepath.Join(procDir, "wchan"), []byte("do_wait"), 0o644))
+	assert.Equal(t, "do_wait", getWChan(hostfs, 1))
+}
+
+func TestStateDetail(t *testing.T) {
+	waitForState := func(pid int, want PidState) ProcState {
+		var state ProcState
+		require.Eventually(t, func() bool {
+			var err error
+			state, err = GetInfoForPid(resolve.NewTestResolver("/"), pid)
+			return err == nil && state.State == want
+		}, 5*time.Second, 10*time.Millisecond)
+		return state
+	}
+
+	// the child stays a zombie until we wait for it
+	zombie := exec.Command("sh", "-c", "exit 3")
+	require.NoError(t, zombie.Start())
+	t.Cleanup(func() { _ = zombie.Wait() })
+	state := waitForState(zombie.Process.Pid, Zombie)
+	assert.Equal(t, "exited with code 3", state.StateDetail)
+
+	stopped := exec.Command("sleep", "60")
+	require.NoError(t, stopped.Start())
+	t.Cleanup(func() {
+		_ = stopped.Process.Kill()
+		_ = stopped.Wait()
+	})
+	require.NoError(t, stopped.Process.Signal(syscall.SIGSTOP))
+	state = waitForState(stopped.Process.Pid, Stopped)
+	assert.Equal(t, fmt.Sprintf("stopped by signal %d", syscall.SIGSTOP), state.StateDetail)
+
+	// running and sleeping processes don't have a detail
+	state, err := GetInfoForPid(resolve.NewTestResolver("/"), os.Getpid())
+	require.NoError(t, err)
+	assert.Empty(t, state.StateDetail)
+}
+
+func TestPageFaults(t *testing.T) {
+	state, err := FillPidMetrics(resolve.NewTestResolver("/"), os.Getpid(), ProcState{}, func(string) bool { return false })
+	require.NoError(t, err)
+
+	// The counters are unsigned, so just check that they were read; any running Go process will have some minor faults.
+	require.True(t, state.Memory.MinFlt.Exists())
+	require.True(t, state.Memory.MajFlt.Exists())
+	require.True(t, state.Memory.ChildMinFlt.Exists())
+	require.True(t, state.Memory.ChildMajFlt.Exists())
+	assert.Greater(t, state.Memory.MinFlt.ValueOr(0), uint64(0))
+}
+
+func TestIncludeChildStats(t *testing.T) {
+	// reap a child, so there's something to account for
+	require.NoError(t, exec.Command("true").Run())
+
+	testConfig := Stats{
+		Procs:             []string{".*"},
+		Hostfs:            resolve.NewTestResolver("/"),
+		IncludeChildStats: true,
+	}
+	require.NoError(t, testConfig.Init())
+	event, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+
+	for _, key := range []string{"cpu.children.user.ticks", "cpu.children.system.ticks", "cpu.children.total.ticks"} {
+		value, err := event.GetValue(key)
+		require.NoError(t, err, key)
+		assert.GreaterOrEqual(t, value, uint64(0), key)
+	}
+
+	testConfig.IncludeChildStats = false
+	event, err = testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	_, err = event.GetValue("cpu.children")
+	assert.ErrorIs(t, err, mapstr.ErrKeyNotFound)
+}
+
+func TestIOWait(t *testing.T) {
+	cpu, _, err := getCPUTime(resolve.NewTestResolver("/"), os.Getpid())
+	require.NoError(t, err)
+	// absent unless delay accounting is enabled and we've waited on IO
+	if cpu.IOWait.Ticks.Exists() {
+		assert.Greater(t, cpu.IOWait.Ticks.ValueOr(0), uint64(0))
+	}
+
+	stat := "4242 (synthetic) S 1 4242 4242 0 -1 4194304 84 0 2 0 150 50 0 0 20 0 1 0 1000 2703360 272 18446744073709551615 " +
+		"1 1 1 0 0 0 0 0 0 0 0 0 17 0 0 0 %s 0 0 1 1 1 1 1 1 1 0"
+	for blkio, expected := range map[string]opt.Uint{"7": opt.UintWith(70), "0": opt.NewUintNone()} {
+		procfs := memProcFS{
+			Resolver: resolve.NewTestResolver("/"),
+			files: fstest.MapFS{
+				"proc/stat":      &fstest.MapFile{Data: []byte("btime 1700000000\n")},
+				"proc/4242/stat": &fstest.MapFile{Data: []byte(fmt.Sprintf(stat, blkio))},
+			},
+		}
+		cpu, _, err := getCPUTime(procfs, 4242)
+		require.NoError(t, err)
+		assert.Equal(t, expected, cpu.IOWait.Ticks, blkio)
+	}
+}
+
+// memProcFS is a resolver that serves procfs from memory
+type memProcFS struct {
+	resolve.Resolver
+	files fstest.MapFS
+	links map[string]string
+}
+
+// newMemProcFS returns a memProcFS without any processes
+func newMemProcFS() memProcFS {
+	return memProcFS{
+		Resolver: resolve.NewTestResolver("/"),
+		files: fstest.MapFS{
+			"proc/stat": &fstest.MapFile{Data: []byte("cpu  0 0 0 0 0 0 0 0 0 0\nbtime 1700000000\n")},
+		},
+		links: map[string]string{},
+	}
+}
+
+// addProc adds the minimal set of files needed to fetch the metrics of a process
+func (m memProcFS) addProc(pid string, rssPages int) {
+	files := map[string]string{
+		"stat": pid + " (synthetic) S 1 " + pid + " " + pid + " 0 -1 4194304 84 0 2 0 150 50 0 0 20 0 1 0 1000 2703360 272 18446744073709551615 " +
+			"1 1 1 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 1 1 1 1 1 1 1 0",
+		"statm":   fmt.Sprintf("2048 %d 128 1 0 100 0\n", rssPages),
+		"status":  "Name:\tsynthetic\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\n",
+		"cmdline": "/usr/bin/synthetic\x00",
+		"limits":  "Max open files            1024                 4096                 files\n",
+		"fd/0":    "",
+	}
+	for name, contents := range files {
+		m.files["proc/"+pid+"/"+name] = &fstest.MapFile{Data: []byte(contents)}
+	}
+	m.links["/proc/"+pid+"/exe"] = "/usr/bin/synthetic"
+	m.links["/proc/"+pid+"/cwd"] = "/"
+}
+
+func (m memProcFS) ReadFile(name string) ([]byte, error) {
+	return m.files.ReadFile(strings.TrimPrefix(name, "/"))
+}
+
+func (m memProcFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return m.files.ReadDir(strings.TrimPrefix(name, "/"))
+}
+
+func (m memProcFS) Readlink(name string) (string, error) {
+	link, ok := m.links[name]
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	}
+	return link, nil
+}
+
+func TestGetOneFromReader(t *testing.T) {
+	file := func(contents string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(contents)}
+	}
+	procfs := memProcFS{
+		Resolver: resolve.NewTestResolver("/"),
+		files: fstest.MapFS{
+			"proc/stat": file("cpu  0 0 0 0 0 0 0 0 0 0\nbtime 1700000000\n"),
+			"proc/4242/stat": file("4242 (synthetic) S 1 4242 4242 0 -1 4194304 84 0 2 0 150 50 0 0 20 0 1 0 1000 2703360 272 18446744073709551615 " +
+				"1 1 1 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 1 1 1 1 1 1 1 0"),
+			"proc/4242/statm":   file("2048 512 128 1 0 100 0\n"),
+			"proc/4242/status":  file("Name:\tsynthetic\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\n"),
+			"proc/4242/cmdline": file("/usr/bin/synthetic\x00--flag\x00"),
+			"proc/4242/environ": file("HOME=/root\x00"),
+			"proc/4242/limits":  file("Max open files            1024                 4096                 files\n"),
+			"proc/4242/fd/0":    file(""),
+			"proc/4242/fd/1":    file(""),
+			"proc/4242/wchan":   file("do_select"),
+		},
+		links: map[string]string{
+			"/proc/4242/exe": "/usr/bin/synthetic",
+			"/proc/4242/cwd": "/srv",
+		},
+	}
+
+	testConfig := Stats{
+		Procs:        []string{".*"},
+		Hostfs:       procfs,
+		CPUTicks:     true,
+		EnvWhitelist: []string{".*"},
+	}
+	require.NoError(t, testConfig.Init())
+
+	event, err := testConfig.GetOne(4242)
+	require.NoError(t, err)
+
+	expected := mapstr.M{
+		"pid":              4242,
+		"name":             "synthetic",
+		"state":            "sleeping",
+		"exe":              "/usr/bin/synthetic",
+		"cwd":              "/srv",
+		"cmdline":          "/usr/bin/synthetic --flag",
+		"env.HOME":         "/root",
+		"memory.rss.bytes": uint64(512 << 12),
+		"memory.size":      uint64(2048 << 12),
+		"cpu.total.ticks":  uint64(2000),
+		"fd.open":          uint64(2),
+		"fd.limit.soft":    uint64(1024),
+		"wchan":            "do_select",
+		"memory.majflt":    uint64(2),
+	}
+	for key, value := range expected {
+		got, err := event.GetValue(key)
+		require.NoError(t, err, key)
+		assert.EqualValues(t, value, got, key)
+	}
+
+	procMap, _, err := testConfig.FetchPids()
+	require.NoError(t, err)
+	assert.Contains(t, procMap, 4242)
+}
+
+// slowProcFS blocks reads of a single process's files until release is closed
+type slowProcFS struct {
+	memProcFS
+	slowPid string
+	release chan struct{}
+}
+
+func (m slowProcFS) ReadFile(name string) ([]byte, error) {
+	if strings.HasPrefix(name, "/proc/"+m.slowPid+"/") {
+		<-m.release
+	}
+	return m.memProcFS.ReadFile(name)
+}
+
+func TestPerProcTimeout(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 512)
+	procfs.addProc("4243", 512)
+	// every read of 4243 blocks, so its fill never finishes
+	slow := slowProcFS{memProcFS: procfs, slowPid: "4243", release: make(chan struct{})}
+
+	enriched := []int{}
+	testConfig := Stats{
+		Procs:          []string{".*"},
+		Hostfs:         slow,
+		PerProcTimeout: 50 * time.Millisecond,
+		Enrichers: []func(*ProcState) error{
+			func(state *ProcState) error {
+				enriched = append(enriched, state.Pid.ValueOr(0))
+				return nil
+			},
+		},
+	}
+	require.NoError(t, testConfig.Init())
+
+	procMap, plist, err := testConfig.FetchPids()
+	require.NoError(t, err)
+	require.Len(t, plist, 1)
+	assert.Contains(t, procMap, 4242)
+	assert.Equal(t, 1, logp.ObserverLogs().FilterMessageSnippet("Timed out fetching PID info for 4243").Len())
+
+	// the abandoned fill finishes during the next collection, without touching its state or calling the enrichers
+	close(slow.release)
+	_, plist, err = testConfig.FetchPids()
+	require.NoError(t, err)
+	require.Len(t, plist, 2)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, []int{4242, 4242, 4243}, enriched)
+}
+
+func TestMaxProcs(t *testing.T) {
+	procfs := newMemProcFS()
+	for i := 1; i <= 5; i++ {
+		procfs.addProc(strconv.Itoa(4240+i), i*100)
+	}
+
+	rootPids := func(roots []mapstr.M) []int {
+		pids := []int{}
+		for _, root := range roots {
+			pid, err := root.GetValue("process.pid")
+			require.NoError(t, err)
+			pids = append(pids, pid.(int))
+		}
+		return pids
+	}
+
+	cases := []struct {
+		name      string
+		maxProcs  int
+		top       IncludeTopConfig
+		pids      []int
+		truncated bool
+	}{
+		{name: "under the cap", maxProcs: 5, pids: []int{4241, 4242, 4243, 4244, 4245}},
+		{name: "over the cap", maxProcs: 3, pids: []int{4241, 4242, 4243}, truncated: true},
+		{name: "after IncludeTop", maxProcs: 2, top: IncludeTopConfig{Enabled: true, ByMemory: 4}, pids: []int{4245, 4244}, truncated: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			testConfig := Stats{
+				Procs:      []string{".*"},
+				Hostfs:     procfs,
+				MaxProcs:   tc.maxProcs,
+				IncludeTop: tc.top,
+			}
+			require.NoError(t, testConfig.Init())
+
+			procs, roots, err := testConfig.Get()
+			require.NoError(t, err)
+			require.Len(t, procs, len(tc.pids))
+			pids := rootPids(roots)
+			if !tc.top.active() {
+				sort.Ints(pids)
+			}
+			assert.Equal(t, tc.pids, pids)
+			for _, root := range roots {
+				truncated, _ := root.GetValue("process.truncated")
+				assert.Equal(t, tc.truncated, truncated == true)
+			}
+		})
+	}
+}
+
+func TestDetectEnvChanges(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	setEnv := func(env string) {
+		procfs.files["proc/4242/environ"] = &fstest.MapFile{Data: []byte(env)}
+	}
+	setEnv("FOO=bar\x00HOME=/root\x00")
+
+	testConfig := Stats{
+		Procs:            []string{".*"},
+		Hostfs:           procfs,
+		EnvWhitelist:     []string{"FOO", "HOME"},
+		DetectEnvChanges: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	// nothing to compare against on the first fetch
+	event, err := testConfig.GetOne(4242)
+	require.NoError(t, err)
+	_, err = event.GetValue("env_changed")
+	assert.ErrorIs(t, err, mapstr.ErrKeyNotFound)
+
+	setEnv("FOO=baz\x00HOME=/root\x00")
+	event, err = testConfig.GetOne(4242)
+	require.NoError(t, err)
+	changed, err := event.GetValue("env_changed")
+	require.NoError(t, err)
+	assert.Equal(t, true, changed)
+	keys, err := event.GetValue("env_changed_keys")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"FOO"}, keys)
+	env, err := event.GetValue("env.FOO")
+	require.NoError(t, err)
+	assert.Equal(t, "baz", env)
+
+	event, err = testConfig.GetOne(4242)
+	require.NoError(t, err)
+	changed, err = event.GetValue("env_changed")
+	require.NoError(t, err)
+	assert.Equal(t, false, changed)
+	_, err = event.GetValue("env_changed_keys")
+	assert.ErrorIs(t, err, mapstr.ErrKeyNotFound)
+}
+
+func TestCacheSelf(t *testing.T) {
+	self := strconv.Itoa(os.Getpid())
+	procfs := newMemProcFS()
+	procfs.addProc(self, 100)
+
+	testConfig := Stats{
+		Procs:     []string{".*"},
+		Hostfs:    procfs,
+		CacheSelf: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	state, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/synthetic", state.Exe)
+	assert.Equal(t, "/", state.Cwd)
+
+	// the exe is reused from the first call, but cwd and metrics are fetched again
+	procfs.links["/proc/"+self+"/exe"] = "/usr/bin/replaced"
+	procfs.links["/proc/"+self+"/cwd"] = "/tmp"
+	procfs.files["proc/"+self+"/statm"] = &fstest.MapFile{Data: []byte("2048 200 128 1 0 100 0\n")}
+	state, err = testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/synthetic", state.Exe)
+	assert.Equal(t, "/tmp", state.Cwd)
+	assert.Equal(t, uint64(200*os.Getpagesize()), state.Memory.Rss.Bytes.ValueOr(0))
+
+	testConfig.CacheSelf = false
+	state, err = testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/replaced", state.Exe)
+}
+
+func TestCPUPercentageWithClock(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+	clock := time.Unix(1700000000, 0)
+	testConfig.now = func() time.Time { return clock }
+
+	_, err := testConfig.GetOne(4242)
+	require.NoError(t, err)
+
+	// 1000ms of user time over 2s of wall-clock time
+	stat, err := procfs.ReadFile("/proc/4242/stat")
+	require.NoError(t, err)
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte(" 150 50 "), []byte(" 250 50 "), 1)}
+	clock = clock.Add(2 * time.Second)
+
+	event, err := testConfig.GetOne(4242)
+	require.NoError(t, err)
+	pct, err := event.GetValue("cpu.total.pct")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, pct)
+}
+
+func TestCounterSet(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.addProc("4343", 100)
+
+	testConfig := Stats{
+		Procs:    []string{".*"},
+		Hostfs:   procfs,
+		CPUTicks: true,
+		Counters: NewCounterSet("cpu.total.ticks", "memory.minflt", "no.such.counter"),
+	}
+	require.NoError(t, testConfig.Init())
+	clock := time.Unix(1700000000, 0)
+	testConfig.now = func() time.Time { return clock }
+
+	// ratesByPid collects the processes, and returns the rates of each one, if it has any
+	ratesByPid := func() map[int]mapstr.M {
+		procs, roots, err := testConfig.Get()
+		require.NoError(t, err)
+		rates := map[int]mapstr.M{}
+		for i, proc := range procs {
+			pid, err := roots[i].GetValue("process.pid")
+			require.NoError(t, err)
+			if value, err := proc.GetValue("rates"); err == nil {
+				rates[pid.(int)] = value.(mapstr.M)
+			}
+		}
+		return rates
+	}
+
+	// nothing to compare the first sample against
+	assert.Empty(t, ratesByPid())
+
+	// 4242 used 1000ms of CPU and had 20 more minor faults over 2s.
+	// 4343's fault counter went down, so it was reset and has no rate.
+	replaceStat := func(pid, from, to string) {
+		stat, err := procfs.ReadFile("/proc/" + pid + "/stat")
+		require.NoError(t, err)
+		procfs.files["proc/"+pid+"/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte(from), []byte(to), 1)}
+	}
+	replaceStat("4242", " 150 50 ", " 250 50 ")
+	replaceStat("4242", " 84 0 2 0 ", " 104 0 2 0 ")
+	replaceStat("4343", " 84 0 2 0 ", " 4 0 2 0 ")
+	clock = clock.Add(2 * time.Second)
+
+	rates := ratesByPid()
+	assert.Equal(t, mapstr.M{"cpu": mapstr.M{"total": mapstr.M{"ticks": 500.0}}, "memory": mapstr.M{"minflt": 10.0}}, rates[4242])
+	assert.Equal(t, mapstr.M{"cpu": mapstr.M{"total": mapstr.M{"ticks": 0.0}}}, rates[4343])
+
+	// a new start time is a new process, which starts over
+	replaceStat("4242", " 1000 ", " 2000 ")
+	clock = clock.Add(2 * time.Second)
+	rates = ratesByPid()
+	assert.NotContains(t, rates, 4242)
+	assert.Contains(t, rates, 4343)
+}
+
+func TestStatLargeCounters(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	// utime and stime at the largest values the kernel can print, cutime past the exact range of a float64,
+	// and page faults and a start time that don't fit in 32 bits
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: []byte("4242 (synthetic) S 1 4242 4242 0 -1 4194304 " +
+		"18446744073709551615 0 8589934592 0 18446744073709551615 18446744073709551615 123456789012345678 0 20 0 1 0 " +
+		"18446744073709551615 2703360 272 18446744073709551615 1 1 1 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 1 1 1 1 1 1 1 0")}
+
+	cpu, faults, err := getCPUTime(procfs, 4242)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), cpu.User.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(math.MaxUint64), cpu.System.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(math.MaxUint64), cpu.Total.Ticks.ValueOr(0), "the total should be capped, not wrapped")
+	assert.Equal(t, uint64(1234567890123456780), cpu.Children.User.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(1234567890123456780), cpu.Children.Total.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(math.MaxUint64), faults.MinFlt.ValueOr(0))
+	assert.Equal(t, uint64(8589934592), faults.MajFlt.ValueOr(0))
+	assert.NotEmpty(t, cpu.StartTime)
+	assert.False(t, strings.HasPrefix(cpu.StartTime, "-"), "start time %s is before the epoch", cpu.StartTime)
+
+	testConfig := Stats{
+		Procs:    []string{".*"},
+		Hostfs:   procfs,
+		CPUTicks: true,
+	}
+	require.NoError(t, testConfig.Init())
+	event, err := testConfig.GetOne(4242)
+	require.NoError(t, err)
+	total, err := event.GetValue("cpu.total.ticks")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), total)
+}
+
+func TestStatCommWithSpaces(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	stat, err := procfs.ReadFile("/proc/4242/stat")
+	require.NoError(t, err)
+	plain, _, err := getCPUTime(procfs, 4242)
+	require.NoError(t, err)
+
+	// the fields after comm are found from its last ")"
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte("(synthetic)"), []byte("(Web (Content) 1)"), 1)}
+	cpu, _, err := getCPUTime(procfs, 4242)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1500), cpu.User.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(500), cpu.System.Ticks.ValueOr(0))
+	assert.Equal(t, plain.StartTime, cpu.StartTime)
+
+	// every field read from the stat file is found past a comm with spaces
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: []byte("4242 (Web (Content) 1) S 1 4242 4242 0 -1 4194304 11 12 13 14 150 50 16 17 20 0 1 0 1000 " +
+		"2703360 272 18446744073709551615 1 1 1 0 0 0 0 0 0 0 0 0 17 3 0 1 7 0 0")}
+	cpu, faults, err := getCPUTime(procfs, 4242)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(11), faults.MinFlt.ValueOr(0))
+	assert.Equal(t, uint64(12), faults.ChildMinFlt.ValueOr(0))
+	assert.Equal(t, uint64(13), faults.MajFlt.ValueOr(0))
+	assert.Equal(t, uint64(14), faults.ChildMajFlt.ValueOr(0))
+	assert.Equal(t, metric.TicksToMsUint(16), cpu.Children.User.Ticks.ValueOr(0))
+	assert.Equal(t, metric.TicksToMsUint(17), cpu.Children.System.Ticks.ValueOr(0))
+	assert.Equal(t, 3, cpu.LastCPU.ValueOr(-1))
+	assert.Equal(t, "fifo", cpu.SchedPolicy)
+	assert.Equal(t, metric.TicksToMsUint(7), cpu.IOWait.Ticks.ValueOr(0))
+	assert.Equal(t, plain.StartTime, cpu.StartTime)
+
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: []byte("4242 (synthetic S 1")}
+	_, _, err = getCPUTime(procfs, 4242)
+	assert.Error(t, err)
+}
+
+func TestLargePID(t *testing.T) {
+	const pid = math.MaxInt32 - 1
+	procfs := newMemProcFS()
+	procfs.addProc(strconv.Itoa(pid), 100)
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+
+	state, err := GetInfoForPid(procfs, pid)
+	require.NoError(t, err)
+	assert.Equal(t, pid, state.Pid.ValueOr(0))
+	assert.Equal(t, pid, state.Pgid.ValueOr(0))
+	assert.Equal(t, pid, state.SessionID.ValueOr(0))
+	assert.True(t, state.IsSessionLeader)
+
+	procs, roots, err := testConfig.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 1)
+	rootPid, err := roots[0].GetValue("process.pid")
+	require.NoError(t, err)
+	assert.Equal(t, pid, rootPid)
+}
+
+func TestProcNameRewrite(t *testing.T) {
+	procfs := newMemProcFS()
+	for pid, name := range map[string]string{"4242": "myapp-1.2.3", "4243": "myapp-1.3.0"} {
+		procfs.addProc(pid, 100)
+		stat, err := procfs.ReadFile("/proc/" + pid + "/stat")
+		require.NoError(t, err)
+		procfs.files["proc/"+pid+"/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte("(synthetic)"), []byte("("+name+")"), 1)}
+		procfs.links["/proc/"+pid+"/exe"] = "/opt/myapp/bin/" + name
+	}
+
+	testConfig := Stats{
+		Procs:           []string{`^myapp-[0-9.]+$`},
+		ProcNameRewrite: []NameRewriteConfig{{Pattern: `^(myapp)-[0-9.]+$`, Replace: "${1}"}},
+		IncludeTop:      IncludeTopConfig{Enabled: true, ByMemory: 2},
+		Hostfs:          procfs,
+	}
+	require.NoError(t, testConfig.Init())
+
+	procs, roots, err := testConfig.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 2)
+	for _, root := range roots {
+		name, err := root.GetValue("process.name")
+		require.NoError(t, err)
+		assert.Equal(t, "myapp", name)
+	}
+
+	testConfig.ProcNameRewrite = []NameRewriteConfig{{Pattern: `(`}}
+	require.Error(t, testConfig.Init())
+}
+
+func TestGetOneTyped(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+
+	state, err := testConfig.GetOneTyped(4242)
+	require.NoError(t, err)
+	assert.Equal(t, 4242, state.Pid.ValueOr(0))
+	assert.Equal(t, uint64(100*os.Getpagesize()), state.Memory.Rss.Bytes.ValueOr(0))
+
+	event, err := testConfig.GetOne(4242)
+	require.NoError(t, err)
+	rss, err := event.GetValue("memory.rss.bytes")
+	require.NoError(t, err)
+	assert.Equal(t, state.Memory.Rss.Bytes.ValueOr(0), rss)
+}
+
+func TestCommName(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	stat, err := procfs.ReadFile("/proc/4242/stat")
+	require.NoError(t, err)
+	// the kernel truncates the command name to 15 bytes
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte("(synthetic)"), []byte("(a-very-long-exe)"), 1)}
+	procfs.links["/proc/4242/exe"] = "/usr/bin/a-very-long-executable-name (deleted)"
+
+	testConfig := Stats{
+		Procs:  []string{"^a-very-long-exe$"},
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+
+	procs, roots, err := testConfig.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 1)
+	name, err := roots[0].GetValue("process.name")
+	require.NoError(t, err)
+	assert.Equal(t, "a-very-long-executable-name", name)
+	comm, err := procs[0].GetValue("comm")
+	require.NoError(t, err)
+	assert.Equal(t, "a-very-long-exe", comm)
+
+	// without a known executable, the name is the comm
+	procfs.addProc("4243", 100)
+	procfs.links["/proc/4243/exe"] = ""
+	state, err := testConfig.GetOneTyped(4243)
+	require.NoError(t, err)
+	assert.Equal(t, "synthetic", state.Name)
+	assert.Equal(t, "synthetic", state.CommName)
+}
+
+func TestMatchCmdline(t *testing.T) {
+	procfs := newMemProcFS()
+	for pid, jar := range map[string]string{"4242": "a.jar", "4243": "b.jar"} {
+		procfs.addProc(pid, 100)
+		procfs.files["proc/"+pid+"/cmdline"] = &fstest.MapFile{Data: []byte("java\x00-jar\x00" + jar + "\x00")}
+	}
+
+	testConfig := Stats{
+		Procs:        []string{`-jar a\.jar`},
+		MatchCmdline: true,
+		Hostfs:       procfs,
+	}
+	require.NoError(t, testConfig.Init())
+
+	procs, roots, err := testConfig.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 1)
+	pid, err := roots[0].GetValue("process.pid")
+	require.NoError(t, err)
+	assert.Equal(t, 4242, pid)
+
+	// names are still matched
+	testConfig.Procs = []string{"^synthetic$"}
+	require.NoError(t, testConfig.Init())
+	procs, _, err = testConfig.Get()
+	require.NoError(t, err)
+	assert.Len(t, procs, 2)
+
+	testConfig.Procs = []string{`-jar a\.jar`}
+	testConfig.MatchCmdline = false
+	require.NoError(t, testConfig.Init())
+	procs, _, err = testConfig.Get()
+	require.NoError(t, err)
+	assert.Empty(t, procs)
+}
+
+func TestGetMemorySynthetic(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.addProc("4243", 200)
+	// 4244 exits before its memory is read
+	procfs.addProc("4244", 300)
+	delete(procfs.files, "proc/4244/statm")
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+
+	procs, err := testConfig.GetMemory()
+	require.NoError(t, err)
+	require.Len(t, procs, 2)
+	sort.Slice(procs, func(i, j int) bool { return procs[i].Pid.ValueOr(0) < procs[j].Pid.ValueOr(0) })
+	for i, rssPages := range []uint64{100, 200} {
+		assert.Equal(t, 4242+i, procs[i].Pid.ValueOr(0))
+		assert.Equal(t, "synthetic", procs[i].Name)
+		assert.Equal(t, rssPages<<12, procs[i].Memory.Rss.Bytes.ValueOr(0))
+		assert.Equal(t, uint64(2048<<12), procs[i].Memory.Size.ValueOr(0))
+		assert.True(t, procs[i].CPU.IsZero())
+		assert.Empty(t, procs[i].Args)
+		assert.Nil(t, procs[i].Env)
+	}
+}
+
+func TestMatchingPIDs(t *testing.T) {
+	procfs := newMemProcFS()
+	for pid, name := range map[string]string{"4242": "nginx", "4243": "nginx", "4244": "postgres"} {
+		procfs.addProc(pid, 100)
+		stat, err := procfs.ReadFile("/proc/" + pid + "/stat")
+		require.NoError(t, err)
+		procfs.files["proc/"+pid+"/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte("(synthetic)"), []byte("("+name+")"), 1)}
+	}
+
+	testConfig := Stats{
+		Procs:    []string{"^nginx$"},
+		Hostfs:   procfs,
+		MaxProcs: 1,
+	}
+	require.NoError(t, testConfig.Init())
+
+	matching, err := testConfig.MatchingPIDs()
+	require.NoError(t, err)
+	require.Len(t, matching, 2)
+	for _, proc := range matching {
+		assert.Equal(t, "nginx", proc.Name)
+		assert.False(t, proc.Memory.Rss.Bytes.Exists())
+	}
+
+	testConfig.MaxProcs = 0
+	procs, _, err := testConfig.Get()
+	require.NoError(t, err)
+	assert.Len(t, procs, len(matching))
+}
+
+func TestTrackByName(t *testing.T) {
+	procfs := newMemProcFS()
+	addNginx := func(pid string, startTime string) {
+		procfs.addProc(pid, 100)
+		stat, err := procfs.ReadFile("/proc/" + pid + "/stat")
+		require.NoError(t, err)
+		stat = bytes.Replace(stat, []byte("(synthetic)"), []byte("(nginx)"), 1)
+		stat = bytes.Replace(stat, []byte(" 0 1000 "), []byte(" 0 "+startTime+" "), 1)
+		procfs.files["proc/"+pid+"/stat"] = &fstest.MapFile{Data: stat}
+		procfs.links["/proc/"+pid+"/exe"] = "/usr/sbin/nginx"
+	}
+	removeProc := func(pid string) {
+		for name := range procfs.files {
+			if strings.HasPrefix(name, "proc/"+pid+"/") {
+				delete(procfs.files, name)
+			}
+		}
+	}
+	addNginx("4242", "1000")
+	procfs.addProc("4243", 100)
+
+	testConfig := Stats{
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+	clock := time.Unix(1700000000, 0)
+	testConfig.now = func() time.Time { return clock }
+
+	tracker, err := testConfig.TrackByName("^nginx$")
+	require.NoError(t, err)
+
+	sample := func() (ProcState, TrackerSample) {
+		result, err := tracker.Sample()
+		require.NoError(t, err)
+		require.Len(t, result.Processes, 1)
+		clock = clock.Add(time.Second)
+		return result.Processes[0], result
+	}
+
+	proc, result := sample()
+	assert.Equal(t, 4242, proc.Pid.ValueOr(0))
+	assert.False(t, proc.CPU.Total.Pct.Exists())
+	assert.False(t, result.Restarted)
+	proc, result = sample()
+	assert.True(t, proc.CPU.Total.Pct.Exists())
+	assert.False(t, result.Restarted)
+
+	// restart nginx with a new PID
+	removeProc("4242")
+	addNginx("5151", "2000")
+
+	proc, result = sample()
+	assert.Equal(t, 5151, proc.Pid.ValueOr(0))
+	assert.False(t, proc.CPU.Total.Pct.Exists())
+	assert.True(t, result.Restarted)
+	assert.Equal(t, 1, result.Restarts)
+	proc, result = sample()
+	assert.True(t, proc.CPU.Total.Pct.Exists())
+	assert.False(t, result.Restarted)
+
+	// restart it again with the same PID, which only changes the start time
+	addNginx("5151", "3000")
+
+	proc, result = sample()
+	assert.Equal(t, 5151, proc.Pid.ValueOr(0))
+	assert.False(t, proc.CPU.Total.Pct.Exists(), "percentages shouldn't be computed against the previous process")
+	assert.True(t, result.Restarted)
+	assert.Equal(t, 2, result.Restarts)
+	proc, result = sample()
+	assert.True(t, proc.CPU.Total.Pct.Exists())
+	assert.False(t, result.Restarted)
+	assert.Equal(t, 2, result.Restarts)
+}
+
+func TestEntityID(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.files["proc/sys/kernel/random/boot_id"] = &fstest.MapFile{Data: []byte("2f5e4d2c-7b8a-4c1d-9e3f-0a1b2c3d4e5f\n")}
+	procfs.addProc("4242", 100)
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+
+	first, err := testConfig.GetOneTyped(4242)
+	require.NoError(t, err)
+	require.NotEmpty(t, first.EntityID)
+	second, err := testConfig.GetOneTyped(4242)
+	require.NoError(t, err)
+	assert.Equal(t, first.EntityID, second.EntityID)
+
+	// the PID is reused by a process that started later
+	stat, err := procfs.ReadFile("/proc/4242/stat")
+	require.NoError(t, err)
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte(" 0 1000 "), []byte(" 0 5000 "), 1)}
+	reused, err := testConfig.GetOneTyped(4242)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.EntityID, reused.EntityID)
+
+	// the same PID and start time after a reboot
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: stat}
+	procfs.files["proc/sys/kernel/random/boot_id"] = &fstest.MapFile{Data: []byte("9a8b7c6d-5e4f-4a3b-2c1d-0e9f8a7b6c5d\n")}
+	require.NoError(t, testConfig.Init())
+	rebooted, err := testConfig.GetOneTyped(4242)
+	require.NoError(t, err)
+	assert.NotEqual(t, first.EntityID, rebooted.EntityID)
+}
+
+func TestLastCollectionStats(t *testing.T) {
+	procfs := newMemProcFS()
+	for pid, name := range map[string]string{"4242": "nginx", "4243": "postgres", "4244": "nginx"} {
+		procfs.addProc(pid, 100)
+		stat, err := procfs.ReadFile("/proc/" + pid + "/stat")
+		require.NoError(t, err)
+		procfs.files["proc/"+pid+"/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte("(synthetic)"), []byte("("+name+")"), 1)}
+	}
+	// the process exits after we've listed it
+	delete(procfs.files, "proc/4244/statm")
+
+	testConfig := Stats{
+		Procs:  []string{"^nginx$"},
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+	clock := time.Unix(1700000000, 0)
+	testConfig.now = func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+
+	procs, _, err := testConfig.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 1)
+
+	stats := testConfig.LastCollectionStats()
+	assert.Equal(t, 3, stats.Seen)
+	assert.Equal(t, 1, stats.Emitted)
+	assert.Equal(t, 1, stats.Filtered)
+	assert.Equal(t, CollectionErrors{Exited: 1}, stats.Errors)
+	assert.Equal(t, stats.Seen, stats.Emitted+stats.Skipped())
+	assert.Greater(t, stats.Duration, time.Duration(0))
+}
+
+func TestSkipKernelThreads(t *testing.T) {
+	procfs := newMemProcFS()
+	setStat := func(pid, name, ppid string) {
+		stat, err := procfs.ReadFile("/proc/" + pid + "/stat")
+		require.NoError(t, err)
+		stat = bytes.Replace(stat, []byte("(synthetic) S 1 "), []byte("("+name+") S "+ppid+" "), 1)
+		procfs.files["proc/"+pid+"/stat"] = &fstest.MapFile{Data: stat}
+	}
+	procfs.addProc("1", 100)
+	setStat("1", "systemd", "0")
+	procfs.addProc("2", 0)
+	setStat("2", "kthreadd", "0")
+	procfs.addProc("40", 0)
+	setStat("40", "kworker/0:1", "2")
+	// a userspace process started by kthreadd, such as a usermode helper, still has a command line
+	procfs.addProc("41", 100)
+	setStat("41", "modprobe", "2")
+	for _, pid := range []string{"2", "40"} {
+		procfs.files["proc/"+pid+"/cmdline"] = &fstest.MapFile{Data: []byte{}}
+	}
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: procfs,
+	}
+	require.NoError(t, testConfig.Init())
+	_, plist, err := testConfig.FetchPids()
+	require.NoError(t, err)
+	assert.Len(t, plist, 4)
+
+	testConfig.SkipKernelThreads = true
+	require.NoError(t, testConfig.Init())
+	_, plist, err = testConfig.FetchPids()
+	require.NoError(t, err)
+	pids := []int{}
+	for _, proc := range plist {
+		pids = append(pids, proc.Pid.ValueOr(0))
+	}
+	sort.Ints(pids)
+	assert.Equal(t, []int{1, 41}, pids)
+
+	// asking for a kernel thread by PID still works
+	kworker, err := testConfig.GetOneTyped(40)
+	require.NoError(t, err)
+	assert.Equal(t, 2, kworker.Ppid.ValueOr(0))
+
+	// kernel threads past MaxProcs don't count as processes that were left out
+	delete(procfs.files, "proc/41/stat")
+	testConfig.MaxProcs = 1
+	require.NoError(t, testConfig.Init())
+	procs, roots, err := testConfig.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 1)
+	truncated, _ := roots[0].GetValue("process.truncated")
+	assert.Nil(t, truncated)
+}
+
+func TestLastCPU(t *testing.T) {
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	require.True(t, self.CPU.LastCPU.Exists())
+	assert.GreaterOrEqual(t, self.CPU.LastCPU.ValueOr(-1), 0)
+	assert.Less(t, self.CPU.LastCPU.ValueOr(-1), numcpu.NumCPU())
+
+	// processor is the 39th field, after exit_signal
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	stat, err := procfs.ReadFile("/proc/4242/stat")
+	require.NoError(t, err)
+	procfs.files["proc/4242/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte(" 17 0 "), []byte(" 17 3 "), 1)}
+	testConfig.Hostfs = procfs
+	require.NoError(t, testConfig.Init())
+
+	proc, err := testConfig.GetOne(4242)
+	require.NoError(t, err)
+	lastCPU, err := proc.GetValue("cpu.last_cpu")
+	require.NoError(t, err)
+	assert.Equal(t, 3, lastCPU)
+}
+
+func TestSchedPolicy(t *testing.T) {
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Contains(t, []string{"other", "fifo", "rr", "batch", "idle", "deadline"}, self.CPU.SchedPolicy)
+	policy, _, errno := syscall.Syscall(syscall.SYS_SCHED_GETSCHEDULER, 0, 0, 0)
+	require.Zero(t, errno)
+	assert.Equal(t, schedPolicyName(int(policy)), self.CPU.SchedPolicy)
+
+	// policy is the 41st field, after rt_priority
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.addProc("4343", 100)
+	stat, err := procfs.ReadFile("/proc/4343/stat")
+	require.NoError(t, err)
+	procfs.files["proc/4343/stat"] = &fstest.MapFile{Data: bytes.Replace(stat, []byte(" 17 0 0 0 "), []byte(" 17 0 50 1 "), 1)}
+	testConfig.Hostfs = procfs
+	require.NoError(t, testConfig.Init())
+
+	for pid, policy := range map[int]string{4242: "other", 4343: "fifo"} {
+		proc, err := testConfig.GetOne(pid)
+		require.NoError(t, err)
+		value, err := proc.GetValue("cpu.sched_policy")
+		require.NoError(t, err)
+		assert.Equal(t, policy, value, "pid %d", pid)
+	}
+}
+
+func TestCmdlinePrefixLen(t *testing.T) {
+	prefix, binary := ArgsPrefix([]string{"/usr/bin/java", "-jar", "app.jar"}, 2)
+	assert.Equal(t, []string{"/usr/bin/java", "-jar"}, prefix)
+	assert.Equal(t, "java", binary)
+	prefix, binary = ArgsPrefix([]string{"/usr/bin/java", "-jar"}, 0)
+	assert.Equal(t, []string{"/usr/bin/java", "-jar"}, prefix)
+	assert.Equal(t, "java", binary)
+	prefix, binary = ArgsPrefix(nil, 1)
+	assert.Empty(t, prefix)
+	assert.Empty(t, binary)
+
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.files["proc/4242/cmdline"] = &fstest.MapFile{Data: []byte("/usr/bin/java\x00-Xmx2g\x00-jar\x00/opt/app/app.jar\x00")}
+
+	testConfig := Stats{
+		Procs:            []string{"app.jar"},
+		Hostfs:           procfs,
+		MatchCmdline:     true,
+		CmdlinePrefixLen: 1,
+	}
+	require.NoError(t, testConfig.Init())
+
+	// the process is still matched on the arguments that are dropped
+	state, saved, err := testConfig.pidFill(4242, true)
+	require.NoError(t, err)
+	require.True(t, saved)
+	assert.Equal(t, []string{"/usr/bin/java"}, state.Args)
+	assert.Equal(t, "/usr/bin/java", state.Cmdline)
+	assert.True(t, state.CmdlineTruncated)
+
+	// the byte limit still applies to what's left
+	testConfig.CmdlinePrefixLen = 3
+	testConfig.MaxCmdlineBytes = 10
+	state, _, err = testConfig.pidFill(4242, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/usr/bin/java", "-Xmx2g", "-jar"}, state.Args)
+	assert.Equal(t, "/usr/bin/j"+cmdlineTruncatedMarker, state.Cmdline)
+
+	testConfig.CmdlinePrefixLen = 0
+	testConfig.MaxCmdlineBytes = 0
+	state, _, err = testConfig.pidFill(4242, true)
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/java -Xmx2g -jar /opt/app/app.jar", state.Cmdline)
+	assert.False(t, state.CmdlineTruncated)
+}
+
+func TestEnrichers(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.addProc("4243", 100)
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: procfs,
+		Enrichers: []func(*ProcState) error{
+			func(state *ProcState) error {
+				if state.Pid.ValueOr(0) == 4243 {
+					return errors.New("no service found")
+				}
+				state.Annotations = mapstr.M{"service": mapstr.M{"tag": "web"}}
+				return nil
+			},
+			func(state *ProcState) error {
+				// later enrichers see the fields set by earlier ones
+				if state.Annotations != nil {
+					_, err := state.Annotations.Put("service.exe", state.Exe)
+					return err
+				}
+				return nil
+			},
+		},
+	}
+	require.NoError(t, testConfig.Init())
+
+	procs, roots, err := testConfig.Get()
+	require.NoError(t, err)
+	require.Len(t, procs, 2)
+	byPid := map[interface{}]mapstr.M{}
+	for i, root := range roots {
+		pid, err := root.GetValue("process.pid")
+		require.NoError(t, err)
+		byPid[pid] = procs[i]
+	}
+	tag, err := byPid[4242].GetValue("service.tag")
+	require.NoError(t, err)
+	assert.Equal(t, "web", tag)
+	exe, err := byPid[4242].GetValue("service.exe")
+	require.NoError(t, err)
+	assert.Equal(t, "/usr/bin/synthetic", exe)
+
+	// the failed enricher doesn't stop the process from being reported
+	assert.NotContains(t, byPid[4243], "service")
+	assert.Equal(t, 1, logp.ObserverLogs().FilterMessageSnippet("error enriching process 4243").Len())
+}
+
+func TestExcludeSelf(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	child := cmd.Process.Pid
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	reportedPids := func(testConfig *Stats) map[int]bool {
+		_, roots, err := testConfig.Get()
+		require.NoError(t, err)
+		pids := map[int]bool{}
+		for _, root := range roots {
+			pid, err := root.GetValue("process.pid")
+			require.NoError(t, err)
+			pids[pid.(int)] = true
+		}
+		return pids
+	}
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+	pids := reportedPids(&testConfig)
+	assert.True(t, pids[os.Getpid()])
+	assert.True(t, pids[child])
+
+	testConfig.ExcludeSelf = true
+	pids = reportedPids(&testConfig)
+	assert.False(t, pids[os.Getpid()], "self PID %d should be excluded", os.Getpid())
+	assert.True(t, pids[child], "child PID %d should still be reported", child)
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), self.Pid.ValueOr(0))
+}
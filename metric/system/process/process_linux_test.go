@@ -21,10 +21,12 @@
 package process
 
 import (
+	"net"
 	"os"
 	"os/user"
 	"strconv"
 	"testing"
+	"testing/fstest"
 
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
@@ -56,9 +58,13 @@ func TestFetchProcessFromOtherUser(t *testing.T) {
 			t.Logf("Error converting PID name %s", name)
 			continue
 		}
-		pidUser, err := getUser(resolve.NewTestResolver("/"), pid)
+		status, err := getProcStatus(resolve.NewTestResolver("/"), pid)
+		if err != nil {
+			continue
+		}
+		uids, err := getIDs(status, "Uid")
 		if err == nil {
-			if pidUser != us.Name {
+			if getUser(uids[0]) != us.Name {
 				testPid = pid
 				break
 			}
@@ -97,3 +103,126 @@ func TestFetchProcessFromOtherUser(t *testing.T) {
 	require.NoError(t, err)
 	t.Logf("got: %s", pidData.StringToPrint())
 }
+
+func TestGetSockets(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	testConfig := Stats{Hostfs: resolve.NewTestResolver("/")}
+	err = testConfig.Init()
+	require.NoError(t, err)
+
+	sockets, err := testConfig.GetSockets(os.Getpid())
+	require.NoError(t, err)
+
+	found := false
+	for _, socket := range sockets {
+		if socket.Local.Port == port {
+			found = true
+			assert.Equal(t, "tcp", socket.Protocol)
+			assert.Equal(t, "127.0.0.1", socket.Local.IP)
+			assert.Equal(t, "listen", socket.State)
+			assert.NotZero(t, socket.Inode)
+		}
+	}
+	assert.True(t, found, "listening socket on port %d not found", port)
+}
+
+func TestGetSocketsFromReader(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.files["proc/4242/fd/3"] = &fstest.MapFile{}
+	procfs.files["proc/4242/fd/4"] = &fstest.MapFile{}
+	procfs.links["/proc/4242/fd/3"] = "socket:[12345]"
+	procfs.links["/proc/4242/fd/4"] = "/var/log/app.log"
+	procfs.files["proc/4242/net/tcp"] = &fstest.MapFile{Data: []byte(
+		"  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 12345 1 0000000000000000 100 0 0 10 0\n" +
+			"   1: 0100007F:1F91 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 54321 1 0000000000000000 100 0 0 10 0\n")}
+
+	testConfig := Stats{Hostfs: procfs}
+	require.NoError(t, testConfig.Init())
+
+	// the fd links and socket tables are read through the resolver, and the missing tables are skipped
+	sockets, err := testConfig.GetSockets(4242)
+	require.NoError(t, err)
+	require.Len(t, sockets, 1)
+	assert.Equal(t, SocketInfo{
+		Protocol: "tcp",
+		Local:    SocketAddr{IP: "127.0.0.1", Port: 8080},
+		Remote:   SocketAddr{IP: "0.0.0.0", Port: 0},
+		State:    "listen",
+		Inode:    12345,
+	}, sockets[0])
+}
+
+func TestGetIPv6CountersFromReader(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	procfs.addProc("4243", 100)
+	procfs.files["proc/4242/net/snmp6"] = &fstest.MapFile{Data: []byte(
+		"Ip6InReceives                   	42\nIp6OutRequests                  	7\nIcmp6InMsgs                     	3\n")}
+
+	testConfig := Stats{Hostfs: procfs}
+	require.NoError(t, testConfig.Init())
+
+	counters, err := testConfig.getIPv6Counters(4242)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"InReceives": 42, "OutRequests": 7}, counters)
+
+	// snmp6 doesn't exist if IPv6 is disabled
+	counters, err = testConfig.getIPv6Counters(4243)
+	require.NoError(t, err)
+	assert.Nil(t, counters)
+}
+
+func TestUserIDs(t *testing.T) {
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Equal(t, os.Getuid(), self.UIDs[0])
+	assert.Equal(t, os.Geteuid(), self.UIDs[1])
+	assert.Equal(t, os.Getegid(), self.GIDs[1])
+
+	event, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	uids, err := event.GetValue("uids")
+	require.NoError(t, err)
+	assert.Equal(t, self.UIDs[:], uids)
+
+	// a setuid process
+	ids, err := getIDs(map[string]string{"Uid": "1000\t0\t0\t0"}, "Uid")
+	require.NoError(t, err)
+	assert.Equal(t, [4]int{1000, 0, 0, 0}, ids)
+	_, err = getIDs(map[string]string{"Uid": "1000\t0"}, "Uid")
+	assert.Error(t, err)
+}
+
+func TestGroups(t *testing.T) {
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	// The primary group is usually, but not always, in the supplementary list, so compare against getgroups(2) instead
+	want, err := os.Getgroups()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, self.Groups)
+
+	groups, err := getGroups(map[string]string{"Groups": "4 24 27 1000"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 24, 27, 1000}, groups)
+	groups, err = getGroups(map[string]string{"Groups": ""})
+	require.NoError(t, err)
+	assert.Nil(t, groups)
+}
@@ -21,9 +21,16 @@
 package process
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
 	"os"
+	"os/user"
 	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -35,6 +42,8 @@ import (
 	"github.com/elastic/elastic-agent-libs/opt"
 	"github.com/elastic/elastic-agent-system-metrics/metric"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgv1"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup/cgv2"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 )
 
@@ -77,6 +86,171 @@ func TestGetOne(t *testing.T) {
 	t.Logf("Proc: %s", procData[0].StringToPrint())
 }
 
+func TestGetOneNotExist(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "windows" {
+		t.Skip("Missing process errors are only classified on linux and windows")
+	}
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	// Well above the default pid_max on linux, and not a valid windows PID
+	_, err = testConfig.GetOne(999999999)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrProcNotExist), "expected ErrProcNotExist, got: %s", err)
+	assert.False(t, errors.Is(err, ErrProcPermission))
+}
+
+func TestGetPIDStateNotExist(t *testing.T) {
+	_, err := GetPIDState(resolve.NewTestResolver("/"), 999999999)
+	assert.True(t, errors.Is(err, ErrProcNotExist), "expected ErrProcNotExist, got: %s", err)
+}
+
+func TestNotImplemented(t *testing.T) {
+	if runtime.GOOS == "linux" {
+		t.Skip("Socket data is available on linux")
+	}
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	_, err = testConfig.GetSockets(os.Getpid())
+	assert.True(t, errors.Is(err, ErrNotImplemented))
+}
+
+func TestGetSelfArgs(t *testing.T) {
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	require.NotEmpty(t, self.Args)
+	assert.Contains(t, self.Args, os.Args[0])
+	assert.Equal(t, len(os.Args), len(self.Args))
+}
+
+func TestGetProcRSS(t *testing.T) {
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+
+	rss, err := GetProcRSS(resolve.NewTestResolver("/"), os.Getpid())
+	require.NoError(t, err)
+	require.True(t, rss.Exists())
+	// RSS can change a little between the two reads
+	assert.InDelta(t, float64(self.Memory.Rss.Bytes.ValueOr(0)), float64(rss.ValueOr(0)), 16*1024*1024)
+
+	ticks, err := GetProcCPUTicks(resolve.NewTestResolver("/"), os.Getpid())
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, ticks.ValueOr(0), self.CPU.Total.Ticks.ValueOr(0))
+
+	_, err = GetProcRSS(resolve.NewTestResolver("/"), math.MaxInt32)
+	assert.ErrorIs(t, err, ErrProcNotExist)
+}
+
+func TestGetMemory(t *testing.T) {
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+
+	procs, err := testConfig.GetMemory()
+	require.NoError(t, err)
+	require.NotEmpty(t, procs)
+
+	found := false
+	for _, proc := range procs {
+		assert.True(t, proc.CPU.IsZero(), "pid %d has CPU metrics", proc.Pid.ValueOr(0))
+		assert.Nil(t, proc.Network)
+		assert.Nil(t, proc.Env)
+		if proc.Pid.ValueOr(0) == os.Getpid() {
+			found = true
+			assert.Greater(t, proc.Memory.Rss.Bytes.ValueOr(0), uint64(0))
+			assert.True(t, proc.Memory.Rss.Pct.Exists())
+			assert.True(t, proc.Memory.Size.Exists())
+		}
+	}
+	assert.True(t, found, "the test process wasn't returned")
+}
+
+func TestFields(t *testing.T) {
+	testConfig := Stats{
+		Procs:        []string{".*"},
+		Hostfs:       resolve.NewTestResolver("/"),
+		CPUTicks:     true,
+		EnvWhitelist: []string{".*"},
+		Fields:       []string{"memory"},
+	}
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		data, err := testConfig.GetOne(os.Getpid())
+		require.NoError(t, err)
+
+		assert.Contains(t, data, "memory")
+		assert.Contains(t, data, "pid")
+		for _, key := range []string{"cpu", "fd", "cmdline", "args", "env", "cwd", "exe", "username"} {
+			assert.NotContains(t, data, key)
+		}
+	}
+
+	badField := Stats{Procs: []string{".*"}, Fields: []string{"memory", "nope"}}
+	require.Error(t, badField.Init())
+}
+
+func TestMarshalJSON(t *testing.T) {
+	testConfig := Stats{
+		Procs:        []string{".*"},
+		Hostfs:       resolve.NewTestResolver("/"),
+		CPUTicks:     true,
+		EnvWhitelist: []string{".*"},
+	}
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	event, err := testConfig.getProcessEvent(&self)
+	require.NoError(t, err)
+
+	fromState, err := json.Marshal(self)
+	require.NoError(t, err)
+	fromEvent, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(fromEvent), string(fromState))
+
+	// Check the round-trip keys, since JSONEq doesn't tell us much if both sides are empty
+	decoded := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(fromState, &decoded))
+	for key := range event {
+		assert.Contains(t, decoded, key)
+	}
+	assert.Contains(t, decoded, "memory")
+
+	// opt values that are absent should be left out, not encoded as zero
+	partial, err := json.Marshal(ProcState{Name: "test", Pid: opt.IntWith(1), Ppid: opt.NewIntNone()})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name": "test", "pid": 1}`, string(partial))
+}
+
 func TestNetworkFetch(t *testing.T) {
 	if runtime.GOOS != "linux" {
 		t.Skip("Network data only available on linux")
@@ -121,6 +295,35 @@ func TestNetworkFilter(t *testing.T) {
 	require.Equal(t, 1, len(ipMetrics.(map[string]interface{})))
 }
 
+func TestNetworkFilterIPv6(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Network data only available on linux")
+	}
+	if _, err := os.Stat("/proc/self/net/snmp6"); err != nil {
+		t.Skip("IPv6 is not enabled on this host")
+	}
+	testConfig := Stats{
+		Hostfs:         resolve.NewTestResolver("/"),
+		EnableNetwork:  true,
+		NetworkMetrics: []string{"InReceives"},
+	}
+
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	data, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+
+	// The same filter key should apply to both the v4 and v6 subtrees
+	_, err = data.GetValue("network.ip.InReceives")
+	require.NoError(t, err, "filter did not preserve ip key")
+	_, err = data.GetValue("network.ip6.InReceives")
+	require.NoError(t, err, "filter did not preserve ip6 key")
+	ip6Metrics, err := data.GetValue("network.ip6")
+	require.NoError(t, err)
+	require.Equal(t, 1, len(ip6Metrics.(map[string]interface{})))
+}
+
 func TestFilter(t *testing.T) {
 	//The logic itself is os-independent, so we'll only test this on the platform least likly to have CI issues
 	if runtime.GOOS != "linux" {
@@ -160,6 +363,168 @@ func TestFilter(t *testing.T) {
 	assert.Equal(t, 1, len(oneData))
 }
 
+func TestEnvWhitelistMode(t *testing.T) {
+	cases := []struct {
+		mode      EnvWhitelistMode
+		whitelist []string
+		matches   []string
+		ignores   []string
+	}{
+		{mode: "", whitelist: []string{".*"}, matches: []string{"PATH", "MYPATH"}},
+		{mode: EnvWhitelistRegex, whitelist: []string{"PATH"}, matches: []string{"PATH", "MYPATH"}},
+		{mode: EnvWhitelistExact, whitelist: []string{"PATH", "GO.PATH"}, matches: []string{"PATH", "GO.PATH"}, ignores: []string{"MYPATH", "PATHS", "GOXPATH"}},
+		{mode: EnvWhitelistPrefix, whitelist: []string{"ELASTIC_"}, matches: []string{"ELASTIC_", "ELASTIC_HOST"}, ignores: []string{"MY_ELASTIC_HOST", "ELASTIC"}},
+	}
+
+	for _, tc := range cases {
+		testConfig := Stats{
+			Procs:            []string{".*"},
+			Hostfs:           resolve.NewTestResolver("/"),
+			EnvWhitelist:     tc.whitelist,
+			EnvWhitelistMode: tc.mode,
+		}
+		err := testConfig.Init()
+		require.NoError(t, err)
+
+		for _, name := range tc.matches {
+			assert.True(t, testConfig.isWhitelistedEnvVar(name), "mode '%s' should match %s", tc.mode, name)
+		}
+		for _, name := range tc.ignores {
+			assert.False(t, testConfig.isWhitelistedEnvVar(name), "mode '%s' should not match %s", tc.mode, name)
+		}
+	}
+
+	badMode := Stats{
+		Procs:            []string{".*"},
+		EnvWhitelist:     []string{"PATH"},
+		EnvWhitelistMode: "glob",
+	}
+	require.Error(t, badMode.Init())
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]struct {
+		config Stats
+		errors []string
+	}{
+		"valid": {
+			config: Stats{Procs: []string{".*"}, EnvWhitelist: []string{"^PATH$"}, NetworkMetrics: []string{"InSegs"}, IncludeTop: IncludeTopConfig{Enabled: true, ByCPU: 5}},
+		},
+		"procs": {
+			config: Stats{Procs: []string{".*", "[unclosed"}},
+			errors: []string{"failed to compile regexp [[unclosed]"},
+		},
+		// the env whitelist is checked even if there are no Procs, which used to skip it
+		"env whitelist": {
+			config: Stats{EnvWhitelist: []string{"(PATH"}},
+			errors: []string{"failed to compile env whitelist regexp [(PATH]"},
+		},
+		"env whitelist mode": {
+			config: Stats{EnvWhitelist: []string{"PATH"}, EnvWhitelistMode: "glob"},
+			errors: []string{"unknown env whitelist mode 'glob'"},
+		},
+		"network metrics": {
+			config: Stats{NetworkMetrics: []string{"InSegs", " "}},
+			errors: []string{"network metric names can't be empty"},
+		},
+		"counters": {
+			config: Stats{Counters: NewCounterSet("io.read_bytes", "")},
+			errors: []string{"counter names can't be empty"},
+		},
+		"include top": {
+			config: Stats{IncludeTop: IncludeTopConfig{Enabled: true, ByCPU: -1}},
+			errors: []string{"include_top counts can't be negative, got by_cpu -1 and by_memory 0"},
+		},
+		"max procs": {
+			config: Stats{MaxProcs: -10},
+			errors: []string{"MaxProcs can't be negative, got -10"},
+		},
+		"fields": {
+			config: Stats{Fields: []string{"cpu", "disk"}},
+			errors: []string{"unknown process field 'disk'"},
+		},
+		"name rewrite": {
+			config: Stats{ProcNameRewrite: []NameRewriteConfig{{Pattern: "(java"}}},
+			errors: []string{"(java"},
+		},
+		"everything at once": {
+			config: Stats{Procs: []string{"[a"}, EnvWhitelist: []string{"[b"}, MaxProcs: -1, Fields: []string{"disk"}},
+			errors: []string{"4 errors", "[a]", "[b]", "MaxProcs", "'disk'"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tc.config.Hostfs = resolve.NewTestResolver("/")
+			err := tc.config.Validate()
+			if len(tc.errors) == 0 {
+				require.NoError(t, err)
+				require.NoError(t, tc.config.Init())
+				return
+			}
+			require.Error(t, err)
+			for _, msg := range tc.errors {
+				assert.Contains(t, err.Error(), msg)
+			}
+			// Init returns the same errors
+			assert.EqualError(t, tc.config.Init(), err.Error())
+		})
+	}
+}
+
+func TestTruncateCmdline(t *testing.T) {
+	args := []string{"/usr/bin/java"}
+	for i := 0; i < 500; i++ {
+		args = append(args, "-Dsome.long.property=value")
+	}
+	state := ProcState{Args: args, Cmdline: strings.Join(args, " ")}
+	require.Greater(t, len(state.Cmdline), 1024)
+
+	truncated := truncateCmdline(state, 1024)
+	assert.True(t, truncated.CmdlineTruncated)
+	assert.Equal(t, 1024+len(cmdlineTruncatedMarker), len(truncated.Cmdline))
+	assert.True(t, strings.HasPrefix(truncated.Cmdline, "/usr/bin/java -Dsome.long.property=value"))
+	assert.True(t, strings.HasSuffix(truncated.Cmdline, cmdlineTruncatedMarker))
+	// Args are untouched
+	assert.Equal(t, args, truncated.Args)
+
+	// An already-truncated cmdline, such as from the cache, shouldn't be truncated again
+	assert.Equal(t, truncated, truncateCmdline(truncated, 1024))
+
+	// Short command lines, or a disabled limit, are left as-is
+	short := ProcState{Cmdline: "/bin/sh -c true"}
+	assert.Equal(t, short, truncateCmdline(short, 1024))
+	assert.Equal(t, state, truncateCmdline(state, 0))
+
+	// Don't split a multi-byte character
+	multi := truncateCmdline(ProcState{Cmdline: "echo héllo"}, 7)
+	assert.Equal(t, "echo h"+cmdlineTruncatedMarker, multi.Cmdline)
+}
+
+func TestCmdlineTruncatedCache(t *testing.T) {
+	testConfig := Stats{
+		Procs:           []string{".*"},
+		Hostfs:          resolve.NewTestResolver("/"),
+		CacheCmdLine:    true,
+		MaxCmdlineBytes: 4,
+	}
+	err := testConfig.Init()
+	require.NoError(t, err)
+
+	testConfig.ProcsMap.SetPid(1, truncateCmdline(ProcState{Pid: opt.IntWith(1), Cmdline: "/sbin/init splash"}, 4))
+	cached := testConfig.cacheCmdLine(ProcState{Pid: opt.IntWith(1)})
+	assert.Equal(t, "/sbi"+cmdlineTruncatedMarker, cached.Cmdline)
+	assert.True(t, cached.CmdlineTruncated)
+
+	event, err := testConfig.getProcessEvent(&cached)
+	require.NoError(t, err)
+	assert.Equal(t, true, event["cmdline_truncated"])
+
+	event, err = testConfig.getProcessEvent(&ProcState{Pid: opt.IntWith(1), Cmdline: "/sbin/init"})
+	require.NoError(t, err)
+	assert.NotContains(t, event, "cmdline_truncated")
+}
+
 func TestProcessList(t *testing.T) {
 	plist, err := ListStates(resolve.NewTestResolver("/"))
 	assert.NoError(t, err, "ListStates")
@@ -220,7 +585,7 @@ func TestGetProcess(t *testing.T) {
 	}
 
 	switch runtime.GOOS {
-	case "linux":
+	case "linux", "freebsd":
 		assert.True(t, (len(process.Cwd) > 0))
 	}
 }
@@ -264,6 +629,38 @@ func TestProcMemPercentage(t *testing.T) {
 	assert.Equal(t, rssPercent.ValueOr(0), 0.1416)
 }
 
+func TestProcCgroupMemPercentage(t *testing.T) {
+	p := ProcState{
+		Pid:    opt.IntWith(3456),
+		Memory: ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(1000)}},
+	}
+	var hostMem uint64 = 10000
+
+	// Without cgroup stats, only the host percentage is known
+	assert.False(t, GetProcCgroupMemPercentage(p, hostMem).Exists())
+	assert.Equal(t, 0.1, GetProcMemPercentage(p, hostMem).ValueOr(0))
+
+	// A container limited to a quarter of the host memory
+	v2Mem := &cgv2.MemorySubsystem{}
+	v2Mem.Mem.Max.Bytes = opt.UintWith(2500)
+	p.Cgroup = &cgroup.StatsV2{Memory: v2Mem}
+	assert.Equal(t, 0.4, GetProcCgroupMemPercentage(p, hostMem).ValueOr(0))
+	assert.Equal(t, 0.1, GetProcMemPercentage(p, hostMem).ValueOr(0))
+
+	// memory.max is "max"
+	v2Mem.Mem.Max.Bytes = opt.NewUintNone()
+	assert.False(t, GetProcCgroupMemPercentage(p, hostMem).Exists())
+
+	v1Mem := &cgv1.MemorySubsystem{}
+	v1Mem.Mem.Limit.Bytes = 5000
+	p.Cgroup = &cgroup.StatsV1{Memory: v1Mem}
+	assert.Equal(t, 0.2, GetProcCgroupMemPercentage(p, hostMem).ValueOr(0))
+
+	// Unlimited V1 cgroups report a limit far above the host memory
+	v1Mem.Mem.Limit.Bytes = 9223372036854771712
+	assert.False(t, GetProcCgroupMemPercentage(p, hostMem).Exists())
+}
+
 func TestProcCpuPercentage(t *testing.T) {
 	p1 := ProcState{
 		CPU: ProcCPUInfo{
@@ -298,6 +695,304 @@ func TestProcCpuPercentage(t *testing.T) {
 	assert.EqualValues(t, 3.459, newState.CPU.Total.Pct.ValueOr(0))
 }
 
+func TestCPUPercentageBetween(t *testing.T) {
+	prev := ProcState{
+		CPU: ProcCPUInfo{
+			User:   CPUTicks{Ticks: opt.UintWith(11345)},
+			System: CPUTicks{Ticks: opt.UintWith(37)},
+			Total: CPUTotal{
+				Ticks: opt.UintWith(11382),
+			},
+		},
+		SampleTime: time.Now(),
+	}
+
+	cur := ProcState{
+		CPU: ProcCPUInfo{
+			User:   CPUTicks{Ticks: opt.UintWith(14794)},
+			System: CPUTicks{Ticks: opt.UintWith(47)},
+			Total: CPUTotal{
+				Ticks: opt.UintWith(14841),
+			},
+		},
+		SampleTime: prev.SampleTime.Add(time.Second),
+	}
+
+	pct := CPUPercentageBetween(prev, cur)
+	// See TestProcCpuPercentage for why we re-normalize
+	unNormalized := pct.Norm.ValueOr(0) * float64(runtime.NumCPU())
+	assert.EqualValues(t, 0.0721, metric.Round(unNormalized/48))
+	assert.EqualValues(t, 3.459, pct.Pct.ValueOr(0))
+
+	// the inputs aren't modified
+	assert.False(t, cur.CPU.Total.Pct.Exists())
+	assert.False(t, prev.CPU.Total.Pct.Exists())
+
+	// and match the stateful path
+	newState := GetProcCPUPercentage(prev, cur)
+	assert.Equal(t, pct.Pct, newState.CPU.Total.Pct)
+	assert.Equal(t, pct.Norm, newState.CPU.Total.Norm.Pct)
+
+	noTicks := cur
+	noTicks.CPU.Total.Ticks = opt.NewUintNone()
+	assert.False(t, CPUPercentageBetween(prev, noTicks).Pct.Exists())
+
+	noTime := cur
+	noTime.SampleTime = prev.SampleTime
+	assert.False(t, CPUPercentageBetween(prev, noTime).Pct.Exists())
+	assert.False(t, CPUPercentageBetween(prev, noTime).Norm.Exists())
+}
+
+func TestMergeResults(t *testing.T) {
+	first := []mapstr.M{
+		{"pid": 1, "name": "init"},
+		{"pid": 42, "name": "old"},
+	}
+	second := []mapstr.M{
+		{"pid": 42, "name": "new"},
+		{"pid": 43, "name": "other"},
+		{"name": "no pid"},
+	}
+	merged := MergeResults(first, second)
+	assert.Equal(t, []mapstr.M{
+		{"pid": 1, "name": "init"},
+		{"pid": 42, "name": "new"},
+		{"pid": 43, "name": "other"},
+		{"name": "no pid"},
+	}, merged)
+
+	roots := MergeResults(
+		[]mapstr.M{{"process": mapstr.M{"pid": 42, "name": "old"}}},
+		[]mapstr.M{{"process": mapstr.M{"pid": 42, "name": "new"}}},
+	)
+	assert.Equal(t, []mapstr.M{{"process": mapstr.M{"pid": 42, "name": "new"}}}, roots)
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+	self, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	assert.Len(t, MergeResults([]mapstr.M{self}, []mapstr.M{self}), 1)
+}
+
+func TestInjectedLogger(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+
+	for _, logger := range []*logp.Logger{nil, logp.NewLogger("custom")} {
+		testConfig := Stats{
+			Procs:         []string{".*"},
+			Hostfs:        resolve.NewTestResolver("/"),
+			EnableNetwork: true,
+			Logger:        logger,
+		}
+		require.NoError(t, testConfig.Init())
+	}
+
+	logs := logp.ObserverLogs().FilterMessageSnippet("Collecting all network metrics").TakeAll()
+	require.Len(t, logs, 2)
+	assert.Equal(t, "processes", logs[0].LoggerName)
+	assert.Equal(t, "custom", logs[1].LoggerName)
+}
+
+func TestSummarizeStates(t *testing.T) {
+	procs := []ProcState{
+		{State: Running},
+		{State: Sleeping},
+		{State: Sleeping},
+		{State: DiskSleep},
+		{State: Zombie},
+		{State: Parked},
+		{},
+	}
+	summary := SummarizeStates(procs)
+	assert.Equal(t, StateSummary{Total: 7, Running: 1, Sleeping: 2, DiskSleep: 1, Zombie: 1, Unknown: 2}, summary)
+
+	procs, err := ListStates(resolve.NewTestResolver("/"))
+	require.NoError(t, err)
+	summary = SummarizeStates(procs)
+	assert.Equal(t, len(procs), summary.Total)
+	assert.Greater(t, summary.Running+summary.Sleeping+summary.Idle, 0)
+}
+
+func TestAggregateGroup(t *testing.T) {
+	now := time.Now()
+	procs := []ProcState{
+		{
+			Name: "nginx", Username: "www-data", Pid: opt.IntWith(10), SampleTime: now.Add(-time.Second),
+			CPU:    ProcCPUInfo{Total: CPUTotal{Ticks: opt.UintWith(100), Pct: opt.FloatWith(0.5), Norm: opt.PctOpt{Pct: opt.FloatWith(0.125)}}},
+			Memory: ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(1000), Pct: opt.FloatWith(0.01)}},
+			FD:     ProcFDInfo{Open: opt.UintWith(8)},
+		},
+		{
+			Name: "nginx", Username: "root", Pid: opt.IntWith(11), SampleTime: now,
+			CPU:    ProcCPUInfo{Total: CPUTotal{Ticks: opt.UintWith(50), Pct: opt.FloatWith(0.25), Norm: opt.PctOpt{Pct: opt.FloatWith(0.0625)}}},
+			Memory: ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(2000), Pct: opt.FloatWith(0.02)}},
+		},
+		// this one couldn't be read beyond its name, so all its metrics are absent
+		{Name: "nginx", Username: "www-data", Pid: opt.IntWith(12)},
+	}
+
+	group := AggregateGroup(procs)
+	assert.Equal(t, "nginx", group.Name)
+	assert.Empty(t, group.Username)
+	assert.False(t, group.Pid.Exists())
+	assert.Equal(t, now, group.SampleTime)
+
+	assert.Equal(t, uint64(150), group.CPU.Total.Ticks.ValueOr(0))
+	assert.InDelta(t, 0.75, group.CPU.Total.Pct.ValueOr(0), 0.0001)
+	assert.InDelta(t, 0.1875, group.CPU.Total.Norm.Pct.ValueOr(0), 0.0001)
+	assert.Equal(t, uint64(3000), group.Memory.Rss.Bytes.ValueOr(0))
+	assert.InDelta(t, 0.03, group.Memory.Rss.Pct.ValueOr(0), 0.0001)
+	// absent + value = value
+	assert.Equal(t, uint64(8), group.FD.Open.ValueOr(0))
+	// absent everywhere stays absent
+	assert.False(t, group.Memory.Size.Exists())
+	assert.False(t, group.CPU.User.Ticks.Exists())
+	assert.True(t, group.IO.IsZero())
+
+	assert.Equal(t, ProcState{}, AggregateGroup(nil))
+}
+
+func TestCPUTicksConversion(t *testing.T) {
+	ticks := CPUTicks{Ticks: opt.UintWith(1500)}
+	assert.Equal(t, uint64(1500), ticks.Ms().ValueOr(0))
+	total := CPUTotal{Ticks: opt.UintWith(2005)}
+	if cpuTimesInClockTicks {
+		// converted at the CLK_TCK of the host
+		assert.Equal(t, metric.MsToTicks(1500), ticks.ClockTicks().ValueOr(0))
+		assert.Equal(t, metric.MsToTicks(2005), total.ClockTicks().ValueOr(0))
+		assert.Equal(t, uint64(150), CPUTicks{Ticks: opt.UintWith(metric.TicksToMsUint(150))}.ClockTicks().ValueOr(0))
+	} else {
+		assert.False(t, ticks.ClockTicks().Exists())
+		assert.False(t, total.ClockTicks().Exists())
+	}
+
+	assert.False(t, CPUTicks{}.Ms().Exists())
+	assert.False(t, CPUTicks{}.ClockTicks().Exists())
+	assert.False(t, CPUTotal{}.ClockTicks().Exists())
+}
+
+func TestMinSampleInterval(t *testing.T) {
+	start := time.Now()
+	sample := func(ticks uint64, after time.Duration) ProcState {
+		return ProcState{
+			CPU:        ProcCPUInfo{Total: CPUTotal{Ticks: opt.UintWith(ticks)}},
+			SampleTime: start.Add(after),
+		}
+	}
+	first := sample(1000, 0)
+	first.CPU.Total.Pct = opt.FloatWith(0.5)
+	first.CPU.Total.Norm.Pct = opt.FloatWith(0.25)
+
+	stats := Stats{MinSampleInterval: time.Second}
+	// too soon, so the previous percentages are reused
+	second := stats.fillCPUPercentage(first, sample(1001, time.Millisecond))
+	assert.Equal(t, 0.5, second.CPU.Total.Pct.ValueOr(0))
+	assert.Equal(t, 0.25, second.CPU.Total.Norm.Pct.ValueOr(0))
+	third := stats.fillCPUPercentage(second, sample(1002, 2*time.Millisecond))
+	assert.Equal(t, 0.5, third.CPU.Total.Pct.ValueOr(0))
+
+	// percentages are computed against the first sample, not the ones that were skipped
+	fourth := stats.fillCPUPercentage(third, sample(3000, 2*time.Second))
+	assert.Equal(t, 1.0, fourth.CPU.Total.Pct.ValueOr(0))
+	assert.Nil(t, fourth.cpuBase)
+
+	// without an interval, every sample is computed
+	stats.MinSampleInterval = 0
+	second = stats.fillCPUPercentage(first, sample(1001, time.Millisecond))
+	assert.Equal(t, 1.0, second.CPU.Total.Pct.ValueOr(0))
+}
+
+func TestUsernameCache(t *testing.T) {
+	lookups := 0
+	names := map[string]string{"1000": "alice"}
+	clock := time.Unix(1700000000, 0)
+	cache := &usernameCache{
+		lookupID: func(uid string) (*user.User, error) {
+			lookups++
+			if name, ok := names[uid]; ok {
+				return &user.User{Uid: uid, Username: name}, nil
+			}
+			return nil, user.UnknownUserIdError(1001)
+		},
+		now: func() time.Time { return clock },
+	}
+
+	// without a TTL, every lookup resolves the user
+	assert.Equal(t, "alice", cache.lookup("1000"))
+	assert.Equal(t, "alice", cache.lookup("1000"))
+	assert.Equal(t, 2, lookups)
+
+	cache.setTTL(time.Minute)
+	lookups = 0
+	assert.Equal(t, "alice", cache.lookup("1000"))
+	assert.Equal(t, "alice", cache.lookup("1000"))
+	// unknown users fall back to the uid, which is cached too
+	assert.Equal(t, "1001", cache.lookup("1001"))
+	assert.Equal(t, "1001", cache.lookup("1001"))
+	assert.Equal(t, 2, lookups)
+
+	// a rename is picked up once the entry expires
+	names["1000"] = "bob"
+	clock = clock.Add(30 * time.Second)
+	assert.Equal(t, "alice", cache.lookup("1000"))
+	clock = clock.Add(31 * time.Second)
+	assert.Equal(t, "bob", cache.lookup("1000"))
+	assert.Equal(t, 3, lookups)
+
+	// expired entries are dropped when another user is cached
+	clock = clock.Add(2 * time.Minute)
+	names["1002"] = "carol"
+	assert.Equal(t, "carol", cache.lookup("1002"))
+	assert.Len(t, cache.entries, 1)
+	assert.Contains(t, cache.entries, "1002")
+
+	// changing the TTL drops the cached entries
+	cache.setTTL(time.Minute)
+	assert.Equal(t, "bob", cache.lookup("1000"))
+	assert.Equal(t, 5, lookups)
+}
+
+func TestUsernameCacheConcurrentLookups(t *testing.T) {
+	release := make(chan struct{})
+	var mut sync.Mutex
+	lookups := map[string]int{}
+	cache := &usernameCache{
+		lookupID: func(uid string) (*user.User, error) {
+			mut.Lock()
+			lookups[uid]++
+			mut.Unlock()
+			if uid == "1000" {
+				<-release
+			}
+			return &user.User{Uid: uid, Username: "user" + uid}, nil
+		},
+		now: time.Now,
+	}
+	cache.setTTL(time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "user1000", cache.lookup("1000"))
+		}()
+	}
+	// a slow lookup doesn't block the lookups of other users
+	assert.Equal(t, "user1001", cache.lookup("1001"))
+	close(release)
+	wg.Wait()
+
+	// the lookups that came in while the user was being resolved waited for it
+	mut.Lock()
+	defer mut.Unlock()
+	assert.Equal(t, 1, lookups["1000"])
+	assert.Equal(t, 1, lookups["1001"])
+}
+
 // BenchmarkGetProcess runs a benchmark of the GetProcess method with caching
 // of the command line and environment variables.
 func BenchmarkGetProcess(b *testing.B) {
@@ -319,6 +1014,60 @@ func BenchmarkGetProcess(b *testing.B) {
 	}
 }
 
+// BenchmarkGetSelf compares GetSelf with and without CacheSelf
+func BenchmarkGetSelf(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		cached bool
+	}{{"uncached", false}, {"cached", true}} {
+		cached := bc.cached
+		b.Run(bc.name, func(b *testing.B) {
+			stat, err := initTestResolver()
+			if err != nil {
+				b.Fatalf("Failed init: %s", err)
+			}
+			stat.CacheSelf = cached
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := stat.GetSelf(); err != nil {
+					b.Fatalf("error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkUsernameLookup compares looking up the owners of many processes with and without the username cache
+func BenchmarkUsernameLookup(b *testing.B) {
+	procs, err := ListStates(resolve.NewTestResolver("/"))
+	if err != nil {
+		b.Fatalf("error listing processes: %s", err)
+	}
+	uids := make([]string, 0, len(procs))
+	for range procs {
+		uids = append(uids, strconv.Itoa(os.Getuid()))
+	}
+	// a user that can't be resolved, as is common for processes in containers
+	uids = append(uids, "4000000000")
+
+	for _, bc := range []struct {
+		name string
+		ttl  time.Duration
+	}{{"uncached", 0}, {"cached", time.Minute}} {
+		ttl := bc.ttl
+		b.Run(bc.name, func(b *testing.B) {
+			SetUsernameCacheTTL(ttl)
+			defer SetUsernameCacheTTL(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, uid := range uids {
+					_ = lookupUsername(uid)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkGetTop(b *testing.B) {
 	stat, err := initTestResolver()
 	if err != nil {
@@ -539,6 +1288,17 @@ func TestIncludeTopProcesses(t *testing.T) {
 			Cfg:          IncludeTopConfig{Enabled: true, ByCPU: 3, ByMemory: 1},
 			ExpectedPids: []int{7, 8, 10},
 		},
+		{
+			// PIDs 2, 4 and 6 are tied at the cutoff
+			Name:         "top 8 by cpu, tie broken by PID",
+			Cfg:          IncludeTopConfig{Enabled: true, ByCPU: 8},
+			ExpectedPids: []int{7, 10, 8, 9, 5, 1, 3, 2},
+		},
+		{
+			Name:         "top 9 by cpu, tie broken by PID",
+			Cfg:          IncludeTopConfig{Enabled: true, ByCPU: 9},
+			ExpectedPids: []int{7, 10, 8, 9, 5, 1, 3, 2, 4},
+		},
 	}
 
 	for _, test := range tests {
@@ -555,6 +1315,31 @@ func TestIncludeTopProcesses(t *testing.T) {
 	}
 }
 
+func TestIncludeTopProcessesTies(t *testing.T) {
+	// all processes have the same usage, and are listed in descending PID order
+	processes := []ProcState{}
+	for pid := 5; pid > 0; pid-- {
+		processes = append(processes, ProcState{
+			Pid:    opt.IntWith(pid),
+			CPU:    ProcCPUInfo{Total: CPUTotal{Pct: opt.FloatWith(5)}},
+			Memory: ProcMemInfo{Rss: MemBytePct{Bytes: opt.UintWith(1000)}},
+		})
+	}
+
+	for _, cfg := range []IncludeTopConfig{
+		{Enabled: true, ByCPU: 2},
+		{Enabled: true, ByMemory: 2},
+	} {
+		procStats := Stats{IncludeTop: cfg}
+		res := procStats.includeTopProcesses(processes)
+		resPids := []int{}
+		for _, p := range res {
+			resPids = append(resPids, p.Pid.ValueOr(0))
+		}
+		assert.Equal(t, []int{1, 2}, resPids, "%+v", cfg)
+	}
+}
+
 func initTestResolver() (Stats, error) {
 	err := logp.DevelopmentSetup()
 	if err != nil {
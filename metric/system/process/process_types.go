@@ -18,11 +18,16 @@
 package process
 
 import (
+	"encoding/json"
+	"runtime"
 	"time"
 
 	"github.com/elastic/elastic-agent-libs/mapstr"
 	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-libs/transform/typeconv"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/cgroup"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/network"
 	sysinfotypes "github.com/elastic/go-sysinfo/types"
 )
 
@@ -35,25 +40,119 @@ type ProcState struct {
 	Pid      opt.Int  `struct:"pid,omitempty"`
 	Ppid     opt.Int  `struct:"ppid,omitempty"`
 	Pgid     opt.Int  `struct:"pgid,omitempty"`
+	// CommName is the command name the kernel keeps for the process, which is truncated to 15 bytes on linux.
+	// Where the executable is known, Name is its base name instead, so it isn't truncated. Procs is still matched
+	// against CommName, as the executable is only read once a process has passed the filter.
+	CommName string `struct:"comm,omitempty"`
+	// EntityID identifies a single run of a process: it's the same across samples, but changes when the PID is reused.
+	// It's a hash of the PID, the start time and the boot ID, and is empty if the start time isn't known.
+	EntityID string `struct:"entity_id,omitempty"`
+	// UIDs and GIDs are the real, effective, saved set and filesystem IDs, only reported on linux.
+	// They're added to the event by hand, as an all-zero array is a valid set of IDs for root.
+	UIDs   [4]int `struct:"-"`
+	GIDs   [4]int `struct:"-"`
+	hasIDs bool
+	// Groups are the supplementary group IDs, only reported on linux.
+	Groups []int `struct:"groups,omitempty"`
+	// SessionID and IsSessionLeader are only reported on linux.
+	// session_leader is added to the event alongside session_id, as omitempty doesn't apply to bools.
+	SessionID       opt.Int `struct:"session_id,omitempty"`
+	IsSessionLeader bool    `struct:"-"`
+	// TTY is the controlling terminal, such as pts/0
+	TTY string `struct:"tty,omitempty"`
+	// StateDetail is the exit status of a zombie, or the signal that stopped a stopped process. Only reported on linux.
+	StateDetail string `struct:"state_detail,omitempty"`
 
 	// Extended Process Data
 	Args    []string `struct:"args,omitempty"`
 	Cmdline string   `struct:"cmdline,omitempty"`
-	Cwd     string   `struct:"cwd,omitempty"`
-	Exe     string   `struct:"exe,omitempty"`
-	Env     mapstr.M `struct:"env,omitempty"`
+	// CmdlineTruncated is set if Cmdline was cut down to Stats.MaxCmdlineBytes.
+	// It's only added to the event when true, as omitempty doesn't apply to bools.
+	CmdlineTruncated bool     `struct:"-"`
+	Cwd              string   `struct:"cwd,omitempty"`
+	Exe              string   `struct:"exe,omitempty"`
+	Root             string   `struct:"root,omitempty"`
+	Env              mapstr.M `struct:"env,omitempty"`
+	// EnvChanged and EnvChangedKeys are set with Stats.DetectEnvChanges, once there's a previous sample to compare against.
+	// env_changed is added to the event by hand whenever EnvChangedKeys is non-nil, as omitempty doesn't apply to bools.
+	EnvChanged     bool     `struct:"-"`
+	EnvChangedKeys []string `struct:"env_changed_keys,omitempty"`
+	// WChan is the kernel function a blocked process is waiting in. Only reported on linux.
+	WChan string `struct:"wchan,omitempty"`
+	// Namespaces holds the inode number of each namespace the process is in, keyed by type, with Stats.EnableNamespaces.
+	// It's added to the event by hand, so it's a nested map like the rest of the event.
+	Namespaces map[string]uint64 `struct:"-"`
 
 	// Resource Metrics
 	Memory  ProcMemInfo                       `struct:"memory,omitempty"`
 	CPU     ProcCPUInfo                       `struct:"cpu,omitempty"`
 	FD      ProcFDInfo                        `struct:"fd,omitempty"`
+	Limits  ProcRlimits                       `struct:"limits,omitempty"`
+	IO      ProcIOInfo                        `struct:"io,omitempty"`
+	GPU     ProcGPUInfo                       `struct:"gpu,omitempty"`
 	Network *sysinfotypes.NetworkCountersInfo `struct:"-,omitempty"`
+	// IPv6 counters from /proc/PID/net/snmp6, which are not part of NetworkCountersInfo
+	NetworkIPv6 map[string]uint64 `struct:"-,omitempty"`
 
 	// cgroups
 	Cgroup cgroup.CGStats `struct:"cgroup,omitempty"`
+	// Runtime is the container runtime classified from the cgroup path with Stats.EnableCgroups, such as docker or cri-o.
+	// It's empty for processes running on the host.
+	Runtime string `struct:"container_runtime,omitempty"`
+	// ContainerID and PodUID are also taken from the cgroup path, when it has them.
+	// There is no container name: runtimes only put the container ID in the cgroup path, and the name
+	// is only known to the runtime itself, so callers need to look it up from ContainerID.
+	ContainerID string `struct:"container_id,omitempty"`
+	PodUID      string `struct:"pod_uid,omitempty"`
+
+	// Annotations are extra fields set by Stats.Enrichers, which are merged into the event as-is.
+	Annotations mapstr.M `struct:"-"`
 
 	// meta
 	SampleTime time.Time `struct:"-,omitempty"`
+	// cpuBase is the sample that CPU percentages were last computed from, if the percentages were reused with Stats.MinSampleInterval
+	cpuBase *ProcState
+}
+
+// CollectionStats describes a single collection of processes by Stats.Get.
+// Every process that's seen is either emitted, filtered out, or skipped because of an error.
+type CollectionStats struct {
+	Duration time.Duration
+	Seen     int
+	Emitted  int
+	// Filtered is the number of processes that didn't match Procs, or were left out by IncludeTop or MaxProcs
+	Filtered int
+	Errors   CollectionErrors
+}
+
+// CollectionErrors is the number of processes that were skipped because of an error, by the kind of error
+type CollectionErrors struct {
+	// Exited processes went away while they were being collected
+	Exited     int
+	Permission int
+	// Timeout is the number of processes that took longer than Stats.PerProcTimeout
+	Timeout int
+	Other   int
+}
+
+// Skipped returns the number of processes that were seen but not emitted, whether they were filtered out or had an error
+func (stats CollectionStats) Skipped() int {
+	return stats.Filtered + stats.Errors.Exited + stats.Errors.Permission + stats.Errors.Timeout + stats.Errors.Other
+}
+
+// StateSummary is the number of processes in each state, as returned by SummarizeStates
+type StateSummary struct {
+	Total    int `struct:"total"`
+	Running  int `struct:"running"`
+	Sleeping int `struct:"sleeping"`
+	Idle     int `struct:"idle"`
+	// DiskSleep is the number of processes in uninterruptible sleep, which are usually stalled on IO
+	DiskSleep int `struct:"disk_sleep"`
+	Stopped   int `struct:"stopped"`
+	Zombie    int `struct:"zombie"`
+	Dead      int `struct:"dead"`
+	// Unknown also counts the states that are only found on some kernels, such as wakekill and parked
+	Unknown int `struct:"unknown"`
 }
 
 // ProcCPUInfo is the main struct for CPU metrics
@@ -63,9 +162,25 @@ type ProcCPUInfo struct {
 	// Optional Tick values
 	User   CPUTicks `struct:"user,omitempty"`
 	System CPUTicks `struct:"system,omitempty"`
+	// Time spent waiting for block IO, only reported on linux when delay accounting is enabled
+	IOWait CPUTicks `struct:"iowait,omitempty"`
+	// Cumulative times of waited-for children, only reported on linux with Stats.IncludeChildStats
+	Children ChildCPUInfo `struct:"children,omitempty"`
+	// LastCPU is the CPU the process last ran on, only reported on linux
+	LastCPU opt.Int `struct:"last_cpu,omitempty"`
+	// SchedPolicy is the scheduling policy of the process, such as other, fifo or rr, only reported on linux
+	SchedPolicy string `struct:"sched_policy,omitempty"`
+}
+
+// ChildCPUInfo is the struct for cpu.children metrics
+type ChildCPUInfo struct {
+	Total  CPUTicks `struct:"total,omitempty"`
+	User   CPUTicks `struct:"user,omitempty"`
+	System CPUTicks `struct:"system,omitempty"`
 }
 
-// CPUTicks is a formatting wrapper for `tick` metric values
+// CPUTicks is a formatting wrapper for `tick` metric values.
+// Despite the name, Ticks is a CPU time in milliseconds on every platform; on linux the clock ticks are converted when they're read.
 type CPUTicks struct {
 	Ticks opt.Uint `struct:"ticks,omitempty"`
 }
@@ -83,12 +198,22 @@ type ProcMemInfo struct {
 	Size  opt.Uint   `struct:"size,omitempty"`
 	Share opt.Uint   `struct:"share,omitempty"`
 	Rss   MemBytePct `struct:"rss,omitempty"`
+	// Page faults that didn't (minor) and did (major) require loading a page from disk.
+	// The child counts are for waited-for children, and are only reported on linux.
+	MinFlt      opt.Uint `struct:"minflt,omitempty"`
+	MajFlt      opt.Uint `struct:"majflt,omitempty"`
+	ChildMinFlt opt.Uint `struct:"cminflt,omitempty"`
+	ChildMajFlt opt.Uint `struct:"cmajflt,omitempty"`
+	// NumMaps is the number of memory mappings, only reported on linux with Stats.EnableMaps
+	NumMaps opt.Uint `struct:"num_maps,omitempty"`
 }
 
 // MemBytePct is the formatting struct for wrapping pct/byte metrics
 type MemBytePct struct {
 	Bytes opt.Uint  `struct:"bytes,omitempty"`
 	Pct   opt.Float `struct:"pct,omitempty"`
+	// Percent of the memory limit of the process' cgroup, only set when the limit is below the host memory.
+	CgroupPct opt.Float `struct:"cgroup_pct,omitempty"`
 }
 
 // ProcFDInfo is the struct for process.fd metrics
@@ -103,22 +228,174 @@ type ProcLimits struct {
 	Hard opt.Uint `struct:"hard,omitempty"`
 }
 
+// ProcRlimits are the soft and hard resource limits of a process, from /proc/PID/limits.
+// They're only reported on linux with Stats.EnableLimits, and unlimited values are absent.
+type ProcRlimits struct {
+	AS     ProcLimits `struct:"as,omitempty"`
+	RSS    ProcLimits `struct:"rss,omitempty"`
+	NOFile ProcLimits `struct:"nofile,omitempty"`
+	NProc  ProcLimits `struct:"nproc,omitempty"`
+}
+
+// ProcIOInfo is the disk I/O of a process, reported on linux and darwin with Stats.EnableIO.
+// The byte counts are what was read from and written to storage, not including cached reads.
+// The syscall counts are the number of read and write calls of any kind, and are only reported on linux;
+// along with the byte counts, they tell many small reads apart from a few large ones.
+type ProcIOInfo struct {
+	ReadBytes    opt.Uint `struct:"read_bytes,omitempty"`
+	WriteBytes   opt.Uint `struct:"write_bytes,omitempty"`
+	SyscallRead  opt.Uint `struct:"syscall_read,omitempty"`
+	SyscallWrite opt.Uint `struct:"syscall_write,omitempty"`
+}
+
+// ProcGPUInfo is the NVIDIA GPU usage of a process, reported with Stats.EnableGPU in builds with the gpu tag.
+// Both values are summed across all the GPUs the process is using, so the utilization can be more than 1 on multi-GPU hosts.
+type ProcGPUInfo struct {
+	MemoryBytes    opt.Uint  `struct:"memory_bytes,omitempty"`
+	UtilizationPct opt.Float `struct:"utilization_pct,omitempty"`
+}
+
+// SocketInfo is a single TCP or UDP socket owned by a process
+type SocketInfo struct {
+	Protocol string     `struct:"protocol"`
+	Local    SocketAddr `struct:"local"`
+	Remote   SocketAddr `struct:"remote"`
+	State    string     `struct:"state,omitempty"`
+	Inode    uint64     `struct:"inode"`
+}
+
+// SocketAddr is the IP and port of one end of a socket
+type SocketAddr struct {
+	IP   string `struct:"ip"`
+	Port int    `struct:"port"`
+}
+
+// cpuTimesInClockTicks is whether the kernel reports CPU times in clock ticks, which are converted to milliseconds.
+// Other platforms report them in other units, which aren't tied to CLK_TCK.
+const cpuTimesInClockTicks = runtime.GOOS == "linux" || runtime.GOOS == "freebsd"
+
 // Implementations
 
 func (t CPUTotal) IsZero() bool {
 	return t.Value.IsZero() && t.Ticks.IsZero() && t.Pct.IsZero() && t.Norm.IsZero()
 }
 
+// ClockTicks returns the total CPU time in clock ticks; like CPUTicks, Ticks holds milliseconds
+func (t CPUTotal) ClockTicks() opt.Uint {
+	return CPUTicks{Ticks: t.Ticks}.ClockTicks()
+}
+
 // IsZero returns true if the underlying value nil
 func (t CPUTicks) IsZero() bool {
 	return t.Ticks.IsZero()
 }
 
+// Ms returns the CPU time in milliseconds, which is what Ticks holds
+func (t CPUTicks) Ms() opt.Uint {
+	return t.Ticks
+}
+
+// ClockTicks returns the CPU time in the clock ticks the kernel reports, as counted by CLK_TCK.
+// It's absent on platforms that don't report CPU times in clock ticks, where there are none to convert back to.
+func (t CPUTicks) ClockTicks() opt.Uint {
+	if !t.Ticks.Exists() || !cpuTimesInClockTicks {
+		return opt.NewUintNone()
+	}
+	return opt.UintWith(metric.MsToTicks(t.Ticks.ValueOr(0)))
+}
+
 // IsZero returns true if the underlying value nil
 func (t ProcFDInfo) IsZero() bool {
 	return t.Open.IsZero() && t.Limit.Hard.IsZero() && t.Limit.Soft.IsZero()
 }
 
+// IsZero returns true if neither limit is set
+func (t ProcLimits) IsZero() bool {
+	return t.Soft.IsZero() && t.Hard.IsZero()
+}
+
+// IsZero returns true if no resource limits are set
+func (t ProcRlimits) IsZero() bool {
+	return t.AS.IsZero() && t.RSS.IsZero() && t.NOFile.IsZero() && t.NProc.IsZero()
+}
+
+// IsZero returns true if no I/O metrics are set
+func (t ProcIOInfo) IsZero() bool {
+	return t.ReadBytes.IsZero() && t.WriteBytes.IsZero() && t.SyscallRead.IsZero() && t.SyscallWrite.IsZero()
+}
+
+// IsZero implements the IsZero interface for ProcGPUInfo
+func (t ProcGPUInfo) IsZero() bool {
+	return t.MemoryBytes.IsZero() && t.UtilizationPct.IsZero()
+}
+
+// IsZero returns true if no CPU metrics are set
+func (t ProcCPUInfo) IsZero() bool {
+	return t.StartTime == "" && t.Total.IsZero() && t.User.IsZero() && t.System.IsZero() && t.IOWait.IsZero() && t.Children.IsZero() && t.LastCPU.IsZero() &&
+		t.SchedPolicy == ""
+}
+
+// IsZero returns true if no child CPU metrics are set
+func (t ChildCPUInfo) IsZero() bool {
+	return t.Total.IsZero() && t.User.IsZero() && t.System.IsZero()
+}
+
+// IsZero returns true if no memory metrics are set
+func (t ProcMemInfo) IsZero() bool {
+	return t.Size.IsZero() && t.Share.IsZero() && t.Rss.Bytes.IsZero() && t.Rss.Pct.IsZero() && t.Rss.CgroupPct.IsZero() &&
+		t.MinFlt.IsZero() && t.MajFlt.IsZero() && t.ChildMinFlt.IsZero() && t.ChildMajFlt.IsZero() && t.NumMaps.IsZero()
+}
+
+// MarshalJSON encodes the process with the same keys as the events returned by Stats.Get(); absent values are left out.
+func (p ProcState) MarshalJSON() ([]byte, error) {
+	proc, err := p.toMapStr(nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(proc)
+}
+
+// toMapStr converts the process to the map format used for events.
+// The network counters are filtered with the given list of metric names; an empty list will report all of them.
+func (p *ProcState) toMapStr(networkMetrics []string) (mapstr.M, error) {
+	proc := mapstr.M{}
+	err := typeconv.Convert(&proc, p)
+	if p.CmdlineTruncated {
+		proc["cmdline_truncated"] = true
+	}
+	if p.SessionID.Exists() {
+		proc["session_leader"] = p.IsSessionLeader
+	}
+	if p.hasIDs {
+		proc["uids"] = p.UIDs[:]
+		proc["gids"] = p.GIDs[:]
+	}
+	if p.EnvChangedKeys != nil {
+		proc["env_changed"] = p.EnvChanged
+	}
+	if p.Namespaces != nil {
+		namespaces := make(mapstr.M, len(p.Namespaces))
+		for nsType, inode := range p.Namespaces {
+			namespaces[nsType] = inode
+		}
+		proc["namespaces"] = namespaces
+	}
+
+	if p.Annotations != nil {
+		proc.DeepUpdate(p.Annotations.Clone())
+	}
+
+	if p.Network != nil {
+		netMap := network.MapProcNetCountersWithFilter(p.Network, networkMetrics)
+		if p.NetworkIPv6 != nil {
+			netMap["ip6"] = network.MapIPv6CountersWithFilter(p.NetworkIPv6, networkMetrics)
+		}
+		proc["network"] = netMap
+	}
+
+	return proc, err
+}
+
 func (p *ProcState) FormatForRoot() ProcStateRootEvent {
 	root := ProcStateRootEvent{}
 
@@ -18,17 +18,23 @@
 package process
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"syscall"
+	"unsafe"
 
 	"github.com/elastic/elastic-agent-libs/opt"
 	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
 	"github.com/elastic/gosigar/sys/windows"
+	xsyswindows "golang.org/x/sys/windows"
 )
 
 var (
 	processQueryLimitedInfoAccess = windows.PROCESS_QUERY_LIMITED_INFORMATION
+
+	modkernel32               = xsyswindows.NewLazySystemDLL("kernel32.dll")
+	procGetProcessHandleCount = modkernel32.NewProc("GetProcessHandleCount")
 )
 
 // FetchPids returns a map and array of pids
@@ -80,12 +86,17 @@ func FillPidMetrics(_ resolve.Resolver, pid int, state ProcState, _ func(string)
 	ppid, _ := getParentPid(pid)
 	state.Ppid = opt.IntWith(ppid)
 
-	wss, size, err := procMem(pid)
+	state.Memory, err = procMem(pid)
 	if err != nil {
 		return state, fmt.Errorf("error fetching memory: %w", err)
 	}
-	state.Memory.Rss.Bytes = opt.UintWith(wss)
-	state.Memory.Size = opt.UintWith(size)
+
+	handles, err := getProcHandleCount(pid)
+	if err != nil {
+		return state, fmt.Errorf("error fetching handle count: %w", err)
+	}
+	// Open handles are the closest analog to open file descriptors
+	state.FD.Open = opt.UintWith(handles)
 
 	userTime, sysTime, startTime, err := getProcTimes(pid)
 	if err != nil {
@@ -139,6 +150,9 @@ func getProcArgs(pid int) ([]string, error) {
 func getProcTimes(pid int) (uint64, uint64, uint64, error) {
 	handle, err := syscall.OpenProcess(processQueryLimitedInfoAccess, false, uint32(pid))
 	if err != nil {
+		if errors.Is(err, xsyswindows.ERROR_INVALID_PARAMETER) {
+			err = procError{sentinel: ErrProcNotExist, err: err}
+		}
 		return 0, 0, 0, fmt.Errorf("OpenProcess failed for pid=%v: %w", pid, err)
 	}
 	defer func() {
@@ -154,10 +168,17 @@ func getProcTimes(pid int) (uint64, uint64, uint64, error) {
 	return uint64(windows.FiletimeToDuration(&cpu.UserTime).Nanoseconds() / 1e6), uint64(windows.FiletimeToDuration(&cpu.KernelTime).Nanoseconds() / 1e6), uint64(cpu.CreationTime.Nanoseconds() / 1e6), nil
 }
 
-func procMem(pid int) (uint64, uint64, error) {
+// procMem maps the PROCESS_MEMORY_COUNTERS_EX of a process onto ProcMemInfo.
+// The working set is the closest analog to RSS, and the private bytes are reported as the size.
+// PagefileUsage isn't reported separately, as it's the same commit charge as PrivateUsage,
+// and Share is left out, as the shared part of the working set isn't in these counters.
+func procMem(pid int) (ProcMemInfo, error) {
 	handle, err := syscall.OpenProcess(processQueryLimitedInfoAccess|windows.PROCESS_VM_READ, false, uint32(pid))
 	if err != nil {
-		return 0, 0, fmt.Errorf("OpenProcess failed for pid=%v: %w", pid, err)
+		if errors.Is(err, xsyswindows.ERROR_INVALID_PARAMETER) {
+			err = procError{sentinel: ErrProcNotExist, err: err}
+		}
+		return ProcMemInfo{}, fmt.Errorf("OpenProcess failed for pid=%v: %w", pid, err)
 	}
 	defer func() {
 		_ = syscall.CloseHandle(handle)
@@ -165,15 +186,47 @@ func procMem(pid int) (uint64, uint64, error) {
 
 	counters, err := windows.GetProcessMemoryInfo(handle)
 	if err != nil {
-		return 0, 0, fmt.Errorf("GetProcessMemoryInfo failed for pid=%v: %w", pid, err)
+		return ProcMemInfo{}, fmt.Errorf("GetProcessMemoryInfo failed for pid=%v: %w", pid, err)
+	}
+	return memInfoFromCounters(counters), nil
+}
+
+func memInfoFromCounters(counters windows.ProcessMemoryCountersEx) ProcMemInfo {
+	return ProcMemInfo{
+		Rss:  MemBytePct{Bytes: opt.UintWith(uint64(counters.WorkingSetSize))},
+		Size: opt.UintWith(uint64(counters.PrivateUsage)),
+	}
+}
+
+// getProcHandleCount returns the number of open handles of a process, using GetProcessHandleCount
+func getProcHandleCount(pid int) (uint64, error) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInfoAccess, false, uint32(pid))
+	if err != nil {
+		if errors.Is(err, xsyswindows.ERROR_INVALID_PARAMETER) {
+			err = procError{sentinel: ErrProcNotExist, err: err}
+		}
+		return 0, fmt.Errorf("OpenProcess failed for pid=%v: %w", pid, err)
+	}
+	defer func() {
+		_ = syscall.CloseHandle(handle)
+	}()
+
+	var count uint32
+	r1, _, e1 := syscall.Syscall(procGetProcessHandleCount.Addr(), 2, uintptr(handle), uintptr(unsafe.Pointer(&count)), 0)
+	if r1 == 0 {
+		return 0, fmt.Errorf("GetProcessHandleCount failed for pid=%v: %w", pid, e1)
 	}
-	return uint64(counters.WorkingSetSize), uint64(counters.PrivateUsage), nil
+	return uint64(count), nil
 }
 
 // getProcName returns the process name associated with the PID.
 func getProcName(pid int) (string, error) {
 	handle, err := syscall.OpenProcess(processQueryLimitedInfoAccess, false, uint32(pid))
 	if err != nil {
+		// OpenProcess returns ERROR_INVALID_PARAMETER for a PID that doesn't exist
+		if errors.Is(err, xsyswindows.ERROR_INVALID_PARAMETER) {
+			err = procError{sentinel: ErrProcNotExist, err: err}
+		}
 		return "", fmt.Errorf("OpenProcess failed for pid=%v: %w", pid, err)
 	}
 	defer func() {
@@ -264,3 +317,21 @@ func getProcCredName(pid int) (string, error) {
 
 	return fmt.Sprintf(`%s\%s`, domain, account), nil
 }
+
+// getProcMem is used by GetProcRSS
+func getProcMem(_ resolve.Resolver, pid int) (ProcMemInfo, error) {
+	return procMem(pid)
+}
+
+// getProcCPU is used by GetProcCPUTicks
+func getProcCPU(_ resolve.Resolver, pid int) (ProcCPUInfo, error) {
+	userTime, sysTime, _, err := getProcTimes(pid)
+	if err != nil {
+		return ProcCPUInfo{}, err
+	}
+	cpu := ProcCPUInfo{}
+	cpu.User.Ticks = opt.UintWith(userTime)
+	cpu.System.Ticks = opt.UintWith(sysTime)
+	cpu.Total.Ticks = opt.UintWith(userTime + sysTime)
+	return cpu, nil
+}
@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build windows
+// +build windows
+
+package process
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+	"github.com/elastic/gosigar/sys/windows"
+)
+
+func TestProcMem(t *testing.T) {
+	mem, err := procMem(os.Getpid())
+	require.NoError(t, err)
+	assert.Greater(t, mem.Rss.Bytes.ValueOr(0), uint64(0))
+	assert.Greater(t, mem.Size.ValueOr(0), uint64(0))
+}
+
+func TestProcHandleCount(t *testing.T) {
+	handles, err := getProcHandleCount(os.Getpid())
+	require.NoError(t, err)
+	assert.Greater(t, handles, uint64(0))
+
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver("/"),
+	}
+	require.NoError(t, testConfig.Init())
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Greater(t, self.FD.Open.ValueOr(0), uint64(0))
+}
+
+func TestMemInfoFromCounters(t *testing.T) {
+	mem := memInfoFromCounters(windows.ProcessMemoryCountersEx{
+		WorkingSetSize: 4096 * 100,
+		PagefileUsage:  4096 * 50,
+		PrivateUsage:   4096 * 50,
+	})
+	assert.Equal(t, uint64(4096*100), mem.Rss.Bytes.ValueOr(0))
+	assert.Equal(t, uint64(4096*50), mem.Size.ValueOr(0))
+	assert.False(t, mem.Share.Exists())
+}
@@ -0,0 +1,76 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// checkProcfs returns ErrProcUnavailable if procfs isn't mounted under the hostfs, or is empty.
+func checkProcfs(hostfs resolve.Resolver) error {
+	path := resolve.ProcPath(hostfs)
+	entries, err := readerFor(hostfs).ReadDir(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(entries) == 0) {
+		return fmt.Errorf("%w: nothing is mounted at %s", ErrProcUnavailable, path)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading from procfs %s: %w", path, err)
+	}
+	return nil
+}
+
+// selfState returns the metrics of the current process that can be found without procfs.
+func selfState(now time.Time) (ProcState, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return ProcState{}, fmt.Errorf("error calling getrusage: %w", err)
+	}
+
+	state := ProcState{
+		Pid:        opt.IntWith(os.Getpid()),
+		Ppid:       opt.IntWith(os.Getppid()),
+		Pgid:       opt.IntWith(syscall.Getpgrp()),
+		Args:       os.Args,
+		Cmdline:    strings.Join(os.Args, " "),
+		SampleTime: now,
+	}
+	if len(os.Args) > 0 {
+		state.Name = filepath.Base(os.Args[0])
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		state.Cwd = cwd
+	}
+	// ticks are milliseconds, as on the procfs path
+	state.CPU.User.Ticks = opt.UintWith(uint64(usage.Utime.Nano() / int64(time.Millisecond)))
+	state.CPU.System.Ticks = opt.UintWith(uint64(usage.Stime.Nano() / int64(time.Millisecond)))
+	state.CPU.Total.Ticks = opt.UintWith(opt.SumOptUint(state.CPU.User.Ticks, state.CPU.System.Ticks))
+	return state, nil
+}
@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestProcfsUnavailable(t *testing.T) {
+	root := t.TempDir()
+	testConfig := Stats{
+		Procs:  []string{".*"},
+		Hostfs: resolve.NewTestResolver(root),
+	}
+	err := testConfig.Init()
+	require.ErrorIs(t, err, ErrProcUnavailable)
+	assert.Contains(t, err.Error(), filepath.Join(root, "proc"))
+
+	_, _, err = testConfig.Get()
+	require.ErrorIs(t, err, ErrProcUnavailable)
+
+	// The self metrics come from syscalls instead
+	self, err := testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), self.Pid.ValueOr(0))
+	assert.Equal(t, os.Getppid(), self.Ppid.ValueOr(0))
+	assert.Equal(t, filepath.Base(os.Args[0]), self.Name)
+	assert.True(t, self.CPU.Total.Ticks.Exists())
+
+	// An empty mountpoint is just as unavailable
+	require.NoError(t, os.Mkdir(filepath.Join(root, "proc"), 0o755))
+	require.ErrorIs(t, testConfig.Init(), ErrProcUnavailable)
+
+	testConfig.Hostfs = resolve.NewTestResolver("/")
+	require.NoError(t, testConfig.Init())
+	self, err = testConfig.GetSelf()
+	require.NoError(t, err)
+	assert.NotEmpty(t, self.Exe)
+}
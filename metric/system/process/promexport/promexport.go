@@ -0,0 +1,156 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package promexport exposes the process metrics from process.Stats as prometheus metrics.
+package promexport
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const namespace = "system_process"
+
+// metricLabels are the labels attached to every process metric
+var metricLabels = []string{"pid", "name"}
+
+// processMetric maps a single key in the process events to a prometheus metric
+type processMetric struct {
+	key       string
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+}
+
+func newMetric(key, name, help string, valueType prometheus.ValueType) processMetric {
+	return processMetric{
+		key:       key,
+		desc:      prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, metricLabels, nil),
+		valueType: valueType,
+	}
+}
+
+// The ticks are only reported if Stats.CPUTicks is set
+var processMetrics = []processMetric{
+	newMetric("cpu.user.ticks", "cpu_user_ticks_total", "Time spent in user space, in milliseconds.", prometheus.CounterValue),
+	newMetric("cpu.system.ticks", "cpu_system_ticks_total", "Time spent in kernel space, in milliseconds.", prometheus.CounterValue),
+	newMetric("cpu.total.ticks", "cpu_total_ticks_total", "Total CPU time, in milliseconds.", prometheus.CounterValue),
+	newMetric("cpu.total.pct", "cpu_total_pct", "CPU usage since the last sample, as a fraction of a single core.", prometheus.GaugeValue),
+	newMetric("cpu.total.norm.pct", "cpu_total_norm_pct", "CPU usage since the last sample, normalized by the number of cores.", prometheus.GaugeValue),
+	newMetric("memory.size", "memory_size_bytes", "Total virtual memory.", prometheus.GaugeValue),
+	newMetric("memory.share", "memory_share_bytes", "Shared memory.", prometheus.GaugeValue),
+	newMetric("memory.rss.bytes", "memory_rss_bytes", "Resident set size.", prometheus.GaugeValue),
+	newMetric("memory.rss.pct", "memory_rss_pct", "Resident set size as a fraction of total physical memory.", prometheus.GaugeValue),
+	newMetric("fd.open", "fd_open", "Number of open file descriptors.", prometheus.GaugeValue),
+	newMetric("fd.limit.soft", "fd_limit_soft", "Soft limit on the number of file descriptors.", prometheus.GaugeValue),
+	newMetric("fd.limit.hard", "fd_limit_hard", "Hard limit on the number of file descriptors.", prometheus.GaugeValue),
+}
+
+// Collector is a prometheus.Collector that reports the most recent set of process events passed to Update.
+type Collector struct {
+	mut     sync.RWMutex
+	metrics []prometheus.Metric
+}
+
+// NewCollector returns a new Collector with no processes
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Register creates a new Collector and registers it with the given registry
+func Register(registry prometheus.Registerer) (*Collector, error) {
+	collector := NewCollector()
+	if err := registry.Register(collector); err != nil {
+		return nil, fmt.Errorf("error registering process collector: %w", err)
+	}
+	return collector, nil
+}
+
+// Update replaces the reported processes with the output of process.Stats.Get().
+// procs and roots are the two returned lists of events, which are expected to be the same length.
+func (c *Collector) Update(procs, roots []mapstr.M) error {
+	if len(procs) != len(roots) {
+		return fmt.Errorf("got %d process events but %d root events", len(procs), len(roots))
+	}
+
+	metrics := []prometheus.Metric{}
+	for i, proc := range procs {
+		pid, err := roots[i].GetValue("process.pid")
+		if err != nil {
+			return fmt.Errorf("error fetching pid for process event %d: %w", i, err)
+		}
+		name, _ := roots[i].GetValue("process.name")
+		labels := []string{fmt.Sprint(pid), fmt.Sprint(name)}
+
+		for _, pm := range processMetrics {
+			raw, err := proc.GetValue(pm.key)
+			if err != nil {
+				// metric isn't reported for this process
+				continue
+			}
+			value, err := toFloat(raw)
+			if err != nil {
+				return fmt.Errorf("error converting %s for pid %s: %w", pm.key, labels[0], err)
+			}
+			metric, err := prometheus.NewConstMetric(pm.desc, pm.valueType, value, labels...)
+			if err != nil {
+				return fmt.Errorf("error creating metric %s for pid %s: %w", pm.key, labels[0], err)
+			}
+			metrics = append(metrics, metric)
+		}
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.metrics = metrics
+	return nil
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, pm := range processMetrics {
+		ch <- pm.desc
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mut.RLock()
+	defer c.mut.RUnlock()
+	for _, metric := range c.metrics {
+		ch <- metric
+	}
+}
+
+func toFloat(raw interface{}) (float64, error) {
+	switch val := raw.(type) {
+	case float64:
+		return val, nil
+	case float32:
+		return float64(val), nil
+	case int:
+		return float64(val), nil
+	case int64:
+		return float64(val), nil
+	case uint64:
+		return float64(val), nil
+	}
+	return 0, fmt.Errorf("unexpected type %T", raw)
+}
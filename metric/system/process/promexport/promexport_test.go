@@ -0,0 +1,95 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build (darwin && cgo) || freebsd || linux || windows
+// +build darwin,cgo freebsd linux windows
+
+package promexport
+
+import (
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/process"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestCollector(t *testing.T) {
+	stats := process.Stats{
+		Procs:    []string{".*"},
+		Hostfs:   resolve.NewTestResolver("/"),
+		CPUTicks: true,
+	}
+	require.NoError(t, stats.Init())
+
+	procs, roots, err := stats.Get()
+	require.NoError(t, err)
+	require.NotEmpty(t, procs)
+
+	registry := prometheus.NewRegistry()
+	collector, err := Register(registry)
+	require.NoError(t, err)
+	require.NoError(t, collector.Update(procs, roots))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	byName := map[string]*dto.MetricFamily{}
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+
+	expected := map[string]dto.MetricType{
+		"system_process_cpu_total_ticks_total": dto.MetricType_COUNTER,
+		"system_process_cpu_user_ticks_total":  dto.MetricType_COUNTER,
+		"system_process_memory_rss_bytes":      dto.MetricType_GAUGE,
+		"system_process_memory_size_bytes":     dto.MetricType_GAUGE,
+	}
+	for name, metricType := range expected {
+		family, ok := byName[name]
+		require.True(t, ok, "missing metric family %s", name)
+		assert.Equal(t, metricType, family.GetType(), "wrong type for %s", name)
+	}
+
+	// The test process should be reported, labeled by PID and name
+	self := strconv.Itoa(os.Getpid())
+	found := false
+	for _, metric := range byName["system_process_memory_rss_bytes"].GetMetric() {
+		labels := map[string]string{}
+		for _, label := range metric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		assert.NotEmpty(t, labels["name"])
+		if labels["pid"] == self {
+			found = true
+			assert.Greater(t, metric.GetGauge().GetValue(), 0.0)
+		}
+	}
+	assert.True(t, found, "pid %s not found", self)
+}
+
+func TestCollectorUpdateMismatch(t *testing.T) {
+	collector := NewCollector()
+	err := collector.Update([]mapstr.M{{}}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package process
+
+import (
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+)
+
+// CounterSet computes per-second rates of counters in the process events, such as "io.read_bytes" or "memory.majflt",
+// between one call to Stats.Get and the next. The rates are added to each event under "rates", keyed by counter name.
+// Samples are matched by EntityID, so like CPU percentages, a process has no rates on its first sample,
+// or after its PID is reused. A counter that went down since the previous sample was reset, and has no rate either.
+type CounterSet struct {
+	counters []string
+	last     map[string]counterSample // previous samples by EntityID
+	next     map[string]counterSample // samples of the collection in progress
+}
+
+// counterSample holds the values of the registered counters for a single process
+type counterSample struct {
+	time   time.Time
+	values map[string]float64
+}
+
+// NewCounterSet returns a CounterSet for the given counters, to be set as Stats.Counters
+func NewCounterSet(counters ...string) *CounterSet {
+	set := &CounterSet{}
+	set.Register(counters...)
+	return set
+}
+
+// Register adds counters to the set. Their rates are reported from the second sample after they're added.
+func (set *CounterSet) Register(counters ...string) {
+	set.counters = append(set.counters, counters...)
+}
+
+// rates records the counters of a process event, and returns their rates since the previous sample of the same process.
+// The returned map is empty if there's no previous sample to compare against.
+func (set *CounterSet) rates(entityID string, sampleTime time.Time, event mapstr.M) mapstr.M {
+	if entityID == "" {
+		return nil
+	}
+	cur := counterSample{time: sampleTime, values: map[string]float64{}}
+	for _, name := range set.counters {
+		raw, err := event.GetValue(name)
+		if err != nil {
+			continue
+		}
+		if value, ok := counterValue(raw); ok {
+			cur.values[name] = value
+		}
+	}
+	if set.next == nil {
+		set.next = map[string]counterSample{}
+	}
+	set.next[entityID] = cur
+
+	prev, ok := set.last[entityID]
+	elapsed := cur.time.Sub(prev.time).Seconds()
+	if !ok || elapsed <= 0 {
+		return nil
+	}
+	rates := mapstr.M{}
+	for name, value := range cur.values {
+		prevValue, ok := prev.values[name]
+		if !ok || value < prevValue {
+			continue
+		}
+		_, _ = rates.Put(name, metric.Round((value-prevValue)/elapsed))
+	}
+	return rates
+}
+
+// commit makes the samples of the current collection the baseline for the next one,
+// dropping the processes that weren't seen.
+func (set *CounterSet) commit() {
+	set.last = set.next
+	set.next = nil
+}
+
+// counterValue returns the numeric value of a counter in an event
+func counterValue(raw interface{}) (float64, bool) {
+	switch value := raw.(type) {
+	case uint64:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case int:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
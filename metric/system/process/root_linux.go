@@ -0,0 +1,39 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getRoot returns the root directory of a process from the /proc/PID/root symlink.
+// This is only something other than / for processes that are chrooted, or in their own mount namespace.
+func getRoot(hostfs resolve.Resolver, pid int) (string, error) {
+	path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "root")
+	root, err := readerFor(hostfs).Readlink(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading link %s: %w", path, err)
+	}
+	return root, nil
+}
@@ -0,0 +1,63 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestGetRoot(t *testing.T) {
+	testConfig := Stats{
+		Procs:      []string{".*"},
+		Hostfs:     resolve.NewTestResolver("/"),
+		EnableRoot: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	event, err := testConfig.GetOne(os.Getpid())
+	require.NoError(t, err)
+	root, err := event.GetValue("root")
+	require.NoError(t, err)
+	assert.Equal(t, "/", root)
+}
+
+func TestGetRootChrooted(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+
+	testConfig := Stats{
+		Procs:      []string{".*"},
+		Hostfs:     procfs,
+		EnableRoot: true,
+	}
+	require.NoError(t, testConfig.Init())
+
+	procfs.links["/proc/4242/root"] = "/var/lib/containers/rootfs"
+	state, _, err := testConfig.pidFill(4242, false)
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/containers/rootfs", state.Root)
+}
@@ -0,0 +1,148 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/network"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// GetSockets returns the TCP and UDP sockets owned by the given PID.
+// Socket inodes from /proc/[PID]/fd are matched against the socket tables in /proc/[PID]/net,
+// so the sockets are resolved inside the network namespace of the process.
+func (procStats *Stats) GetSockets(pid int) ([]SocketInfo, error) {
+	reader := readerFor(procStats.Hostfs)
+	inodes, err := getSocketInodes(reader, resolve.ProcPath(procStats.Hostfs, strconv.Itoa(pid), "fd"))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching socket inodes for pid %d: %w", pid, err)
+	}
+
+	sockets := []SocketInfo{}
+	if len(inodes) == 0 {
+		return sockets, nil
+	}
+
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		path := resolve.ProcPath(procStats.Hostfs, strconv.Itoa(pid), "net", proto)
+		data, err := reader.ReadFile(path)
+		// the tcp6 and udp6 tables don't exist if IPv6 is disabled
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		var parseErr error
+		err = network.ScanSocketTable(bytes.NewReader(data), func(fields []string) {
+			if parseErr != nil {
+				return
+			}
+			inode, err := strconv.ParseUint(fields[9], 10, 64)
+			if err != nil {
+				parseErr = fmt.Errorf("error parsing inode %s in %s: %w", fields[9], path, err)
+				return
+			}
+			if _, ok := inodes[inode]; !ok {
+				return
+			}
+			socket, err := socketFromFields(proto, inode, fields)
+			if err != nil {
+				parseErr = fmt.Errorf("error parsing socket table %s: %w", path, err)
+				return
+			}
+			sockets = append(sockets, socket)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		if parseErr != nil {
+			return nil, parseErr
+		}
+	}
+
+	return sockets, nil
+}
+
+// getSocketInodes returns the set of socket inodes referenced by the file descriptors in the given fd directory
+func getSocketInodes(reader fsReader, fdPath string) (map[uint64]struct{}, error) {
+	fds, err := reader.ReadDir(fdPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading FD directory %s: %w", fdPath, err)
+	}
+
+	inodes := make(map[uint64]struct{})
+	for _, fd := range fds {
+		link, err := reader.Readlink(filepath.Join(fdPath, fd.Name()))
+		// The FD may have been closed since we read the directory
+		if err != nil {
+			continue
+		}
+		// socket links are of the form socket:[12345]
+		if !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+			continue
+		}
+		inode, err := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 64)
+		if err != nil {
+			continue
+		}
+		inodes[inode] = struct{}{}
+	}
+
+	return inodes, nil
+}
+
+func socketFromFields(proto string, inode uint64, fields []string) (SocketInfo, error) {
+	localIP, localPort, err := network.ParseSocketAddr(fields[1])
+	if err != nil {
+		return SocketInfo{}, err
+	}
+	remoteIP, remotePort, err := network.ParseSocketAddr(fields[2])
+	if err != nil {
+		return SocketInfo{}, err
+	}
+
+	return SocketInfo{
+		Protocol: proto,
+		Local:    SocketAddr{IP: localIP.String(), Port: localPort},
+		Remote:   SocketAddr{IP: remoteIP.String(), Port: remotePort},
+		State:    network.TCPStates[fields[3]],
+		Inode:    inode,
+	}, nil
+}
+
+// getIPv6Counters returns the Ip6 counters from /proc/[PID]/net/snmp6, or a nil map if IPv6 is disabled.
+func (procStats *Stats) getIPv6Counters(pid int) (map[string]uint64, error) {
+	path := resolve.ProcPath(procStats.Hostfs, strconv.Itoa(pid), "net", "snmp6")
+	data, err := readerFor(procStats.Hostfs).ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return network.ParseSNMP6Counters(data)
+}
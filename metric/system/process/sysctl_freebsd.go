@@ -0,0 +1,67 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build freebsd
+// +build freebsd
+
+package process
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// kfPathOffset is the offset of kf_path in struct kinfo_file, which is the same on every architecture.
+// kern.proc.cwd returns a single kinfo_file for the working directory.
+const kfPathOffset = 368
+
+// sysctlCwd returns the working directory of a process from the kern.proc.cwd sysctl.
+// The sysctls describe the running kernel, so they aren't used when an alternate hostfs is set.
+func sysctlCwd(hostfs resolve.Resolver, pid int) (string, error) {
+	if hostfs.IsSet() {
+		return "", ErrNotImplemented
+	}
+	data, err := unix.SysctlRaw("kern.proc.cwd", pid)
+	if err != nil {
+		return "", fmt.Errorf("error reading kern.proc.cwd for pid %d: %w", pid, err)
+	}
+	if len(data) <= kfPathOffset {
+		return "", fmt.Errorf("kern.proc.cwd for pid %d is too short: %d bytes", pid, len(data))
+	}
+	path := data[kfPathOffset:]
+	if end := bytes.IndexByte(path, 0); end >= 0 {
+		path = path[:end]
+	}
+	return string(path), nil
+}
+
+// sysctlEnv returns the environment of a process from the kern.proc.env sysctl, in the same format as /proc/PID/environ
+func sysctlEnv(hostfs resolve.Resolver, pid int, filter func(string) bool) (mapstr.M, error) {
+	if hostfs.IsSet() {
+		return nil, ErrNotImplemented
+	}
+	data, err := unix.SysctlRaw("kern.proc.env", pid)
+	if err != nil {
+		return nil, fmt.Errorf("error reading kern.proc.env for pid %d: %w", pid, err)
+	}
+	return parseEnv(data, filter), nil
+}
@@ -0,0 +1,99 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+
+	"github.com/elastic/elastic-agent-libs/opt"
+	"github.com/elastic/elastic-agent-system-metrics/metric"
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+// getTaskCPUTime returns the user, system and total CPU times of a process summed from the stat file of each of its threads,
+// in /proc/PID/task/TID/stat. Threads that exit while they're being read are skipped.
+// The sums don't include threads that have already exited, so each time is never reported below the process-wide one in cpu,
+// which does, to keep the times from going down between samples.
+func getTaskCPUTime(hostfs resolve.Resolver, pid int, cpu ProcCPUInfo) (ProcCPUInfo, error) {
+	taskDir := resolve.ProcPath(hostfs, strconv.Itoa(pid), "task")
+	tasks, err := readerFor(hostfs).ReadDir(taskDir)
+	if err != nil {
+		return cpu, fmt.Errorf("error reading %s: %w", taskDir, err)
+	}
+
+	var user, sys uint64
+	for _, task := range tasks {
+		if !dirIsPid(task.Name()) {
+			continue
+		}
+		path := resolve.ProcPath(hostfs, strconv.Itoa(pid), "task", task.Name(), "stat")
+		data, err := readerFor(hostfs).ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return cpu, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		taskUser, taskSys, err := parseStatCPUTimes(string(data))
+		if err != nil {
+			return cpu, fmt.Errorf("error parsing %s: %w", path, err)
+		}
+		user = saturatingAdd(user, taskUser)
+		sys = saturatingAdd(sys, taskSys)
+	}
+
+	cpu.User.Ticks = opt.UintWith(maxUint(metric.TicksToMsUint(user), cpu.User.Ticks.ValueOr(0)))
+	cpu.System.Ticks = opt.UintWith(maxUint(metric.TicksToMsUint(sys), cpu.System.Ticks.ValueOr(0)))
+	cpu.Total.Ticks = opt.UintWith(saturatingAdd(cpu.User.Ticks.ValueOr(0), cpu.System.Ticks.ValueOr(0)))
+	return cpu, nil
+}
+
+// parseStatCPUTimes returns the utime and stime fields of a stat file, in USER_HZ.
+// The fields are counted from the last ")", as the comm before it can contain spaces and parentheses.
+func parseStatCPUTimes(data string) (uint64, uint64, error) {
+	// utime and stime are the 14th and 15th fields, and the fields after comm start with the 3rd
+	fields, err := statFieldsAfterComm(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("expected at least 13 fields after comm, got %d", len(fields))
+	}
+	user, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing user CPU time: %w", err)
+	}
+	sys, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error parsing system CPU time: %w", err)
+	}
+	return user, sys, nil
+}
+
+func maxUint(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,94 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"math"
+	"os"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-system-metrics/metric/system/resolve"
+)
+
+func TestSumTaskCPU(t *testing.T) {
+	// use some CPU across a few threads, so there's something to sum
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := time.Now(); time.Since(start) < 200*time.Millisecond; {
+			}
+		}()
+	}
+	wg.Wait()
+
+	processStats := Stats{Procs: []string{".*"}, Hostfs: resolve.NewTestResolver("/")}
+	require.NoError(t, processStats.Init())
+	taskStats := Stats{Procs: []string{".*"}, Hostfs: resolve.NewTestResolver("/"), SumTaskCPU: true}
+	require.NoError(t, taskStats.Init())
+
+	processLevel, err := processStats.GetOneTyped(os.Getpid())
+	require.NoError(t, err)
+	summed, err := taskStats.GetOneTyped(os.Getpid())
+	require.NoError(t, err)
+
+	// The Go runtime keeps its threads around, so the summed times should only differ by what was used between the reads
+	processTotal := float64(processLevel.CPU.Total.Ticks.ValueOr(0))
+	taskTotal := float64(summed.CPU.Total.Ticks.ValueOr(0))
+	require.NotZero(t, taskTotal)
+	assert.InDelta(t, processTotal, taskTotal, math.Max(0.1*processTotal, 50))
+}
+
+func TestSumTaskCPUSynthetic(t *testing.T) {
+	procfs := newMemProcFS()
+	procfs.addProc("4242", 100)
+	for tid, times := range map[string]string{"4242": "100 20", "4243": "80 40"} {
+		// thread names can contain spaces and parentheses
+		procfs.files["proc/4242/task/"+tid+"/stat"] = &fstest.MapFile{Data: []byte(
+			tid + " (worker (pool) 1) S 1 4242 4242 0 -1 4194304 84 0 2 0 " + times + " 0 0 20 0 1 0 1000 2703360 272 18446744073709551615 " +
+				"1 1 1 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 1 1 1 1 1 1 1 0")}
+	}
+
+	testConfig := Stats{Procs: []string{".*"}, Hostfs: procfs, SumTaskCPU: true}
+	require.NoError(t, testConfig.Init())
+	state, err := testConfig.GetOneTyped(4242)
+	require.NoError(t, err)
+	// the process-level stat has 150 and 50, but the threads have moved on since it was read
+	assert.Equal(t, uint64(1800), state.CPU.User.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(600), state.CPU.System.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(2400), state.CPU.Total.Ticks.ValueOr(0))
+
+	// once a thread exits its times are only in the process-level stat, which is reported where it's higher
+	delete(procfs.files, "proc/4242/task/4243/stat")
+	state, err = testConfig.GetOneTyped(4242)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1500), state.CPU.User.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(500), state.CPU.System.Ticks.ValueOr(0))
+	assert.Equal(t, uint64(2000), state.CPU.Total.Ticks.ValueOr(0))
+	assert.GreaterOrEqual(t, state.CPU.Total.Pct.ValueOr(0), 0.0)
+}
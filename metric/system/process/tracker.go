@@ -0,0 +1,87 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build (darwin && cgo) || freebsd || linux || windows || aix
+// +build darwin,cgo freebsd linux windows aix
+
+package process
+
+import "fmt"
+
+// Tracker follows the processes whose names match a pattern, such as the nginx master, without needing to know their PIDs.
+// Each call to Sample looks up the matching processes again, so a process is still followed after it's restarted.
+type Tracker struct {
+	stats    Stats
+	last     map[string]bool // EntityIDs of the previous sample, nil before the first one
+	restarts int
+}
+
+// TrackerSample is the result of Tracker.Sample.
+type TrackerSample struct {
+	Processes []ProcState
+	// Restarted is set if a process from the previous sample is gone, and a new process matches in its place.
+	// This includes a process that's restarted with the same PID, which is told apart by its start time.
+	Restarted bool
+	// Restarts counts the samples that were Restarted since the tracker was created.
+	Restarts int
+}
+
+// TrackByName returns a Tracker for the processes whose names match the given regular expression.
+// The tracker is collected with the same options as procStats, other than Procs.
+// CPU percentages are computed against the previous sample of the same process,
+// so a restarted process won't have percentages until its second sample, even if it kept its PID.
+func (procStats *Stats) TrackByName(pattern string) (*Tracker, error) {
+	tracker := &Tracker{stats: *procStats}
+	tracker.stats.Procs = []string{pattern}
+	if err := tracker.stats.Init(); err != nil {
+		return nil, fmt.Errorf("error initializing tracker for %s: %w", pattern, err)
+	}
+	return tracker, nil
+}
+
+// Sample returns the current state of every process that matches the tracked pattern.
+// Processes that have exited since the previous sample are dropped, along with their CPU percentage state.
+func (tracker *Tracker) Sample() (TrackerSample, error) {
+	tracker.stats.resetCgroupCache()
+	tracker.stats.gpuUsage = nil
+
+	pidMap, plist, err := tracker.stats.FetchPids()
+	if err != nil {
+		return TrackerSample{}, fmt.Errorf("error gathering PIDs: %w", err)
+	}
+	tracker.stats.ProcsMap.SetMap(pidMap)
+
+	sample := TrackerSample{Processes: tracker.stats.includeTopProcesses(plist)}
+	current := make(map[string]bool, len(sample.Processes))
+	started := false
+	for _, proc := range sample.Processes {
+		current[proc.EntityID] = true
+		started = started || (tracker.last != nil && !tracker.last[proc.EntityID])
+	}
+	if started {
+		for entityID := range tracker.last {
+			if !current[entityID] {
+				sample.Restarted = true
+				tracker.restarts++
+				break
+			}
+		}
+	}
+	tracker.last = current
+	sample.Restarts = tracker.restarts
+	return sample, nil
+}
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package process
+
+import (
+	"os/user"
+	"sync"
+	"time"
+)
+
+// usernames is the username cache shared by every Stats in the process
+var usernames = &usernameCache{lookupID: user.LookupId, now: time.Now}
+
+// usernameCache holds the usernames of user IDs, so processes owned by the same user don't each look the user up again.
+// Looking a user up can mean parsing /etc/passwd or calling out to NSS, which adds up on hosts with a lot of process churn.
+type usernameCache struct {
+	mut     sync.Mutex
+	ttl     time.Duration
+	entries map[string]usernameEntry
+	// pending holds the lookups in progress, so concurrent lookups of a user wait for the first one instead of repeating it
+	pending  map[string]*usernameLookup
+	lookupID func(uid string) (*user.User, error)
+	now      func() time.Time
+}
+
+type usernameEntry struct {
+	name    string
+	expires time.Time
+}
+
+// usernameLookup is a lookup in progress. name is set before done is closed.
+type usernameLookup struct {
+	done chan struct{}
+	name string
+}
+
+// SetUsernameCacheTTL caches the usernames of the user IDs that own processes for the given time, for every Stats in the process.
+// Users are looked up again once they expire, so renamed users are picked up. Caching is disabled if the TTL is zero, which is the default.
+func SetUsernameCacheTTL(ttl time.Duration) {
+	usernames.setTTL(ttl)
+}
+
+func (cache *usernameCache) setTTL(ttl time.Duration) {
+	cache.mut.Lock()
+	defer cache.mut.Unlock()
+	cache.ttl = ttl
+	cache.entries = nil
+}
+
+// lookupUsername returns the username of a user ID, falling back to the ID itself if the user can't be looked up.
+// Users that can't be looked up are cached as well, as that's common for containers with their own passwd files.
+func lookupUsername(uid string) string {
+	return usernames.lookup(uid)
+}
+
+func (cache *usernameCache) lookup(uid string) string {
+	cache.mut.Lock()
+	now := cache.now()
+	if entry, ok := cache.entries[uid]; ok && now.Before(entry.expires) {
+		cache.mut.Unlock()
+		return entry.name
+	}
+	if pending, ok := cache.pending[uid]; ok {
+		cache.mut.Unlock()
+		<-pending.done
+		return pending.name
+	}
+	pending := &usernameLookup{done: make(chan struct{})}
+	if cache.pending == nil {
+		cache.pending = map[string]*usernameLookup{}
+	}
+	cache.pending[uid] = pending
+	cache.mut.Unlock()
+
+	// the lock isn't held during the lookup, so a slow NSS lookup of one user doesn't hold up the others
+	pending.name = uid
+	if u, err := cache.lookupID(uid); err == nil && u.Username != "" {
+		pending.name = u.Username
+	}
+
+	cache.mut.Lock()
+	delete(cache.pending, uid)
+	if cache.ttl > 0 {
+		cache.store(uid, pending.name, now)
+	}
+	cache.mut.Unlock()
+	close(pending.done)
+	return pending.name
+}
+
+// store caches the username of uid. Expired entries are dropped first, so the users of processes that are gone don't pile up.
+func (cache *usernameCache) store(uid, name string, now time.Time) {
+	if cache.entries == nil {
+		cache.entries = map[string]usernameEntry{}
+	}
+	for id, entry := range cache.entries {
+		if !now.Before(entry.expires) {
+			delete(cache.entries, id)
+		}
+	}
+	cache.entries[uid] = usernameEntry{name: name, expires: now.Add(cache.ttl)}
+}
@@ -17,7 +17,10 @@
 
 package resolve
 
-import "path/filepath"
+import (
+	"os"
+	"path/filepath"
+)
 
 // Resolver is an interface for HostFS resolvers. This is meant to be generic and (hopefully) future-proof way of dealing with a user-supplied root filesystem path.
 // A resolver-style function serves two ends:
@@ -34,31 +37,109 @@ type Resolver interface {
 	Join(...string) string
 }
 
+// ProcResolver is a Resolver that knows where procfs is mounted, for hosts where it isn't at <hostfs>/proc.
+// ProcPath uses ResolveProc for every resolver that implements it.
+type ProcResolver interface {
+	Resolver
+	// ResolveProc returns the location of procfs
+	ResolveProc() string
+}
+
+var _ ProcResolver = TestingResolver{}
+
 // TestingResolver is a bare implementation of the resolver, for system tests that need a Resolver object or a test path for input files.
 type TestingResolver struct {
-	path  string
-	isSet bool
+	path     string
+	isSet    bool
+	procPath string
 }
 
 // NewTestResolver returns a new resolver for internal testing, or other uses outside metricbeat modules.
+// procfs is expected at <path>/proc; use NewTestResolverWithProc if it's mounted somewhere else.
 func NewTestResolver(path string) TestingResolver {
 	if path == "" || path == "/" {
-		return TestingResolver{path: "/", isSet: false}
+		return TestingResolver{path: "/", isSet: false, procPath: filepath.Join("/", "proc")}
 	}
 
-	return TestingResolver{path: path, isSet: true}
+	return TestingResolver{path: path, isSet: true, procPath: filepath.Join(path, "proc")}
+}
+
+// NewTestResolverWithProc returns a resolver for the given root, with procfs at procPath instead of <path>/proc.
+// This is for alternate roots that don't have procfs mounted, such as a container that only mounts the host's filesystem,
+// but can still read the host's processes from its own /proc.
+func NewTestResolverWithProc(path, procPath string) TestingResolver {
+	resolver := NewTestResolver(path)
+	resolver.procPath = procPath
+	return resolver
+}
+
+// NewTestResolverDetectProc returns a resolver for the given root, with procfs at <path>/proc if one is mounted there,
+// and at /proc otherwise. The latter is for a container that only mounts the host's filesystem, and reads the host's processes
+// from its own /proc as it shares the host's PID namespace.
+func NewTestResolverDetectProc(path string) TestingResolver {
+	resolver := NewTestResolver(path)
+	resolver.procPath = detectProc(resolver.path)
+	return resolver
+}
+
+// detectProc returns <root>/proc if it holds a procfs, which is checked for by its stat file, and /proc otherwise
+func detectProc(root string) string {
+	procPath := filepath.Join(root, "proc")
+	if _, err := os.Stat(filepath.Join(procPath, "stat")); err == nil {
+		return procPath
+	}
+	return filepath.Join("/", "proc")
+}
+
+// ProcPath returns a path under the procfs mount point of the given Resolver.
+// If the resolver is a ProcResolver, ResolveProc is used to find procfs, otherwise procfs is assumed to be at <hostfs>/proc.
+func ProcPath(r Resolver, path ...string) string {
+	procDir := ""
+	if procResolver, ok := r.(ProcResolver); ok {
+		procDir = procResolver.ResolveProc()
+	} else {
+		procDir = r.Join("proc")
+	}
+	return filepath.Join(append([]string{procDir}, path...)...)
 }
 
 func (t TestingResolver) ResolveHostFS(path string) string {
-	return filepath.Join(t.path, path)
+	return t.join(path)
 }
 
 func (t TestingResolver) Join(path ...string) string {
-	fullpath := append([]string{t.path}, path...)
-	return filepath.Join(fullpath...)
+	return t.join(path...)
+}
+
+// join prepends the root path to the given path elements.
+// On windows, a drive letter in the first element is dropped when an alternate root is set, so that
+// C:\hostfs and C:\Windows results in C:\hostfs\Windows instead of an invalid path.
+// Without an alternate root, a path with a drive letter is returned as-is, rather than being prefixed with "\".
+func (t TestingResolver) join(path ...string) string {
+	fullpath := make([]string, 0, len(path)+1)
+	fullpath = append(fullpath, t.path)
+	fullpath = append(fullpath, path...)
 
+	if len(path) > 0 {
+		if volume := filepath.VolumeName(path[0]); volume != "" {
+			if !t.isSet {
+				return filepath.Join(path...)
+			}
+			fullpath[1] = path[0][len(volume):]
+		}
+	}
+	return filepath.Join(fullpath...)
 }
 
 func (t TestingResolver) IsSet() bool {
 	return t.isSet
 }
+
+// ResolveProc returns the location of procfs, which is <hostfs>/proc unless the resolver was created with
+// NewTestResolverWithProc or NewTestResolverDetectProc.
+func (t TestingResolver) ResolveProc() string {
+	if t.procPath == "" {
+		return filepath.Join(t.path, "proc")
+	}
+	return t.procPath
+}
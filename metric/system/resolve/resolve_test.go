@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package resolve
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveProc(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "proc"), 0o755))
+
+	hostfs := NewTestResolver(root)
+	assert.Equal(t, filepath.Join(root, "proc"), hostfs.ResolveProc())
+	assert.Equal(t, filepath.Join(root, "proc", "1", "stat"), ProcPath(hostfs, "1", "stat"))
+
+	// Without procfs under the alternate root, it isn't silently swapped for the system procfs
+	noProcRoot := t.TempDir()
+	noProc := NewTestResolver(noProcRoot)
+	assert.Equal(t, filepath.Join(noProcRoot, "proc"), noProc.ResolveProc())
+
+	// unless that's asked for
+	sysProc := NewTestResolverWithProc(noProcRoot, filepath.Join("/", "proc"))
+	assert.Equal(t, filepath.Join("/", "proc"), sysProc.ResolveProc())
+	assert.Equal(t, filepath.Join("/", "proc", "stat"), ProcPath(sysProc, "stat"))
+	assert.Equal(t, filepath.Join(noProcRoot, "etc"), sysProc.ResolveHostFS("etc"))
+
+	assert.Equal(t, filepath.Join("/", "proc"), NewTestResolver("/").ResolveProc())
+}
+
+func TestResolveProcDetection(t *testing.T) {
+	// procfs mounted under the alternate root is used
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "proc"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "proc", "stat"), []byte("btime 1700000000\n"), 0o644))
+	hostfs := NewTestResolverDetectProc(root)
+	assert.Equal(t, filepath.Join(root, "proc"), hostfs.ResolveProc())
+	assert.Equal(t, filepath.Join(root, "proc", "1", "stat"), ProcPath(hostfs, "1", "stat"))
+
+	// an empty proc directory isn't a procfs, so the system one is used
+	emptyProcRoot := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(emptyProcRoot, "proc"), 0o755))
+	hostfs = NewTestResolverDetectProc(emptyProcRoot)
+	assert.Equal(t, filepath.Join("/", "proc"), hostfs.ResolveProc())
+	assert.Equal(t, filepath.Join(emptyProcRoot, "etc"), hostfs.ResolveHostFS("etc"))
+
+	assert.Equal(t, filepath.Join("/", "proc"), NewTestResolverDetectProc("/").ResolveProc())
+}
+
+// joinOnlyResolver is a Resolver that isn't a ProcResolver
+type joinOnlyResolver struct {
+	root string
+}
+
+func (r joinOnlyResolver) ResolveHostFS(path string) string { return filepath.Join(r.root, path) }
+func (r joinOnlyResolver) IsSet() bool                      { return true }
+func (r joinOnlyResolver) Join(path ...string) string {
+	return filepath.Join(append([]string{r.root}, path...)...)
+}
+
+func TestProcPathFallback(t *testing.T) {
+	hostfs := joinOnlyResolver{root: filepath.Join("/", "hostfs")}
+	assert.Equal(t, filepath.Join("/", "hostfs", "proc", "self", "cgroup"), ProcPath(hostfs, "self", "cgroup"))
+}
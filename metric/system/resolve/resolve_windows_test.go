@@ -0,0 +1,46 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build windows
+// +build windows
+
+package resolve
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveHostFSWindows(t *testing.T) {
+	hostfs := NewTestResolver(`C:\hostfs`)
+	assert.True(t, hostfs.IsSet())
+	assert.Equal(t, `C:\hostfs\Windows\System32`, hostfs.ResolveHostFS(`C:\Windows\System32`))
+	assert.Equal(t, `C:\hostfs\Windows\System32`, hostfs.ResolveHostFS(`\Windows\System32`))
+	assert.Equal(t, `C:\hostfs\proc\1\stat`, hostfs.ResolveHostFS("/proc/1/stat"))
+	assert.Equal(t, `C:\hostfs\proc\1\stat`, hostfs.Join("proc", "1", "stat"))
+	assert.Equal(t, `C:\hostfs\Users\test`, hostfs.Join(`D:\Users`, "test"))
+	assert.Equal(t, `\\server\share\hostfs\Windows`, NewTestResolver(`\\server\share\hostfs`).ResolveHostFS(`C:\Windows`))
+}
+
+func TestResolveHostFSWindowsUnset(t *testing.T) {
+	hostfs := NewTestResolver("/")
+	assert.False(t, hostfs.IsSet())
+	assert.Equal(t, `C:\Windows\System32`, hostfs.ResolveHostFS(`C:\Windows\System32`))
+	assert.Equal(t, `C:\Windows\System32`, hostfs.Join(`C:\Windows`, "System32"))
+	assert.Equal(t, `\proc\1\stat`, hostfs.Join("proc", "1", "stat"))
+}
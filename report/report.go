@@ -234,6 +234,10 @@ func ReportMetricsCGV2(logger *logp.Logger, pid int, cgroups *cgroup.Reader, V m
 		logger.Errorf("error getting cgroup stats for V2: %v", err)
 		return
 	}
+	// the process is in the root cgroup, and root cgroups are ignored
+	if selfStats == nil {
+		return
+	}
 
 	if cpu := selfStats.CPU; cpu != nil {
 		monitoring.ReportNamespace(V, "cpu", func() {